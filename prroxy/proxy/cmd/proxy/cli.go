@@ -0,0 +1,673 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+// command is an offline subcommand working directly on a recordings
+// directory, without a running server
+type command struct {
+	summary string
+	run     func(c *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"ls":     {"List recordings (filter with -target, -method, -status, -url, -operation)", (*cli).list},
+	"show":   {"Show one recording with decoded bodies: show <id>", (*cli).show},
+	"rm":     {"Delete recordings and their history: rm <id>...", (*cli).remove},
+	"mv":     {"Move recordings to another directory: mv -to <dir> <id>...", (*cli).move},
+	"export": {"Write recordings as JSON lines, blobs inlined (-o file, ls filters)", (*cli).export},
+	"import": {"Read recordings written by export (-i file)", (*cli).importRecordings},
+	"verify": {"Re-hash every recording and blob and report or repair damage", (*cli).verify},
+	"stats":  {"Summarize the recordings directory", (*cli).stats},
+	"gc":     {"Remove blobs no recording refers to (-n for a dry run)", (*cli).gc},
+}
+
+// cli holds what every subcommand needs
+type cli struct {
+	cfg    *config.Config
+	out    io.Writer
+	errOut io.Writer
+	dir    string
+}
+
+// runCommand runs a subcommand with the proxy's configuration; the
+// recordings directory defaults to storage.path
+func runCommand(name string, args []string, out, errOut io.Writer) error {
+	cfg := config.New()
+	if err := cfg.Load(); err != nil {
+		fmt.Fprintf(errOut, "Warning: Failed to load config: %v\n", err)
+	}
+
+	c := &cli{cfg: cfg, out: out, errOut: errOut}
+	return commands[name].run(c, args)
+}
+
+// printCommands lists the subcommands for -help output
+func printCommands(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "Subcommands (run without one to start the server):")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-7s %s\n", name, commands[name].summary)
+	}
+}
+
+// flagSet creates the subcommand's flags, including -dir
+func (c *cli) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.errOut)
+	fs.StringVar(&c.dir, "dir", c.cfg.Storage.Path, "Recordings directory")
+	return fs
+}
+
+func (c *cli) open() (*storage.FileSystemRepository, error) {
+	if _, err := os.Stat(c.dir); err != nil {
+		return nil, fmt.Errorf("recordings directory: %w", err)
+	}
+	return c.create(c.dir)
+}
+
+// create opens or creates a recordings directory, writing in the
+// configured format
+func (c *cli) create(dir string) (*storage.FileSystemRepository, error) {
+	repo, err := storage.NewFileSystemRepository(dir)
+	if err != nil {
+		return nil, err
+	}
+	repo.SetFormat(c.cfg.Storage.Format)
+	repo.SetHistoryLimit(c.cfg.Storage.History)
+	repo.SetDedup(c.cfg.Storage.Dedup)
+	return repo, nil
+}
+
+// queryFlags registers the ls filters
+func queryFlags(fs *flag.FlagSet) func() (storage.Query, error) {
+	target := fs.String("target", "", "Host or target prefix")
+	method := fs.String("method", "", "HTTP method")
+	status := fs.Int("status", 0, "Response status")
+	url := fs.String("url", "", "URL substring")
+	urlRegex := fs.String("url-regex", "", "URL regular expression")
+	operation := fs.String("operation", "", "GraphQL operation name")
+	sortBy := fs.String("sort", "", "timestamp, url, status, duration or method (prefix - for descending)")
+	limit := fs.Int("limit", 0, "Maximum number of recordings")
+
+	return func() (storage.Query, error) {
+		query := storage.Query{
+			Target:      *target,
+			Method:      *method,
+			Status:      *status,
+			URLContains: *url,
+			Operation:   *operation,
+			Limit:       *limit,
+		}
+		if *urlRegex != "" {
+			pattern, err := regexp.Compile(*urlRegex)
+			if err != nil {
+				return query, fmt.Errorf("invalid -url-regex: %w", err)
+			}
+			query.URLPattern = pattern
+		}
+		if *sortBy != "" {
+			query.SortBy = strings.TrimPrefix(*sortBy, "-")
+			query.Ascending = !strings.HasPrefix(*sortBy, "-")
+		}
+		return query, nil
+	}
+}
+
+func (c *cli) list(args []string) error {
+	fs := c.flagSet("ls")
+	buildQuery := queryFlags(fs)
+	full := fs.Bool("full", false, "Print full IDs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	query, err := buildQuery()
+	if err != nil {
+		return err
+	}
+	repo, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	result, err := repo.Query(query)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tMETHOD\tSTATUS\tURL\tRECORDED")
+	for _, interaction := range result.Interactions {
+		id := interaction.Request.GenerateHash()
+		if !*full {
+			id = id[:12]
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", id, interaction.Request.Method,
+			interaction.Response.StatusCode, interaction.Request.URL,
+			interaction.Timestamp.Format(time.RFC3339))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(result.Interactions) < result.Total {
+		fmt.Fprintf(c.errOut, "%d of %d recordings shown\n", len(result.Interactions), result.Total)
+	}
+	return nil
+}
+
+// resolve finds a recording by full ID or unique ID prefix
+func resolve(repo storage.Repository, id string) (*models.Interaction, error) {
+	if len(id) == 64 {
+		return repo.Find(id)
+	}
+	if id == "" {
+		return nil, fmt.Errorf("empty recording ID")
+	}
+
+	all, err := repo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	var found *models.Interaction
+	for _, interaction := range all {
+		if strings.HasPrefix(interaction.Request.GenerateHash(), id) {
+			if found != nil {
+				return nil, fmt.Errorf("ID prefix %s is ambiguous", id)
+			}
+			found = interaction
+		}
+	}
+	if found == nil {
+		return nil, storage.ErrNotFound{Hash: id}
+	}
+	return found, nil
+}
+
+func (c *cli) show(args []string) error {
+	fs := c.flagSet("show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: show [-dir dir] <id>")
+	}
+	repo, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	interaction, err := resolve(repo, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	req, resp := interaction.Request, interaction.Response
+
+	fmt.Fprintf(c.out, "ID:        %s\n", req.GenerateHash())
+	fmt.Fprintf(c.out, "Recorded:  %s\n", interaction.Timestamp.Format(time.RFC3339))
+	fmt.Fprintf(c.out, "Target:    %s\n", interaction.Metadata.Target)
+	fmt.Fprintf(c.out, "Duration:  %dms\n\n", interaction.Metadata.DurationMS)
+
+	fmt.Fprintf(c.out, "> %s %s\n", req.Method, req.URL)
+	printHeaders(c.out, "> ", req.Headers)
+	if err := c.printBody(repo, req.Body, req.BodyRef); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "\n< %d %s\n", resp.StatusCode, http.StatusText(resp.StatusCode))
+	if err := resp.Decompress(); err != nil {
+		fmt.Fprintf(c.errOut, "Warning: Showing encoded body: %v\n", err)
+	}
+	printHeaders(c.out, "< ", resp.Headers)
+	if resp.ContentEncoding != "" {
+		fmt.Fprintf(c.out, "< (recorded with Content-Encoding: %s)\n", resp.ContentEncoding)
+	}
+	if err := c.printBody(repo, resp.Body, resp.BodyRef); err != nil {
+		return err
+	}
+	if interaction.WebSocket != nil {
+		fmt.Fprintf(c.out, "\nWebSocket: %d frames\n", len(interaction.WebSocket.Frames))
+	}
+	return nil
+}
+
+func printHeaders(w io.Writer, prefix string, headers map[string][]string) {
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range headers[key] {
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, key, value)
+		}
+	}
+}
+
+// printBody prints a body, reading blobs and indenting JSON; binary
+// bodies are summarized
+func (c *cli) printBody(repo storage.Repository, body []byte, ref string) error {
+	if ref != "" {
+		blob, err := repo.OpenBlob(ref)
+		if err != nil {
+			return err
+		}
+		defer blob.Close()
+		if body, err = io.ReadAll(blob); err != nil {
+			return fmt.Errorf("failed to read blob %s: %w", ref, err)
+		}
+	}
+	if len(body) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(c.out)
+	var indented bytes.Buffer
+	switch {
+	case json.Indent(&indented, body, "", "  ") == nil:
+		fmt.Fprintln(c.out, indented.String())
+	case utf8.Valid(body):
+		fmt.Fprintln(c.out, string(body))
+	default:
+		fmt.Fprintf(c.out, "(%d bytes of binary data)\n", len(body))
+	}
+	return nil
+}
+
+func (c *cli) remove(args []string) error {
+	fs := c.flagSet("rm")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: rm [-dir dir] <id>...")
+	}
+	repo, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range fs.Args() {
+		// Full IDs are deleted without reading, so damaged files can go too
+		if len(id) == 64 {
+			if err := repo.Delete(id); err != nil {
+				return err
+			}
+			fmt.Fprintf(c.out, "Removed %s\n", id[:12])
+			continue
+		}
+
+		interaction, err := resolve(repo, id)
+		if err != nil {
+			return err
+		}
+		hash := interaction.Request.GenerateHash()
+		if err := repo.Delete(hash); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "Removed %s %s %s\n", hash[:12], interaction.Request.Method, interaction.Request.URL)
+	}
+	return nil
+}
+
+func (c *cli) move(args []string) error {
+	fs := c.flagSet("mv")
+	to := fs.String("to", "", "Destination recordings directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" || fs.NArg() == 0 {
+		return fmt.Errorf("usage: mv [-dir dir] -to <dir> <id>...")
+	}
+	repo, err := c.open()
+	if err != nil {
+		return err
+	}
+	dest, err := c.create(*to)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range fs.Args() {
+		interaction, err := resolve(repo, id)
+		if err != nil {
+			return err
+		}
+		hash := interaction.Request.GenerateHash()
+
+		// Blobs go first so the moved recording is never left dangling
+		for _, ref := range []string{interaction.Request.BodyRef, interaction.Response.BodyRef} {
+			if ref != "" {
+				if err := copyBlob(repo, dest, ref); err != nil {
+					return err
+				}
+			}
+		}
+		if err := dest.Save(interaction); err != nil {
+			return err
+		}
+		if err := repo.Delete(hash); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "Moved %s %s %s\n", hash[:12], interaction.Request.Method, interaction.Request.URL)
+	}
+	return nil
+}
+
+func copyBlob(from, to storage.Repository, ref string) error {
+	blob, err := from.OpenBlob(ref)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	_, _, err = to.SaveBlob(blob)
+	return err
+}
+
+func (c *cli) export(args []string) error {
+	fs := c.flagSet("export")
+	buildQuery := queryFlags(fs)
+	output := fs.String("o", "", "Output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	query, err := buildQuery()
+	if err != nil {
+		return err
+	}
+	repo, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	result, err := repo.Query(query)
+	if err != nil {
+		return err
+	}
+
+	w := c.out
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	for _, interaction := range result.Interactions {
+		if err := inlineBodies(repo, interaction); err != nil {
+			return err
+		}
+		if err := encoder.Encode(interaction); err != nil {
+			return err
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.errOut, "Exported %d recordings\n", len(result.Interactions))
+	return nil
+}
+
+// inlineBodies reads blob bodies back into the recording so an export is
+// self-contained
+func inlineBodies(repo storage.Repository, interaction *models.Interaction) error {
+	read := func(ref string) ([]byte, error) {
+		blob, err := repo.OpenBlob(ref)
+		if err != nil {
+			return nil, err
+		}
+		defer blob.Close()
+		return io.ReadAll(blob)
+	}
+
+	if ref := interaction.Request.BodyRef; ref != "" {
+		body, err := read(ref)
+		if err != nil {
+			return err
+		}
+		interaction.Request.Body = body
+		interaction.Request.BodyRef, interaction.Request.BodySize, interaction.Request.BodyHash = "", 0, ""
+	}
+	if ref := interaction.Response.BodyRef; ref != "" {
+		body, err := read(ref)
+		if err != nil {
+			return err
+		}
+		interaction.Response.Body = body
+		interaction.Response.BodyRef, interaction.Response.BodySize = "", 0
+	}
+	return nil
+}
+
+func (c *cli) importRecordings(args []string) error {
+	fs := c.flagSet("import")
+	input := fs.String("i", "", "Input file (default stdin)")
+	format := fs.String("format", c.cfg.Storage.Format, "File format: json or readable")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "" && *format != storage.FormatJSON && *format != storage.FormatReadable {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	repo, err := c.create(c.dir)
+	if err != nil {
+		return err
+	}
+	repo.SetFormat(*format)
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	threshold := c.cfg.Storage.BlobThresholdBytes()
+	decoder := json.NewDecoder(r)
+	count := 0
+	for {
+		var interaction models.Interaction
+		if err := decoder.Decode(&interaction); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("recording %d: %w", count+1, err)
+		}
+		if err := externalizeBodies(repo, &interaction, threshold); err != nil {
+			return err
+		}
+		if err := repo.Save(&interaction); err != nil {
+			return err
+		}
+		count++
+	}
+	fmt.Fprintf(c.out, "Imported %d recordings\n", count)
+	return nil
+}
+
+// externalizeBodies moves bodies over the blob threshold out of line, as
+// the recorder would have stored them
+func externalizeBodies(repo storage.Repository, interaction *models.Interaction, threshold int64) error {
+	if req := &interaction.Request; int64(len(req.Body)) > threshold {
+		hash := req.GenerateHash()
+		ref, size, err := repo.SaveBlob(bytes.NewReader(req.Body))
+		if err != nil {
+			return err
+		}
+		req.Body, req.BodyRef, req.BodySize, req.BodyHash = nil, ref, size, hash
+	}
+	if resp := &interaction.Response; int64(len(resp.Body)) > threshold {
+		ref, size, err := repo.SaveBlob(bytes.NewReader(resp.Body))
+		if err != nil {
+			return err
+		}
+		resp.Body, resp.BodyRef, resp.BodySize = nil, ref, size
+	}
+	return nil
+}
+
+func (c *cli) verify(args []string) error {
+	fs := c.flagSet("verify")
+	repair := fs.Bool("repair", false, "Rename mismatched recordings and quarantine the rest")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	repo, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	problems, err := repo.Verify()
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(c.out, "%s: [%s] %s\n", problem.Path, problem.Kind, problem.Issue)
+	}
+	if len(problems) > 0 && *repair {
+		repaired, err := repo.Repair(problems)
+		for _, problem := range repaired {
+			fmt.Fprintf(c.out, "%s: %s\n", problem.Path, problem.Fix)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "Repaired %d problems\n", len(repaired))
+		return nil
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+	fmt.Fprintln(c.out, "All recordings OK")
+	return nil
+}
+
+func (c *cli) gc(args []string) error {
+	fs := c.flagSet("gc")
+	dryRun := fs.Bool("n", false, "List unreferenced blobs without removing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	repo, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	result, err := repo.GC(*dryRun)
+	if err != nil {
+		return err
+	}
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	for _, digest := range result.Removed {
+		fmt.Fprintf(c.out, "%s %s\n", verb, digest)
+	}
+	fmt.Fprintf(c.out, "%s %d blobs (%d bytes), kept %d\n", verb, len(result.Removed), result.Bytes, result.Kept)
+	return nil
+}
+
+func (c *cli) stats(args []string) error {
+	fs := c.flagSet("stats")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	repo, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	all, err := repo.FindAll()
+	if err != nil {
+		return err
+	}
+
+	byTarget := map[string]int{}
+	byMethod := map[string]int{}
+	byStatus := map[string]int{}
+	var oldest, newest time.Time
+	for _, interaction := range all {
+		byTarget[interaction.Metadata.Target]++
+		byMethod[interaction.Request.Method]++
+		byStatus[fmt.Sprintf("%dxx", interaction.Response.StatusCode/100)]++
+		if oldest.IsZero() || interaction.Timestamp.Before(oldest) {
+			oldest = interaction.Timestamp
+		}
+		if interaction.Timestamp.After(newest) {
+			newest = interaction.Timestamp
+		}
+	}
+
+	fmt.Fprintf(c.out, "Directory:   %s\n", c.dir)
+	fmt.Fprintf(c.out, "Recordings:  %d\n", len(all))
+	if len(all) > 0 {
+		fmt.Fprintf(c.out, "Oldest:      %s\n", oldest.Format(time.RFC3339))
+		fmt.Fprintf(c.out, "Newest:      %s\n", newest.Format(time.RFC3339))
+	}
+	if size, files, err := dirSize(c.dir); err == nil {
+		fmt.Fprintf(c.out, "Disk usage:  %d bytes in %d files\n", size, files)
+	}
+
+	for _, group := range []struct {
+		title  string
+		counts map[string]int
+	}{{"By target", byTarget}, {"By method", byMethod}, {"By status", byStatus}} {
+		fmt.Fprintf(c.out, "\n%s:\n", group.title)
+		keys := make([]string, 0, len(group.counts))
+		for key := range group.counts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(c.out, "  %-40s %d\n", key, group.counts[key])
+		}
+	}
+	return nil
+}
+
+// dirSize totals the files below dir
+func dirSize(dir string) (int64, int, error) {
+	var size int64
+	files := 0
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files, err
+}
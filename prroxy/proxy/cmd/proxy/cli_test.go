@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+// run executes a subcommand and returns its standard output
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	err := runCommand(args[0], args[1:], &out, &errOut)
+	return out.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := storage.NewFileSystemRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	ref, size, _ := repo.SaveBlob(strings.NewReader(strings.Repeat("x", 100)))
+	fixtures := []*models.Interaction{
+		{
+			Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			Request:   models.RecordedRequest{Method: "GET", URL: "https://api.example.com/users/1"},
+			Response:  models.RecordedResponse{StatusCode: 200, Body: []byte(`{"name":"Alice"}`)},
+			Metadata:  models.InteractionMetadata{Target: "https://api.example.com/users/1"},
+		},
+		{
+			Timestamp: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			Request:   models.RecordedRequest{Method: "POST", URL: "https://api.example.com/files"},
+			Response:  models.RecordedResponse{StatusCode: 201, BodyRef: ref, BodySize: size},
+			Metadata:  models.InteractionMetadata{Target: "https://api.example.com/files"},
+		},
+	}
+	for _, interaction := range fixtures {
+		if err := repo.Save(interaction); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+	}
+	userID := fixtures[0].Request.GenerateHash()
+	fileID := fixtures[1].Request.GenerateHash()
+
+	t.Run("ls filters", func(t *testing.T) {
+		out, err := run(t, "ls", "-dir", dir, "-method", "GET")
+		if err != nil {
+			t.Fatalf("ls failed: %v", err)
+		}
+		if !strings.Contains(out, userID[:12]) || strings.Contains(out, fileID[:12]) {
+			t.Errorf("Expected only the GET recording:\n%s", out)
+		}
+	})
+
+	t.Run("show by prefix", func(t *testing.T) {
+		out, err := run(t, "show", "-dir", dir, userID[:8])
+		if err != nil {
+			t.Fatalf("show failed: %v", err)
+		}
+		if !strings.Contains(out, "< 200 OK") || !strings.Contains(out, `"name": "Alice"`) {
+			t.Errorf("Expected status and indented body:\n%s", out)
+		}
+	})
+
+	t.Run("export and import", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "export.jsonl")
+		if _, err := run(t, "export", "-dir", dir, "-o", file); err != nil {
+			t.Fatalf("export failed: %v", err)
+		}
+		data, _ := os.ReadFile(file)
+		if strings.Contains(string(data), ref) {
+			t.Error("Expected blob bodies to be inlined in the export")
+		}
+
+		other := t.TempDir()
+		out, err := run(t, "import", "-dir", other, "-i", file)
+		if err != nil {
+			t.Fatalf("import failed: %v", err)
+		}
+		if !strings.Contains(out, "Imported 2 recordings") {
+			t.Errorf("Unexpected output: %s", out)
+		}
+
+		imported, _ := storage.NewFileSystemRepository(other)
+		if _, err := imported.Find(fileID); err != nil {
+			t.Errorf("Imported recording not found: %v", err)
+		}
+	})
+
+	t.Run("mv", func(t *testing.T) {
+		other := t.TempDir()
+		if _, err := run(t, "mv", "-dir", dir, "-to", other, fileID[:12]); err != nil {
+			t.Fatalf("mv failed: %v", err)
+		}
+
+		if _, err := repo.Find(fileID); err == nil {
+			t.Error("Recording still in the source directory")
+		}
+		moved, _ := storage.NewFileSystemRepository(other)
+		if _, err := run(t, "verify", "-dir", other); err != nil {
+			t.Errorf("Moved recording should verify with its blob: %v", err)
+		}
+		if count, _ := moved.Count(); count != 1 {
+			t.Errorf("Expected 1 moved recording, got %d", count)
+		}
+	})
+
+	t.Run("verify and stats", func(t *testing.T) {
+		out, err := run(t, "stats", "-dir", dir)
+		if err != nil {
+			t.Fatalf("stats failed: %v", err)
+		}
+		if !strings.Contains(out, "Recordings:  1") {
+			t.Errorf("Unexpected stats:\n%s", out)
+		}
+
+		os.WriteFile(filepath.Join(dir, "api_example_com", userID+".json"), []byte("{"), 0644)
+		out, err = run(t, "verify", "-dir", dir)
+		if err == nil || !strings.Contains(out, "invalid JSON") {
+			t.Errorf("Expected verify to report the broken file, got %v:\n%s", err, out)
+		}
+	})
+
+	t.Run("rm", func(t *testing.T) {
+		if _, err := run(t, "rm", "-dir", dir, userID); err != nil {
+			t.Fatalf("rm failed: %v", err)
+		}
+		if count, _ := repo.Count(); count != 0 {
+			t.Errorf("Expected no recordings left, got %d", count)
+		}
+	})
+
+	t.Run("gc", func(t *testing.T) {
+		// The moved recording's blob is left behind, unreferenced
+		blob := filepath.Join(dir, "_blobs", ref)
+		old := time.Now().Add(-2 * time.Hour)
+		os.Chtimes(blob, old, old)
+
+		out, err := run(t, "gc", "-dir", dir, "-n")
+		if err != nil {
+			t.Fatalf("gc -n failed: %v", err)
+		}
+		if !strings.Contains(out, "Would remove 1 blobs (100 bytes)") {
+			t.Errorf("Unexpected output: %s", out)
+		}
+		if _, err := os.Stat(blob); err != nil {
+			t.Errorf("Dry run removed the blob: %v", err)
+		}
+
+		if _, err := run(t, "gc", "-dir", dir); err != nil {
+			t.Fatalf("gc failed: %v", err)
+		}
+		if _, err := os.Stat(blob); !os.IsNotExist(err) {
+			t.Errorf("Expected the blob to be removed, got %v", err)
+		}
+	})
+}
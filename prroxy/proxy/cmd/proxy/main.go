@@ -1,19 +1,37 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
 	"github.com/pismo/testing-proxy/internal/config"
 	"github.com/pismo/testing-proxy/internal/handler"
 	"github.com/pismo/testing-proxy/internal/storage"
+	"github.com/pismo/testing-proxy/internal/tracing"
 )
 
 func main() {
+	// Offline subcommands work on the recordings without a server
+	if len(os.Args) > 1 {
+		if _, ok := commands[os.Args[1]]; ok {
+			if err := runCommand(os.Args[1], os.Args[2:], os.Stdout, os.Stderr); err != nil {
+				fmt.Fprintf(os.Stderr, "proxy %s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	// ASCII Art Banner
 	fmt.Println(`
 ╔══════════════════════════════════════════════╗
@@ -21,10 +39,24 @@ func main() {
 ║         Record • Replay • Test • Win           ║
 ╚══════════════════════════════════════════════╝`)
 
-	// Load configuration
-	cfg := config.GetInstance()
+	// Load configuration: defaults, then file and environment, then flags
+	cfg := config.New()
 	if err := cfg.Load(); err != nil {
-		log.Printf("Warning: Failed to load config file: %v", err)
+		log.Printf("Warning: Failed to load config: %v", err)
+	}
+	if cfg.Path() != "" {
+		fmt.Printf("Loaded configuration from %s\n", cfg.Path())
+	}
+	cfg.RegisterFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] | %s <subcommand> [flags]\n\nFlags:\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output())
+		printCommands(flag.CommandLine.Output())
+	}
+	flag.Parse()
+	if err := cfg.ApplyFlags(flag.CommandLine); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
 
 	// Display configuration
@@ -32,32 +64,64 @@ func main() {
 	fmt.Printf("📁 Recordings directory: %s\n", cfg.Storage.Path)
 	fmt.Printf("🎯 Default mode: %s\n", cfg.Mode.Default)
 	fmt.Printf("🔒 TLS verification: %v\n", !cfg.TLS.SkipVerify)
+	if cfg.Tracing.Enabled {
+		fmt.Printf("🔭 Tracing: %s exporter\n", cfg.Tracing.Exporter)
+	}
 	fmt.Println()
 
+	// Initialize tracing (no-op unless enabled)
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
 	// Initialize storage repository
-	repository, err := storage.NewFileSystemRepository(cfg.Storage.Path)
+	fsRepository, err := storage.NewFileSystemRepository(cfg.Storage.Path)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
+	fsRepository.SetFormat(cfg.Storage.Format)
+	fsRepository.SetHistoryLimit(cfg.Storage.History)
+	fsRepository.SetDedup(cfg.Storage.Dedup)
+	repository := storage.NewTracedRepository(fsRepository)
 
 	// Display initial statistics
 	count, _ := repository.Count()
 	fmt.Printf("📊 Existing recordings: %d\n", count)
 
 	// Create handlers
-	proxyHandler := handler.NewProxyHandler(repository)
-	managementHandler := handler.NewManagementHandler(repository, proxyHandler)
+	proxyHandler := handler.NewProxyHandler(cfg, repository)
+	managementHandler := handler.NewManagementHandler(cfg, repository, proxyHandler)
 
-	// Setup HTTP routes
-	mux := http.NewServeMux()
+	// Admin authentication and audit log (proxy traffic stays open)
+	adminAuth, err := handler.NewAdminAuth(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize admin auth: %v", err)
+	}
+	defer adminAuth.Close()
+	if cfg.Admin.AuthEnabled() {
+		fmt.Printf("🔐 Admin API authentication enabled (%d tokens, %d users)\n", len(cfg.Admin.Tokens), len(cfg.Admin.Users))
+	}
 
-	// Management endpoints (must be registered first)
-	mux.HandleFunc("/admin/status", managementHandler.HandleStatus)
-	mux.HandleFunc("/admin/mode", managementHandler.HandleMode)
-	mux.HandleFunc("/admin/history", managementHandler.HandleHistory)
-	mux.HandleFunc("/admin/recordings", managementHandler.HandleRecordings)
-	mux.HandleFunc("/admin/recording", managementHandler.HandleRecording)
-	mux.HandleFunc("/admin/ui", managementHandler.HandleDashboard)
+	// Management endpoints
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("/admin/status", managementHandler.HandleStatus)
+	adminMux.HandleFunc("/admin/mode", managementHandler.HandleMode)
+	adminMux.HandleFunc("/admin/history", managementHandler.HandleHistory)
+	adminMux.HandleFunc("/admin/stream", managementHandler.HandleStream)
+	adminMux.HandleFunc("/admin/recordings", managementHandler.HandleRecordings)
+	adminMux.HandleFunc("/admin/recording", managementHandler.HandleRecording)
+	adminMux.HandleFunc("/admin/recording/history", managementHandler.HandleRecordingHistory)
+	adminMux.HandleFunc("/admin/recording/diff", managementHandler.HandleRecordingDiff)
+	adminMux.HandleFunc("/admin/recording/rollback", managementHandler.HandleRecordingRollback)
+	adminMux.HandleFunc("/admin/blob", managementHandler.HandleBlob)
+	adminMux.HandleFunc("/admin/grpc", managementHandler.HandleGRPC)
+	adminMux.HandleFunc("/admin/rewrite/preview", managementHandler.HandleRewritePreview)
+	adminMux.HandleFunc("/admin/ui", managementHandler.HandleDashboard)
+
+	// Setup HTTP routes (management endpoints must be registered first)
+	mux := http.NewServeMux()
+	mux.Handle("/admin/", adminAuth.Middleware(adminMux))
 	mux.HandleFunc("/health", managementHandler.HandleHealth)
 
 	// Proxy handles all other paths (catch-all)
@@ -67,12 +131,43 @@ func main() {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
+	// Reload mutable settings on SIGHUP or when the config file changes
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	go cfg.Watch(watchCtx, 2*time.Second, func(result config.ReloadResult) {
+		if result.Err != nil {
+			log.Printf("⚠️  Config reload (%s) rejected: %v", result.Trigger, result.Err)
+			return
+		}
+		log.Printf("🔄 Configuration reloaded (%s), mode: %s", result.Trigger, cfg.GetMode())
+		if result.ModeChanged {
+			proxyHandler.Events().Publish(handler.Event{Type: handler.EventMode, Mode: cfg.GetMode()})
+		}
+		if len(result.RestartRequired) > 0 {
+			log.Printf("⚠️  Changes to %v need a restart to take effect", result.RestartRequired)
+		}
+	})
+
 	// Start server in goroutine
 	server := &http.Server{
 		Addr:    cfg.GetAddress(),
 		Handler: loggingMiddleware(mux),
 	}
 
+	// gRPC calls arrive on their own h2c (cleartext HTTP/2) listener
+	if cfg.GRPC.Enabled {
+		grpcServer := &http.Server{
+			Addr:    cfg.GetGRPCAddress(),
+			Handler: h2c.NewHandler(http.HandlerFunc(proxyHandler.ServeGRPC), &http2.Server{}),
+		}
+		go func() {
+			fmt.Printf("🔌 gRPC (h2c) listener on %s\n", cfg.GetGRPCAddress())
+			if err := grpcServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("gRPC listener failed to start: %v", err)
+			}
+		}()
+	}
+
 	go func() {
 		fmt.Println("\n✅ Proxy server is ready!")
 		fmt.Println("📖 Documentation:")
@@ -81,9 +176,20 @@ func main() {
 		fmt.Printf("   • Health check:   http://%s/health\n", cfg.GetAddress())
 		fmt.Println("\n🎮 Management API:")
 		fmt.Printf("   • GET    /admin/status     - View status and statistics\n")
-		fmt.Printf("   • POST   /admin/mode       - Switch between record/playback\n")
+		fmt.Printf("   • POST   /admin/mode       - Switch between record/playback/hybrid\n")
+		fmt.Printf("   • GET    /admin/history    - Session history (?limit=&cursor=)\n")
+		fmt.Printf("   • GET    /admin/stream     - Live events via SSE (?target=&status=&outcome=)\n")
 		fmt.Printf("   • GET    /admin/recordings - List all recordings\n")
 		fmt.Printf("   • GET    /admin/recording?id=<id> - Get recording details\n")
+		fmt.Printf("   • PUT    /admin/recording[?id=<id>] - Create or replace a recording\n")
+		fmt.Printf("   • PATCH  /admin/recording?id=<id> - Edit a recording's response\n")
+		fmt.Printf("   • DELETE /admin/recording?id=<id> - Delete one recording\n")
+		fmt.Printf("   • GET    /admin/recording/history?id=<id> - List previous versions\n")
+		fmt.Printf("   • GET    /admin/recording/diff?id=<id>[&from=&to=] - Diff two versions\n")
+		fmt.Printf("   • POST   /admin/recording/rollback?id=<id>&version=<n> - Restore a version\n")
+		fmt.Printf("   • GET    /admin/blob?ref=<ref> - Download a body stored as a blob\n")
+		fmt.Printf("   • GET    /admin/grpc?id=<id> - Render a gRPC recording as JSON\n")
+		fmt.Printf("   • GET    /admin/rewrite/preview?id=<id> - Preview rewrite rules on a recording\n")
 		fmt.Printf("   • DELETE /admin/recordings - Clear all recordings\n")
 		fmt.Println("\n⌨️  Press Ctrl+C to stop the server")
 
@@ -99,6 +205,13 @@ func main() {
 	// Final statistics
 	finalCount, _ := repository.Count()
 	fmt.Printf("📊 Total recordings saved: %d\n", finalCount)
+
+	// Flush any spans still buffered in the exporter
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Warning: Failed to flush traces: %v", err)
+	}
 	fmt.Println("👋 Goodbye!")
 }
 
@@ -107,8 +220,21 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Skip logging for dashboard assets
 		if r.URL.Path != "/" && r.URL.Path != "/health" && r.URL.Path != "/admin/ui" {
-			log.Printf("[%s] %s %s", r.RemoteAddr, r.Method, r.URL.String())
+			log.Printf("[%s] %s %s", r.RemoteAddr, r.Method, redactedURL(r))
 		}
 		next.ServeHTTP(w, r)
 	})
+}
+
+// redactedURL returns the request URL for logging, without the value of
+// an admin access token
+func redactedURL(r *http.Request) string {
+	query := r.URL.Query()
+	if !query.Has(handler.AccessTokenParam) {
+		return r.URL.String()
+	}
+	query.Set(handler.AccessTokenParam, "redacted")
+	redacted := *r.URL
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
 }
\ No newline at end of file
@@ -0,0 +1,237 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Supported content codings
+const (
+	Identity = "identity"
+	Gzip     = "gzip"
+	Deflate  = "deflate"
+	Brotli   = "br"
+)
+
+// preference orders codings when the client weights them equally
+var preference = []string{Brotli, Gzip, Deflate}
+
+// Supported reports whether the coding can be decoded and encoded
+func Supported(encoding string) bool {
+	switch normalize(encoding) {
+	case Identity, Gzip, Deflate, Brotli:
+		return true
+	}
+	return false
+}
+
+// Decode reverses a Content-Encoding. Stacked codings ("gzip, br") are
+// undone right to left as RFC 9110 requires.
+func Decode(encoding string, body []byte) ([]byte, error) {
+	codings := strings.Split(encoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		body, err = decodeOne(normalize(codings[i]), body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// decodeOne reverses a single coding
+func decodeOne(encoding string, body []byte) ([]byte, error) {
+	reader, err := NewReader(encoding, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s body: %w", encoding, err)
+	}
+	return decoded, nil
+}
+
+// NewDecoder returns a streaming decoder for a whole Content-Encoding,
+// undoing stacked codings right to left like Decode
+func NewDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	codings := strings.Split(encoding, ",")
+	chain := &decoderChain{}
+	for i := len(codings) - 1; i >= 0; i-- {
+		decoder, err := NewReader(codings[i], r)
+		if err != nil {
+			chain.Close()
+			return nil, err
+		}
+		chain.closers = append(chain.closers, decoder)
+		r = decoder
+	}
+	chain.Reader = r
+	return chain, nil
+}
+
+// decoderChain reads from the last decoder and closes them all
+type decoderChain struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (c *decoderChain) Close() error {
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		c.closers[i].Close()
+	}
+	return nil
+}
+
+// NewReader returns a streaming decoder for a single coding
+func NewReader(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch normalize(encoding) {
+	case "", Identity:
+		return io.NopCloser(r), nil
+	case Gzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		return gz, nil
+	case Deflate:
+		// "deflate" is zlib-wrapped per the RFC, but some servers send raw
+		// deflate; peek at the header to tell them apart
+		buffered := bufio.NewReader(r)
+		header, _ := buffered.Peek(2)
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(buffered)
+		}
+		return flate.NewReader(buffered), nil
+	case Brotli:
+		return io.NopCloser(brotli.NewReader(r)), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+}
+
+// Encode applies a single Content-Encoding
+func Encode(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	writer, err := NewWriter(encoding, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(body); err != nil {
+		return nil, fmt.Errorf("failed to encode %s body: %w", encoding, err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode %s body: %w", encoding, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// NewWriter returns a streaming encoder for a single coding. Close must
+// be called to flush the trailer; it does not close w.
+func NewWriter(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch normalize(encoding) {
+	case "", Identity:
+		return nopWriteCloser{w}, nil
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Deflate:
+		return zlib.NewWriter(w), nil
+	case Brotli:
+		return brotli.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+}
+
+// nopWriteCloser adds a no-op Close to a writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// Negotiate picks the coding to send for an Accept-Encoding header.
+// The preferred coding (usually what the upstream originally used) wins
+// when the client accepts it; otherwise the highest-weighted supported
+// coding is chosen, falling back to identity.
+func Negotiate(acceptEncoding, preferred string) string {
+	if acceptEncoding == "" {
+		return Identity
+	}
+
+	weights := parseAcceptEncoding(acceptEncoding)
+	weight := func(coding string) float64 {
+		if q, ok := weights[coding]; ok {
+			return q
+		}
+		if q, ok := weights["*"]; ok {
+			return q
+		}
+		return 0
+	}
+
+	preferred = normalize(preferred)
+	if preferred != "" && preferred != Identity && Supported(preferred) && weight(preferred) > 0 {
+		return preferred
+	}
+
+	candidates := make([]string, 0, len(preference))
+	for _, coding := range preference {
+		if weight(coding) > 0 {
+			candidates = append(candidates, coding)
+		}
+	}
+	if len(candidates) == 0 {
+		return Identity
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return weight(candidates[i]) > weight(candidates[j])
+	})
+	return candidates[0]
+}
+
+// parseAcceptEncoding maps codings to their q-values
+func parseAcceptEncoding(header string) map[string]float64 {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := normalize(fields[0])
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		weights[coding] = q
+	}
+	return weights
+}
+
+// normalize lowercases a coding and maps the x-gzip alias
+func normalize(encoding string) string {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "x-gzip" {
+		return Gzip
+	}
+	return encoding
+}
@@ -0,0 +1,91 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	body := []byte(`{"users":[{"id":1,"name":"Leanne Graham"}]}`)
+
+	for _, encoding := range []string{Gzip, Deflate, Brotli, Identity} {
+		t.Run(encoding, func(t *testing.T) {
+			encoded, err := Encode(encoding, body)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			decoded, err := Decode(encoding, encoded)
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			if !bytes.Equal(decoded, body) {
+				t.Errorf("Round trip mismatch: %s", decoded)
+			}
+		})
+	}
+}
+
+func TestDecodeStacked(t *testing.T) {
+	body := []byte("hello")
+	gz, _ := Encode(Gzip, body)
+	br, _ := Encode(Brotli, gz)
+
+	decoded, err := Decode("gzip, br", br)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if string(decoded) != "hello" {
+		t.Errorf("Expected hello, got %q", decoded)
+	}
+}
+
+func TestNewDecoderStacked(t *testing.T) {
+	gz, _ := Encode(Gzip, []byte("hello"))
+	br, _ := Encode(Brotli, gz)
+
+	decoder, err := NewDecoder("gzip, br", bytes.NewReader(br))
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer decoder.Close()
+
+	decoded, err := io.ReadAll(decoder)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(decoded) != "hello" {
+		t.Errorf("Expected hello, got %q", decoded)
+	}
+}
+
+func TestDecodeUnsupported(t *testing.T) {
+	if _, err := Decode("zstd", []byte("x")); err == nil {
+		t.Error("Expected error for unsupported encoding")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept    string
+		preferred string
+		want      string
+	}{
+		{"", "gzip", Identity},
+		{"gzip, deflate, br", "gzip", Gzip},
+		{"gzip, deflate, br", "br", Brotli},
+		{"gzip", "br", Gzip},
+		{"br;q=0.5, gzip;q=0.8", "", Gzip},
+		{"gzip;q=0", "gzip", Identity},
+		{"*", "deflate", Deflate},
+		{"identity", "gzip", Identity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept+"/"+tt.preferred, func(t *testing.T) {
+			if got := Negotiate(tt.accept, tt.preferred); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -5,10 +5,16 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	"gopkg.in/yaml.v2"
+
+	"github.com/pismo/testing-proxy/internal/rewrite"
 )
 
 // Config holds the application configuration
@@ -17,7 +23,35 @@ type Config struct {
 	Storage  StorageConfig  `json:"storage" yaml:"storage"`
 	Mode     ModeConfig     `json:"mode" yaml:"mode"`
 	TLS      TLSConfig      `json:"tls" yaml:"tls"`
-	mu       sync.RWMutex   // For thread-safe mode changes
+	Tracing  TracingConfig  `json:"tracing" yaml:"tracing"`
+	Admin    AdminConfig    `json:"admin" yaml:"admin"`
+	Playback PlaybackConfig `json:"playback" yaml:"playback"`
+	GRPC     GRPCConfig     `json:"grpc" yaml:"grpc"`
+
+	// Upstreams holds per-target client settings keyed by target host
+	// (optionally host:port); targets without an entry use the defaults
+	Upstreams map[string]UpstreamConfig `json:"upstreams" yaml:"upstreams"`
+
+	path          string            // Config file in use, for reloads
+	flagOverrides map[string]string // Explicitly set command line flags
+	mu            sync.RWMutex      // For thread-safe mode changes and reloads
+}
+
+// PlaybackConfig contains playback settings
+type PlaybackConfig struct {
+	// TimingScale multiplies the recorded gaps between streamed chunks:
+	// 1 replays the original timing, 0.5 twice as fast, 0 without delays
+	TimingScale float64 `json:"timing_scale" yaml:"timing_scale"`
+}
+
+// GRPCConfig contains settings for the gRPC (h2c) listener. gRPC clients
+// can't add a ?target= parameter, so calls go to Target unless they carry
+// an X-Proxy-Target header.
+type GRPCConfig struct {
+	Enabled       bool   `json:"enabled" yaml:"enabled"`
+	Port          string `json:"port" yaml:"port"`
+	Target        string `json:"target" yaml:"target"`                 // e.g. "http://localhost:50051" (http = h2c)
+	DescriptorSet string `json:"descriptor_set" yaml:"descriptor_set"` // protoc --descriptor_set_out file for JSON rendering
 }
 
 // ServerConfig contains server settings
@@ -28,8 +62,23 @@ type ServerConfig struct {
 
 // StorageConfig contains storage settings
 type StorageConfig struct {
-	Type string `json:"type" yaml:"type"`
-	Path string `json:"path" yaml:"path"`
+	Type          string `json:"type" yaml:"type"`
+	Path          string `json:"path" yaml:"path"`
+	BlobThreshold int64  `json:"blob_threshold" yaml:"blob_threshold"` // Bodies larger than this (bytes) are stored as blob files
+	Format        string `json:"format" yaml:"format"`                 // "json" (default) or "readable" for reviewable fixture diffs
+	History       int    `json:"history" yaml:"history"`               // Previous versions kept per recording, 0 disables
+	Dedup         bool   `json:"dedup" yaml:"dedup"`                   // Store response bodies once in the blob store, shared by recordings
+}
+
+// DefaultBlobThreshold is used when storage sets no blob threshold
+const DefaultBlobThreshold = 1 << 20 // 1 MiB
+
+// BlobThresholdBytes returns the configured threshold, or the default
+func (s StorageConfig) BlobThresholdBytes() int64 {
+	if s.BlobThreshold <= 0 {
+		return DefaultBlobThreshold
+	}
+	return s.BlobThreshold
 }
 
 // ModeConfig contains mode settings
@@ -43,85 +92,243 @@ type TLSConfig struct {
 	SkipVerify bool `json:"skip_verify" yaml:"skip_verify"`
 }
 
-// singleton instance
-var (
-	instance *Config
-	once     sync.Once
-)
+// UpstreamConfig contains HTTP client and matching settings for one
+// upstream target
+type UpstreamConfig struct {
+	SkipVerify      *bool             `json:"skip_verify" yaml:"skip_verify"`           // Defaults to tls.skip_verify
+	CAFile          string            `json:"ca_file" yaml:"ca_file"`                   // Extra CA bundle (PEM)
+	CertFile        string            `json:"cert_file" yaml:"cert_file"`               // Client certificate for mTLS
+	KeyFile         string            `json:"key_file" yaml:"key_file"`                 // Client key for mTLS
+	Timeout         string            `json:"timeout" yaml:"timeout"`                   // e.g. "10s", defaults to 30s
+	Proxy           string            `json:"proxy" yaml:"proxy"`                       // Upstream HTTP proxy URL
+	MaxIdleConns    int               `json:"max_idle_conns" yaml:"max_idle_conns"`     // Per host, 0 uses Go's default
+	InjectHeaders   map[string]string `json:"inject_headers" yaml:"inject_headers"`     // Set on every upstream request
+	StripHeaders    []string          `json:"strip_headers" yaml:"strip_headers"`       // Removed before forwarding
+	GraphQL         bool              `json:"graphql" yaml:"graphql"`                   // Match POST bodies as GraphQL operations
+	MultipartIgnore []string          `json:"multipart_ignore" yaml:"multipart_ignore"` // Form parts left out of matching, e.g. "nonce" or "meta_*"
+	TTL             string            `json:"ttl" yaml:"ttl"`                           // e.g. "1h"; older recordings are stale, re-recorded in hybrid mode
+	Rewrite         []rewrite.Rule    `json:"rewrite" yaml:"rewrite"`                   // Response header and body replacements
+}
+
+// DefaultUpstreamTimeout is used when an upstream sets no timeout
+const DefaultUpstreamTimeout = 30 * time.Second
 
-// GetInstance returns the singleton configuration instance
-func GetInstance() *Config {
-	once.Do(func() {
-		instance = &Config{
-			// Default values
-			Server: ServerConfig{
-				Port: "8099",
-				Host: "0.0.0.0",
-			},
-			Storage: StorageConfig{
-				Type: "filesystem",
-				Path: "./recordings",
-			},
-			Mode: ModeConfig{
-				Default: "playback",
-				current: "playback",
-			},
-			TLS: TLSConfig{
-				SkipVerify: true,
-			},
+// TimeoutDuration returns the parsed timeout, or the default
+func (u UpstreamConfig) TimeoutDuration() time.Duration {
+	if u.Timeout == "" {
+		return DefaultUpstreamTimeout
+	}
+	timeout, err := time.ParseDuration(u.Timeout)
+	if err != nil {
+		return DefaultUpstreamTimeout
+	}
+	return timeout
+}
+
+// TTLDuration returns how long recordings stay fresh, or 0 for forever
+func (u UpstreamConfig) TTLDuration() time.Duration {
+	ttl, err := time.ParseDuration(u.TTL)
+	if err != nil || ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+// validate checks the upstream settings, including that files exist
+func (u UpstreamConfig) validate() error {
+	if u.Timeout != "" {
+		if timeout, err := time.ParseDuration(u.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid timeout: %s", u.Timeout)
 		}
-	})
-	return instance
+	}
+	if u.TTL != "" {
+		if ttl, err := time.ParseDuration(u.TTL); err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid ttl: %s", u.TTL)
+		}
+	}
+	if u.Proxy != "" {
+		if _, err := url.Parse(u.Proxy); err != nil {
+			return fmt.Errorf("invalid proxy URL: %w", err)
+		}
+	}
+	if (u.CertFile == "") != (u.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+	for _, file := range []string{u.CAFile, u.CertFile, u.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("cannot read %s: %w", file, err)
+		}
+	}
+	if u.MaxIdleConns < 0 {
+		return fmt.Errorf("max_idle_conns cannot be negative")
+	}
+	for i, rule := range u.Rewrite {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("rewrite rule %d: %w", i+1, err)
+		}
+	}
+	return nil
 }
 
-// Load loads configuration from various sources
-func (c *Config) Load() error {
-	// 1. Load from config file if exists
-	if err := c.loadFromFile(); err == nil {
-		fmt.Println("Loaded configuration from file")
+// TracingConfig contains OpenTelemetry tracing settings
+type TracingConfig struct {
+	Enabled     bool    `json:"enabled" yaml:"enabled"`
+	Exporter    string  `json:"exporter" yaml:"exporter"` // "otlp" or "file"
+	Endpoint    string  `json:"endpoint" yaml:"endpoint"` // OTLP/HTTP collector host:port
+	Insecure    bool    `json:"insecure" yaml:"insecure"` // Plain HTTP to the collector
+	FilePath    string  `json:"file_path" yaml:"file_path"`
+	ServiceName string  `json:"service_name" yaml:"service_name"`
+	SampleRatio float64 `json:"sample_ratio" yaml:"sample_ratio"`
+}
+
+// AdminConfig contains management API access settings.
+// Authentication is enabled when at least one token or user is configured.
+type AdminConfig struct {
+	Tokens   []AdminToken `json:"tokens" yaml:"tokens"`
+	Users    []AdminUser  `json:"users" yaml:"users"`
+	AuditLog string       `json:"audit_log" yaml:"audit_log"` // File for mutating calls, empty logs to stdout
+}
+
+// AdminToken is a static bearer token
+type AdminToken struct {
+	Name  string `json:"name" yaml:"name"`
+	Token string `json:"token" yaml:"token"`
+	Role  string `json:"role" yaml:"role"` // "read" or "write"
+}
+
+// AdminUser is a basic auth credential
+type AdminUser struct {
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	Role     string `json:"role" yaml:"role"` // "read" or "write"
+}
+
+// AuthEnabled reports whether admin credentials are configured
+func (a AdminConfig) AuthEnabled() bool {
+	return len(a.Tokens) > 0 || len(a.Users) > 0
+}
+
+// New returns a configuration populated with default values.
+// Each proxy instance owns its own Config, so several can run side by
+// side (e.g. in one test binary).
+func New() *Config {
+	return &Config{
+		// Default values
+		Server: ServerConfig{
+			Port: "8099",
+			Host: "0.0.0.0",
+		},
+		Storage: StorageConfig{
+			Type:          "filesystem",
+			Path:          "./recordings",
+			BlobThreshold: DefaultBlobThreshold,
+			History:       5,
+		},
+		Mode: ModeConfig{
+			Default: "playback",
+			current: "playback",
+		},
+		TLS: TLSConfig{
+			SkipVerify: true,
+		},
+		Tracing: TracingConfig{
+			Enabled:     false,
+			Exporter:    "otlp",
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			FilePath:    "./traces.jsonl",
+			ServiceName: "testing-proxy",
+			SampleRatio: 1.0,
+		},
+		Playback: PlaybackConfig{
+			TimingScale: 1.0,
+		},
+		GRPC: GRPCConfig{
+			Enabled: false,
+			Port:    "8098",
+		},
 	}
+}
+
+// Load loads configuration from the config file and environment.
+// Command line flags are applied separately with RegisterFlags/ApplyFlags
+// so that loading never touches the global flag set.
+func (c *Config) Load() error {
+	// 1. Load from config file if exists (Path reports which)
+	c.loadFromFile()
 
 	// 2. Override with environment variables
 	c.loadFromEnv()
 
-	// 3. Override with command line flags
-	c.loadFromFlags()
+	// 3. Re-apply command line overrides (no-op on first load)
+	c.applyFlagOverrides()
 
 	// Set initial current mode
 	c.Mode.current = c.Mode.Default
 
-	return nil
+	return c.Validate()
+}
+
+// LoadFile loads configuration from a specific file, then the environment
+func (c *Config) LoadFile(path string) error {
+	if err := c.loadFile(path); err != nil {
+		return err
+	}
+	c.loadFromEnv()
+	c.applyFlagOverrides()
+	c.Mode.current = c.Mode.Default
+	return c.Validate()
+}
+
+// Path returns the config file the configuration was loaded from, if any
+func (c *Config) Path() string {
+	return c.path
 }
 
 // loadFromFile attempts to load configuration from a file
 func (c *Config) loadFromFile() error {
+	if c.path != "" {
+		return c.loadFile(c.path)
+	}
+
 	// Try different config file names
 	configFiles := []string{"proxy.yaml", "proxy.yml", "proxy.json", "config.yaml", "config.json"}
 
 	for _, filename := range configFiles {
-		file, err := os.Open(filename)
-		if err != nil {
-			continue
+		if err := c.loadFile(filename); err == nil {
+			return nil
 		}
-		defer file.Close()
+	}
 
-		data, err := io.ReadAll(file)
-		if err != nil {
-			continue
-		}
+	return fmt.Errorf("no valid configuration file found")
+}
 
-		// Try to parse as YAML first (works for both YAML and JSON)
-		if err := yaml.Unmarshal(data, c); err == nil {
-			return nil
-		}
+// loadFile parses a single YAML or JSON config file into c
+func (c *Config) loadFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
 
+	// Try to parse as YAML first (works for both YAML and JSON)
+	if err := yaml.Unmarshal(data, c); err != nil {
 		// Try JSON if YAML fails
-		if err := json.Unmarshal(data, c); err == nil {
-			return nil
+		if err := json.Unmarshal(data, c); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", filename, err)
 		}
 	}
 
-	return fmt.Errorf("no valid configuration file found")
+	c.path = filename
+	return nil
 }
 
 // loadFromEnv loads configuration from environment variables
@@ -141,23 +348,298 @@ func (c *Config) loadFromEnv() {
 	if skipVerify := os.Getenv("PROXY_TLS_SKIP_VERIFY"); skipVerify == "false" {
 		c.TLS.SkipVerify = false
 	}
+	if enabled := os.Getenv("PROXY_TRACING_ENABLED"); enabled == "true" {
+		c.Tracing.Enabled = true
+	}
+	if exporter := os.Getenv("PROXY_TRACING_EXPORTER"); exporter != "" {
+		c.Tracing.Exporter = exporter
+	}
+	if endpoint := os.Getenv("PROXY_TRACING_ENDPOINT"); endpoint != "" {
+		c.Tracing.Endpoint = endpoint
+	}
+	if path := os.Getenv("PROXY_TRACING_FILE"); path != "" {
+		c.Tracing.FilePath = path
+	}
+	if token := os.Getenv("PROXY_ADMIN_TOKEN"); token != "" {
+		c.Admin.Tokens = append(c.Admin.Tokens, AdminToken{Name: "env", Token: token, Role: "write"})
+	}
+	if token := os.Getenv("PROXY_ADMIN_READ_TOKEN"); token != "" {
+		c.Admin.Tokens = append(c.Admin.Tokens, AdminToken{Name: "env-read", Token: token, Role: "read"})
+	}
+	if path := os.Getenv("PROXY_AUDIT_LOG"); path != "" {
+		c.Admin.AuditLog = path
+	}
+	if enabled := os.Getenv("PROXY_GRPC_ENABLED"); enabled == "true" {
+		c.GRPC.Enabled = true
+	}
+	if port := os.Getenv("PROXY_GRPC_PORT"); port != "" {
+		c.GRPC.Port = port
+	}
+	if target := os.Getenv("PROXY_GRPC_TARGET"); target != "" {
+		c.GRPC.Target = target
+	}
+	if scale := os.Getenv("PROXY_PLAYBACK_TIMING_SCALE"); scale != "" {
+		if value, err := strconv.ParseFloat(scale, 64); err == nil {
+			c.Playback.TimingScale = value
+		}
+	}
 }
 
-// loadFromFlags loads configuration from command line flags
-func (c *Config) loadFromFlags() {
-	port := flag.String("port", c.Server.Port, "Server port")
-	host := flag.String("host", c.Server.Host, "Server host")
-	recordingsDir := flag.String("recordings-dir", c.Storage.Path, "Recordings directory")
-	mode := flag.String("mode", c.Mode.Default, "Default mode (record/playback)")
-	skipVerify := flag.Bool("skip-verify", c.TLS.SkipVerify, "Skip TLS verification")
+// RegisterFlags defines the command line flags on fs, using the
+// currently loaded values as defaults
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.String("config", c.path, "Config file (YAML or JSON)")
+	fs.String("port", c.Server.Port, "Server port")
+	fs.String("host", c.Server.Host, "Server host")
+	fs.String("recordings-dir", c.Storage.Path, "Recordings directory")
+	fs.String("mode", c.Mode.Default, "Default mode (record/playback/hybrid)")
+	fs.Bool("skip-verify", c.TLS.SkipVerify, "Skip TLS verification")
+	fs.Bool("tracing", c.Tracing.Enabled, "Enable OpenTelemetry tracing")
+	fs.String("tracing-exporter", c.Tracing.Exporter, "Trace exporter (otlp/file)")
+}
 
-	flag.Parse()
+// ApplyFlags applies the flags explicitly set on a parsed fs. They are
+// remembered so that they keep precedence over the file on reload.
+func (c *Config) ApplyFlags(fs *flag.FlagSet) error {
+	overrides := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		overrides[f.Name] = f.Value.String()
+	})
+
+	// A different config file means loading it before the other overrides
+	if path, ok := overrides["config"]; ok && path != c.path {
+		next := New()
+		if err := next.loadFile(path); err != nil {
+			return err
+		}
+		next.loadFromEnv()
+		c.copySettings(next)
+	}
+
+	c.flagOverrides = overrides
+	c.applyFlagOverrides()
+	c.Mode.current = c.Mode.Default
+
+	return c.Validate()
+}
+
+// copySettings replaces every section of c with those of other
+func (c *Config) copySettings(other *Config) {
+	c.Server = other.Server
+	c.Storage = other.Storage
+	c.Mode.Default = other.Mode.Default
+	c.TLS = other.TLS
+	c.Tracing = other.Tracing
+	c.Admin = other.Admin
+	c.Playback = other.Playback
+	c.GRPC = other.GRPC
+	c.Upstreams = other.Upstreams
+	c.path = other.path
+}
+
+// applyFlagOverrides re-applies remembered command line flags
+func (c *Config) applyFlagOverrides() {
+	for name, value := range c.flagOverrides {
+		switch name {
+		case "port":
+			c.Server.Port = value
+		case "host":
+			c.Server.Host = value
+		case "recordings-dir":
+			c.Storage.Path = value
+		case "mode":
+			c.Mode.Default = value
+		case "skip-verify":
+			c.TLS.SkipVerify = value == "true"
+		case "tracing":
+			c.Tracing.Enabled = value == "true"
+		case "tracing-exporter":
+			c.Tracing.Exporter = value
+		}
+	}
+}
+
+// Validate checks that the configuration is usable
+func (c *Config) Validate() error {
+	if c.Server.Port == "" {
+		return fmt.Errorf("server port is required")
+	}
+	if c.Storage.Path == "" {
+		return fmt.Errorf("storage path is required")
+	}
+	if c.Storage.BlobThreshold < 0 {
+		return fmt.Errorf("storage.blob_threshold must not be negative")
+	}
+	if c.Storage.Format != "" && c.Storage.Format != "json" && c.Storage.Format != "readable" {
+		return fmt.Errorf("storage.format must be json or readable, got %q", c.Storage.Format)
+	}
+	if c.Storage.History < 0 {
+		return fmt.Errorf("storage.history must not be negative")
+	}
+	if c.GRPC.Enabled && c.GRPC.Port == "" {
+		return fmt.Errorf("grpc.port is required when grpc is enabled")
+	}
+	if c.Playback.TimingScale < 0 {
+		return fmt.Errorf("playback.timing_scale must not be negative")
+	}
+	if err := validateMode(c.Mode.Default); err != nil {
+		return fmt.Errorf("mode.default: %w", err)
+	}
+	if c.Tracing.Enabled {
+		if c.Tracing.Exporter != "otlp" && c.Tracing.Exporter != "file" {
+			return fmt.Errorf("unknown tracing exporter: %s (must be 'otlp' or 'file')", c.Tracing.Exporter)
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			return fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+		}
+	}
+	for _, token := range c.Admin.Tokens {
+		if token.Token == "" {
+			return fmt.Errorf("admin token %q has no value", token.Name)
+		}
+		if err := validateRole(token.Role); err != nil {
+			return fmt.Errorf("admin token %q: %w", token.Name, err)
+		}
+	}
+	for target, upstream := range c.Upstreams {
+		if err := upstream.validate(); err != nil {
+			return fmt.Errorf("upstream %q: %w", target, err)
+		}
+	}
+	for _, user := range c.Admin.Users {
+		if user.Username == "" || user.Password == "" {
+			return fmt.Errorf("admin users need a username and password")
+		}
+		if err := validateRole(user.Role); err != nil {
+			return fmt.Errorf("admin user %q: %w", user.Username, err)
+		}
+	}
+	return nil
+}
+
+// validateMode checks a proxy mode name
+func validateMode(mode string) error {
+	if mode != "record" && mode != "playback" && mode != "hybrid" {
+		return fmt.Errorf("invalid mode: %s (must be 'record', 'playback' or 'hybrid')", mode)
+	}
+	return nil
+}
+
+// validateRole checks an admin role name
+func validateRole(role string) error {
+	if role != "read" && role != "write" {
+		return fmt.Errorf("invalid role: %s (must be 'read' or 'write')", role)
+	}
+	return nil
+}
+
+// Reload re-reads the config file and environment, validates the result
+// and swaps in the mutable settings (mode, TLS, upstreams, admin
+// credentials).
+// Settings that need a restart (server address, storage, tracing) are
+// left untouched and reported in the returned list.
+func (c *Config) Reload() ([]string, error) {
+	next := New()
+	next.path = c.path
+	next.flagOverrides = c.flagOverrides
+	if c.path != "" {
+		if err := next.loadFile(c.path); err != nil {
+			return nil, err
+		}
+	}
+	next.loadFromEnv()
+	next.applyFlagOverrides()
+
+	if err := next.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration, keeping current settings: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var restartRequired []string
+	if next.Server != c.Server {
+		restartRequired = append(restartRequired, "server")
+	}
+	if next.Storage != c.Storage {
+		restartRequired = append(restartRequired, "storage")
+	}
+	if next.Tracing != c.Tracing {
+		restartRequired = append(restartRequired, "tracing")
+	}
+	if next.GRPC.Enabled != c.GRPC.Enabled || next.GRPC.Port != c.GRPC.Port {
+		restartRequired = append(restartRequired, "grpc")
+	}
+
+	// A changed default mode takes effect immediately; otherwise a mode
+	// switched at runtime through the admin API is kept
+	if next.Mode.Default != c.Mode.Default {
+		c.Mode.Default = next.Mode.Default
+		c.Mode.current = next.Mode.Default
+	}
+	c.TLS = next.TLS
+	c.Admin = next.Admin
+	c.Playback = next.Playback
+	c.GRPC.Target = next.GRPC.Target
+	c.GRPC.DescriptorSet = next.GRPC.DescriptorSet
+	c.Upstreams = next.Upstreams
+
+	return restartRequired, nil
+}
+
+// TLSSettings returns the current TLS settings
+func (c *Config) TLSSettings() TLSConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.TLS
+}
+
+// UpstreamFor returns the client settings for a target host. Lookup tries
+// host:port first, then the bare host; unset TLS verification falls back
+// to tls.skip_verify.
+func (c *Config) UpstreamFor(host string) UpstreamConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	upstream, ok := c.Upstreams[host]
+	if !ok {
+		if bare, _, err := net.SplitHostPort(host); err == nil {
+			upstream = c.Upstreams[bare]
+		}
+	}
+
+	if upstream.SkipVerify == nil {
+		skipVerify := c.TLS.SkipVerify
+		upstream.SkipVerify = &skipVerify
+	}
+
+	return upstream
+}
+
+// AdminSettings returns the current admin access settings
+func (c *Config) AdminSettings() AdminConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Admin
+}
+
+// PlaybackSettings returns the current playback settings
+func (c *Config) PlaybackSettings() PlaybackConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Playback
+}
+
+// GRPCSettings returns the current gRPC listener settings
+func (c *Config) GRPCSettings() GRPCConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.GRPC
+}
 
-	c.Server.Port = *port
-	c.Server.Host = *host
-	c.Storage.Path = *recordingsDir
-	c.Mode.Default = *mode
-	c.TLS.SkipVerify = *skipVerify
+// GetGRPCAddress returns the gRPC listener address
+func (c *Config) GetGRPCAddress() string {
+	return fmt.Sprintf("%s:%s", c.Server.Host, c.GRPC.Port)
 }
 
 // GetMode returns the current mode
@@ -169,8 +651,8 @@ func (c *Config) GetMode() string {
 
 // SetMode sets the current mode
 func (c *Config) SetMode(mode string) error {
-	if mode != "record" && mode != "playback" {
-		return fmt.Errorf("invalid mode: %s (must be 'record' or 'playback')", mode)
+	if err := validateMode(mode); err != nil {
+		return err
 	}
 
 	c.mu.Lock()
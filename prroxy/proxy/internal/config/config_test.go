@@ -0,0 +1,199 @@
+package config
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pismo/testing-proxy/internal/rewrite"
+)
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+}
+
+func TestIndependentInstances(t *testing.T) {
+	a, b := New(), New()
+
+	if err := a.SetMode("record"); err != nil {
+		t.Fatalf("Failed to set mode: %v", err)
+	}
+
+	if b.GetMode() != "playback" {
+		t.Errorf("Mode leaked between instances: %s", b.GetMode())
+	}
+}
+
+func TestLoadFileAndFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.yaml")
+	writeConfig(t, path, "server:\n  port: \"9000\"\nmode:\n  default: record\n")
+
+	cfg := New()
+	if err := cfg.LoadFile(path); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if cfg.Server.Port != "9000" || cfg.GetMode() != "record" {
+		t.Fatalf("File values not applied: port=%s mode=%s", cfg.Server.Port, cfg.GetMode())
+	}
+
+	// Flags use their own FlagSet, never the global one
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+	if err := fs.Parse([]string{"-port", "9100"}); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+	if err := cfg.ApplyFlags(fs); err != nil {
+		t.Fatalf("Failed to apply flags: %v", err)
+	}
+	if cfg.Server.Port != "9100" {
+		t.Errorf("Expected flag to override port, got %s", cfg.Server.Port)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.yaml")
+	writeConfig(t, path, "mode:\n  default: playback\ntls:\n  skip_verify: true\n")
+
+	cfg := New()
+	if err := cfg.LoadFile(path); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	t.Run("Applies mutable settings", func(t *testing.T) {
+		writeConfig(t, path, "mode:\n  default: record\ntls:\n  skip_verify: false\n")
+
+		restart, err := cfg.Reload()
+		if err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+		if len(restart) != 0 {
+			t.Errorf("Expected no restart-only changes, got %v", restart)
+		}
+		if cfg.GetMode() != "record" {
+			t.Errorf("Expected mode record, got %s", cfg.GetMode())
+		}
+		if cfg.TLSSettings().SkipVerify {
+			t.Error("Expected TLS verification to be enabled")
+		}
+	})
+
+	t.Run("Keeps runtime mode when default unchanged", func(t *testing.T) {
+		cfg.SetMode("playback")
+
+		if _, err := cfg.Reload(); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+		if cfg.GetMode() != "playback" {
+			t.Errorf("Runtime mode was reset to %s", cfg.GetMode())
+		}
+	})
+
+	t.Run("Rejects invalid config", func(t *testing.T) {
+		writeConfig(t, path, "mode:\n  default: sideways\n")
+
+		if _, err := cfg.Reload(); err == nil {
+			t.Fatal("Expected invalid config to be rejected")
+		}
+		if cfg.Mode.Default != "record" {
+			t.Errorf("Invalid reload changed settings: %s", cfg.Mode.Default)
+		}
+	})
+
+	t.Run("Reports restart-only changes", func(t *testing.T) {
+		writeConfig(t, path, "server:\n  port: \"9999\"\nmode:\n  default: record\n")
+
+		restart, err := cfg.Reload()
+		if err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+		if len(restart) != 1 || restart[0] != "server" {
+			t.Errorf("Expected server to need a restart, got %v", restart)
+		}
+		if cfg.Server.Port == "9999" {
+			t.Error("Server port must not change without a restart")
+		}
+	})
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.yaml")
+	writeConfig(t, path, "mode:\n  default: playback\n")
+
+	cfg := New()
+	if err := cfg.LoadFile(path); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	results := make(chan ReloadResult)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cfg.Watch(ctx, 10*time.Millisecond, func(result ReloadResult) {
+		results <- result
+	})
+
+	modified := time.Now()
+	change := func(content string) ReloadResult {
+		t.Helper()
+		writeConfig(t, path, content)
+		// Touch the file until the watcher, which may still be starting,
+		// sees a new modification time
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			modified = modified.Add(time.Second)
+			os.Chtimes(path, modified, modified)
+			select {
+			case result := <-results:
+				if result.Err != nil {
+					t.Fatalf("Reload failed: %v", result.Err)
+				}
+				return result
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+		t.Fatal("Expected a reload")
+		return ReloadResult{}
+	}
+
+	if result := change("mode:\n  default: playback\ntls:\n  skip_verify: false\n"); result.ModeChanged {
+		t.Errorf("Expected no mode change when only tls changed")
+	}
+	if result := change("mode:\n  default: record\n"); !result.ModeChanged || cfg.GetMode() != "record" {
+		t.Errorf("Expected a mode change to record, got %+v (%s)", result, cfg.GetMode())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := New()
+	cfg.Admin.Tokens = []AdminToken{{Name: "bad", Token: "x", Role: "admin"}}
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for invalid admin role")
+	}
+
+	cfg = New()
+	cfg.Playback.TimingScale = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative timing scale")
+	}
+
+	cfg = New()
+	cfg.Upstreams = map[string]UpstreamConfig{"api.example.com": {TTL: "soon"}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for invalid ttl")
+	}
+
+	cfg = New()
+	cfg.Upstreams = map[string]UpstreamConfig{"api.example.com": {Rewrite: []rewrite.Rule{{Match: "("}}}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for invalid rewrite rule")
+	}
+
+	if err := New().SetMode("hybrid"); err != nil {
+		t.Errorf("Expected hybrid to be a valid mode: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ReloadResult describes the outcome of a configuration reload
+type ReloadResult struct {
+	Trigger         string   // "signal" or "file"
+	RestartRequired []string // Changed sections that only apply after a restart
+	ModeChanged     bool     // The reload switched the current mode
+	Err             error
+}
+
+// Watch reloads the configuration on SIGHUP and whenever the config file
+// changes (polled every interval; 0 disables polling). Each attempt is
+// reported through onReload. Watch returns when ctx is cancelled.
+func (c *Config) Watch(ctx context.Context, interval time.Duration, onReload func(ReloadResult)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var ticks <-chan time.Time
+	if interval > 0 && c.path != "" {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	lastModified := c.modTime()
+
+	reload := func(trigger string) {
+		mode := c.GetMode()
+		restartRequired, err := c.Reload()
+		if onReload != nil {
+			onReload(ReloadResult{
+				Trigger:         trigger,
+				RestartRequired: restartRequired,
+				ModeChanged:     err == nil && c.GetMode() != mode,
+				Err:             err,
+			})
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-hup:
+			lastModified = c.modTime()
+			reload("signal")
+
+		case <-ticks:
+			modified := c.modTime()
+			if modified.Equal(lastModified) {
+				continue
+			}
+			lastModified = modified
+			reload("file")
+		}
+	}
+}
+
+// modTime returns the config file's modification time, zero if unknown
+func (c *Config) modTime() time.Time {
+	if c.path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
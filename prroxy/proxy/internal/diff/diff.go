@@ -0,0 +1,165 @@
+// Package diff compares texts line by line and renders unified diffs
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is what happens to a line going from the old text to the new one
+type Op byte
+
+// Edit operations, printed as the unified diff line prefix
+const (
+	Equal  Op = ' '
+	Delete Op = '-'
+	Insert Op = '+'
+)
+
+// Line is one line of an edit script
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// maxCells bounds the LCS table; bigger changes are shown as a block
+// replacement rather than a minimal diff
+const maxCells = 4_000_000
+
+// Lines returns an edit script turning a into b, based on their longest
+// common subsequence
+func Lines(a, b []string) []Line {
+	// Common prefix and suffix need no table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var script []Line
+	for _, text := range a[:prefix] {
+		script = append(script, Line{Equal, text})
+	}
+	script = append(script, middle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, text := range a[len(a)-suffix:] {
+		script = append(script, Line{Equal, text})
+	}
+	return script
+}
+
+// middle diffs the part between the common prefix and suffix
+func middle(a, b []string) []Line {
+	var script []Line
+	if len(a)*len(b) > maxCells {
+		for _, text := range a {
+			script = append(script, Line{Delete, text})
+		}
+		for _, text := range b {
+			script = append(script, Line{Insert, text})
+		}
+		return script
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			script = append(script, Line{Equal, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			script = append(script, Line{Delete, a[i]})
+			i++
+		default:
+			script = append(script, Line{Insert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		script = append(script, Line{Delete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		script = append(script, Line{Insert, b[j]})
+	}
+	return script
+}
+
+// Unified renders the changes from a to b as a unified diff with the
+// given number of context lines. It returns "" when the texts are equal.
+func Unified(fromName, toName, a, b string, context int) string {
+	script := Lines(split(a), split(b))
+
+	// Line numbers in a and b before each script entry
+	aLine := make([]int, len(script)+1)
+	bLine := make([]int, len(script)+1)
+	var changes []int
+	for i, line := range script {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if line.Op != Insert {
+			aLine[i+1]++
+		}
+		if line.Op != Delete {
+			bLine[i+1]++
+		}
+		if line.Op != Equal {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for len(changes) > 0 {
+		// Changes closer than two contexts apart share a hunk
+		last := 0
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*context+1 {
+			last++
+		}
+		start := max(changes[0]-context, 0)
+		end := min(changes[last]+context+1, len(script))
+		changes = changes[last+1:]
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aLine[start], aLine[end]), hunkRange(bLine[start], bLine[end]))
+		for _, line := range script[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", line.Op, line.Text)
+		}
+	}
+	return out.String()
+}
+
+// hunkRange formats a hunk's start line and length
+func hunkRange(from, to int) string {
+	if to == from {
+		return fmt.Sprintf("%d,0", from)
+	}
+	return fmt.Sprintf("%d,%d", from+1, to-from)
+}
+
+func split(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,60 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{
+			name: "equal",
+			a:    "one\ntwo\n",
+			b:    "one\ntwo\n",
+			want: "",
+		},
+		{
+			name: "changed line with context",
+			a:    "1\n2\n3\n4\n5\n6\n7\n",
+			b:    "1\n2\n3\nfour\n5\n6\n7\n",
+			want: "--- a\n+++ b\n@@ -2,5 +2,5 @@\n 2\n 3\n-4\n+four\n 5\n 6\n",
+		},
+		{
+			name: "distant changes get separate hunks",
+			a:    "a\n1\n2\n3\n4\n5\n6\nb\n",
+			b:    "A\n1\n2\n3\n4\n5\n6\nB\n",
+			want: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n-a\n+A\n 1\n 2\n@@ -6,3 +6,3 @@\n 5\n 6\n-b\n+B\n",
+		},
+		{
+			name: "insert into empty",
+			a:    "",
+			b:    "new\n",
+			want: "--- a\n+++ b\n@@ -0,0 +1,1 @@\n+new\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("a", "b", tt.a, tt.b, 2); got != tt.want {
+				t.Errorf("Unexpected diff:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLines(t *testing.T) {
+	script := Lines(strings.Split("a b c d", " "), strings.Split("a c d e", " "))
+
+	var got []string
+	for _, line := range script {
+		got = append(got, string(line.Op)+line.Text)
+	}
+	if want := " a -b  c  d +e"; strings.Join(got, " ") != want {
+		t.Errorf("Expected %q, got %q", want, strings.Join(got, " "))
+	}
+}
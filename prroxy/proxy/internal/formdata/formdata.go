@@ -0,0 +1,80 @@
+// Package formdata breaks multipart/form-data bodies into parts so uploads
+// can be matched without the random boundary getting in the way.
+package formdata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"path"
+)
+
+// Part describes one form field or file; the content itself is only
+// kept as a hash
+type Part struct {
+	Name        string `json:"name"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Hash        string `json:"hash"` // SHA-256 of the content
+	Size        int64  `json:"size"`
+
+	// Ignored parts are left out of request matching
+	Ignored bool `json:"ignored,omitempty"`
+}
+
+// Boundary returns the boundary of a multipart/form-data Content-Type,
+// or "" for any other type
+func Boundary(contentType string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" {
+		return ""
+	}
+	return params["boundary"]
+}
+
+// Parse reads a multipart body, hashing each part as it streams past
+func Parse(boundary string, r io.Reader) ([]Part, error) {
+	reader := multipart.NewReader(r, boundary)
+
+	parts := []Part{}
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read multipart body: %w", err)
+		}
+
+		h := sha256.New()
+		size, err := io.Copy(h, p)
+		p.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read part %q: %w", p.FormName(), err)
+		}
+
+		parts = append(parts, Part{
+			Name:        p.FormName(),
+			Filename:    p.FileName(),
+			ContentType: p.Header.Get("Content-Type"),
+			Hash:        hex.EncodeToString(h.Sum(nil)),
+			Size:        size,
+		})
+	}
+}
+
+// Ignore marks the parts whose name matches one of the patterns
+// (path.Match syntax, e.g. "meta_*")
+func Ignore(parts []Part, patterns []string) {
+	for i := range parts {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, parts[i].Name); matched {
+				parts[i].Ignored = true
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package formdata
+
+import (
+	"bytes"
+	"mime/multipart"
+	"testing"
+)
+
+// buildForm writes the same fields and file under a fresh random boundary
+func buildForm(t *testing.T, note string) (string, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("title", "report")
+	w.WriteField("note", note)
+	file, err := w.CreateFormFile("upload", "report.csv")
+	if err != nil {
+		t.Fatalf("Failed to create file part: %v", err)
+	}
+	file.Write([]byte("a,b\n1,2\n"))
+	w.Close()
+	return w.FormDataContentType(), buf.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	contentType1, body1 := buildForm(t, "first")
+	contentType2, body2 := buildForm(t, "first")
+
+	parts1, err := Parse(Boundary(contentType1), bytes.NewReader(body1))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	parts2, err := Parse(Boundary(contentType2), bytes.NewReader(body2))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	t.Run("Parts are described without the boundary", func(t *testing.T) {
+		if bytes.Equal(body1, body2) {
+			t.Fatal("Expected different boundaries in the raw bodies")
+		}
+		if len(parts1) != 3 {
+			t.Fatalf("Expected 3 parts, got %d", len(parts1))
+		}
+		for i := range parts1 {
+			if parts1[i] != parts2[i] {
+				t.Errorf("Part %d differs: %+v vs %+v", i, parts1[i], parts2[i])
+			}
+		}
+	})
+
+	t.Run("File metadata", func(t *testing.T) {
+		file := parts1[2]
+		if file.Name != "upload" || file.Filename != "report.csv" || file.ContentType != "application/octet-stream" || file.Size != 8 {
+			t.Errorf("Unexpected file part: %+v", file)
+		}
+	})
+
+	t.Run("Ignore patterns", func(t *testing.T) {
+		Ignore(parts1, []string{"no*"})
+		if !parts1[1].Ignored || parts1[0].Ignored || parts1[2].Ignored {
+			t.Errorf("Expected only note to be ignored: %+v", parts1)
+		}
+	})
+}
+
+func TestBoundary(t *testing.T) {
+	if got := Boundary("multipart/form-data; boundary=abc"); got != "abc" {
+		t.Errorf("Expected abc, got %q", got)
+	}
+	if got := Boundary("application/json"); got != "" {
+		t.Errorf("Expected no boundary for JSON, got %q", got)
+	}
+}
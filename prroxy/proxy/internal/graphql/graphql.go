@@ -0,0 +1,208 @@
+// Package graphql normalizes GraphQL-over-HTTP requests so that calls
+// differing only in formatting or variable order match the same recording.
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Operation is the part of a GraphQL request used for matching
+type Operation struct {
+	Name      string          `json:"operation_name,omitempty"`
+	Query     string          `json:"query"`               // Normalized document
+	Variables json.RawMessage `json:"variables,omitempty"` // Canonical JSON, keys sorted
+}
+
+// request is the JSON body of a GraphQL POST
+type request struct {
+	Query         string          `json:"query"`
+	OperationName string          `json:"operationName"`
+	Variables     json.RawMessage `json:"variables"`
+}
+
+// Parse reads a GraphQL POST body. The operation name defaults to the
+// name of the first operation in the document.
+func Parse(body []byte) (*Operation, error) {
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("failed to parse GraphQL request: %w", err)
+	}
+	if req.Query == "" {
+		return nil, fmt.Errorf("GraphQL request has no query")
+	}
+
+	tokens, err := tokenize(req.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	variables, err := canonicalVariables(req.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	name := req.OperationName
+	if name == "" {
+		name = firstOperationName(tokens)
+	}
+
+	return &Operation{
+		Name:      name,
+		Query:     join(tokens),
+		Variables: variables,
+	}, nil
+}
+
+// Normalize rewrites a query document with comments, commas and
+// insignificant whitespace removed
+func Normalize(query string) (string, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return "", err
+	}
+	return join(tokens), nil
+}
+
+// canonicalVariables re-encodes variables with sorted keys. Absent, null
+// and empty variables are all treated as none.
+func canonicalVariables(raw json.RawMessage) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber() // Keep numbers exactly as sent
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to parse GraphQL variables: %w", err)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	if object, ok := value.(map[string]interface{}); ok && len(object) == 0 {
+		return nil, nil
+	}
+
+	// encoding/json writes map keys in sorted order
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode GraphQL variables: %w", err)
+	}
+	return canonical, nil
+}
+
+// firstOperationName finds the name of the first named operation
+// definition at the top level of the document
+func firstOperationName(tokens []string) string {
+	depth := 0
+	for i, token := range tokens {
+		switch token {
+		case "{", "(", "[":
+			depth++
+		case "}", ")", "]":
+			depth--
+		case "query", "mutation", "subscription":
+			if depth == 0 && i+1 < len(tokens) && isName(tokens[i+1]) {
+				return tokens[i+1]
+			}
+		}
+	}
+	return ""
+}
+
+// join writes tokens back out, separated only where two words would
+// otherwise run together
+func join(tokens []string) string {
+	var sb strings.Builder
+	for i, token := range tokens {
+		if i > 0 && isWordByte(tokens[i-1][len(tokens[i-1])-1]) && (isWordByte(token[0]) || token[0] == '-') {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(token)
+	}
+	return sb.String()
+}
+
+// tokenize splits a document into its lexical tokens, dropping the
+// ignored ones (whitespace, commas, comments)
+func tokenize(src string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case strings.HasPrefix(src[i:], "\uFEFF"):
+			i += len("\uFEFF")
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, "...")
+			i += 3
+		case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			end, err := stringEnd(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, src[i:end])
+			i = end
+		case isWordByte(c) || c == '-':
+			start := i
+			i++
+			for i < len(src) && (isWordByte(src[i]) || src[i] == '.' ||
+				((src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, src[start:i])
+		default:
+			return nil, fmt.Errorf("unexpected character %q in GraphQL query", c)
+		}
+	}
+	return tokens, nil
+}
+
+// stringEnd returns the index just past the string or block string
+// starting at src[start]
+func stringEnd(src string, start int) (int, error) {
+	if strings.HasPrefix(src[start:], `"""`) {
+		for i := start + 3; i+3 <= len(src); i++ {
+			if strings.HasPrefix(src[i:], `\"""`) {
+				i += 3
+				continue
+			}
+			if strings.HasPrefix(src[i:], `"""`) {
+				return i + 3, nil
+			}
+		}
+		return 0, fmt.Errorf("unterminated block string in GraphQL query")
+	}
+
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		case '\n', '\r':
+			return 0, fmt.Errorf("unterminated string in GraphQL query")
+		}
+	}
+	return 0, fmt.Errorf("unterminated string in GraphQL query")
+}
+
+func isName(token string) bool {
+	c := token[0]
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,82 @@
+package graphql
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("Formatting and variable order don't matter", func(t *testing.T) {
+		a, err := Parse([]byte(`{"query":"query GetUser($id: ID!) {\n  user(id: $id) {\n    name, email # contact\n  }\n}","variables":{"id":"1","full":true}}`))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		b, err := Parse([]byte(`{"variables":{"full":true,"id":"1"},"query":"query GetUser($id:ID!){user(id:$id){name email}}"}`))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+
+		if a.Query != b.Query {
+			t.Errorf("Queries differ:\n%s\n%s", a.Query, b.Query)
+		}
+		if string(a.Variables) != string(b.Variables) {
+			t.Errorf("Variables differ: %s vs %s", a.Variables, b.Variables)
+		}
+		if a.Name != "GetUser" {
+			t.Errorf("Expected operation name from the document, got %q", a.Name)
+		}
+	})
+
+	t.Run("Explicit operation name wins", func(t *testing.T) {
+		op, err := Parse([]byte(`{"query":"query A { a } query B { b }","operationName":"B"}`))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if op.Name != "B" {
+			t.Errorf("Expected B, got %q", op.Name)
+		}
+	})
+
+	t.Run("Empty variables are none", func(t *testing.T) {
+		for _, body := range []string{`{"query":"{a}"}`, `{"query":"{a}","variables":null}`, `{"query":"{a}","variables":{}}`} {
+			op, err := Parse([]byte(body))
+			if err != nil {
+				t.Fatalf("Failed to parse %s: %v", body, err)
+			}
+			if op.Variables != nil {
+				t.Errorf("Expected no variables for %s, got %s", body, op.Variables)
+			}
+		}
+	})
+
+	t.Run("Rejects non-GraphQL bodies", func(t *testing.T) {
+		for _, body := range []string{`not json`, `{"foo":1}`, `{"query":"{ a(b: \"open) }"}`} {
+			if _, err := Parse([]byte(body)); err == nil {
+				t.Errorf("Expected error for %s", body)
+			}
+		}
+	})
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"{ a, b }", "{a b}"},
+		{"query Q($n: Int = -1) { items(first: $n) { ...F } }", "query Q($n:Int=-1){items(first:$n){...F}}"},
+		{"{ a(s: \"x,  y # not a comment\") }", "{a(s:\"x,  y # not a comment\")}"},
+		{"{ a(s: \"\"\"block \\\"\"\" text\"\"\") }", "{a(s:\"\"\"block \\\"\"\" text\"\"\")}"},
+		{"{ a(f: 1.5e+3, l: [1 -2]) }", "{a(f:1.5e+3 l:[1 -2])}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Normalize(tt.in)
+			if err != nil {
+				t.Fatalf("Failed to normalize: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
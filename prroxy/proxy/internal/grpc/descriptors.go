@@ -0,0 +1,86 @@
+package grpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Descriptors resolves methods from a compiled descriptor set
+// (protoc --include_imports --descriptor_set_out=...)
+type Descriptors struct {
+	files *protoregistry.Files
+}
+
+// LoadDescriptors reads a descriptor set file
+func LoadDescriptors(path string) (*Descriptors, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+
+	return &Descriptors{files: files}, nil
+}
+
+// Method finds the descriptor for a call path like "/pkg.Service/Method"
+func (d *Descriptors) Method(path string) (protoreflect.MethodDescriptor, error) {
+	service, method, ok := SplitMethod(path)
+	if !ok {
+		return nil, fmt.Errorf("not a gRPC method path: %s", path)
+	}
+
+	desc, err := d.files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("unknown service %s: %w", service, err)
+	}
+	serviceDesc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+
+	methodDesc := serviceDesc.Methods().ByName(protoreflect.Name(method))
+	if methodDesc == nil {
+		return nil, fmt.Errorf("unknown method %s on %s", method, service)
+	}
+	return methodDesc, nil
+}
+
+// RenderJSON decodes the messages of a request or response body as JSON
+func (d *Descriptors) RenderJSON(message protoreflect.MessageDescriptor, body []byte, encoding string) ([]json.RawMessage, error) {
+	messages, err := Messages(body, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := make([]json.RawMessage, 0, len(messages))
+	for _, data := range messages {
+		msg := dynamicpb.NewMessage(message)
+		if err := proto.Unmarshal(data, msg); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", message.FullName(), err)
+		}
+		text, err := protojson.Marshal(msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", message.FullName(), err)
+		}
+		rendered = append(rendered, text)
+	}
+	return rendered, nil
+}
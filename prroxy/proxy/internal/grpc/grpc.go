@@ -0,0 +1,86 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pismo/testing-proxy/internal/compression"
+)
+
+// Status codes used by the proxy (see google.golang.org/grpc/codes)
+const (
+	StatusNotFound           = 5
+	StatusFailedPrecondition = 9
+	StatusInternal           = 13
+	StatusUnavailable        = 14
+)
+
+// TargetHeader lets a call pick its upstream, since gRPC clients can't add
+// a ?target= query parameter
+const TargetHeader = "X-Proxy-Target"
+
+// frameHeaderSize is the compressed flag plus the 4-byte message length
+const frameHeaderSize = 5
+
+// IsGRPC reports whether req is a gRPC call (not gRPC-Web)
+func IsGRPC(req *http.Request) bool {
+	contentType := req.Header.Get("Content-Type")
+	return contentType == "application/grpc" || strings.HasPrefix(contentType, "application/grpc+")
+}
+
+// SplitMethod splits a call path like "/pkg.Service/Method"
+func SplitMethod(path string) (service, method string, ok bool) {
+	service, method, ok = strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if !ok || service == "" || method == "" || strings.Contains(method, "/") {
+		return "", "", false
+	}
+	return service, method, true
+}
+
+// Messages splits a gRPC body into its length-prefixed messages,
+// decompressing those flagged as compressed with encoding (grpc-encoding)
+func Messages(body []byte, encoding string) ([][]byte, error) {
+	var messages [][]byte
+	for len(body) > 0 {
+		if len(body) < frameHeaderSize {
+			return nil, fmt.Errorf("truncated gRPC frame header")
+		}
+		compressed := body[0] == 1
+		length := binary.BigEndian.Uint32(body[1:frameHeaderSize])
+		if uint64(len(body)-frameHeaderSize) < uint64(length) {
+			return nil, fmt.Errorf("truncated gRPC message: want %d bytes, have %d", length, len(body)-frameHeaderSize)
+		}
+
+		message := body[frameHeaderSize : frameHeaderSize+int(length)]
+		if compressed {
+			decoded, err := compression.Decode(encoding, message)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress gRPC message: %w", err)
+			}
+			message = decoded
+		}
+
+		messages = append(messages, message)
+		body = body[frameHeaderSize+int(length):]
+	}
+	return messages, nil
+}
+
+// Frame wraps a message in an uncompressed gRPC frame
+func Frame(message []byte) []byte {
+	frame := make([]byte, frameHeaderSize+len(message))
+	binary.BigEndian.PutUint32(frame[1:frameHeaderSize], uint32(len(message)))
+	copy(frame[frameHeaderSize:], message)
+	return frame
+}
+
+// WriteError answers a call with a trailers-only gRPC error
+func WriteError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", message)
+	w.WriteHeader(http.StatusOK)
+}
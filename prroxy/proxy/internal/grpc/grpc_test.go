@@ -0,0 +1,118 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/pismo/testing-proxy/internal/compression"
+)
+
+func TestMessages(t *testing.T) {
+	t.Run("Splits frames", func(t *testing.T) {
+		body := append(Frame([]byte("one")), Frame([]byte("two"))...)
+		messages, err := Messages(body, "")
+		if err != nil {
+			t.Fatalf("Failed to split: %v", err)
+		}
+		if len(messages) != 2 || string(messages[0]) != "one" || string(messages[1]) != "two" {
+			t.Errorf("Unexpected messages %q", messages)
+		}
+	})
+
+	t.Run("Decompresses flagged messages", func(t *testing.T) {
+		compressed, _ := compression.Encode(compression.Gzip, []byte("hello"))
+		frame := Frame(compressed)
+		frame[0] = 1
+
+		messages, err := Messages(frame, "gzip")
+		if err != nil || len(messages) != 1 || string(messages[0]) != "hello" {
+			t.Errorf("Expected hello, got %q (%v)", messages, err)
+		}
+	})
+
+	t.Run("Rejects truncated bodies", func(t *testing.T) {
+		frame := Frame([]byte("hello"))
+		if _, err := Messages(frame[:len(frame)-1], ""); err == nil {
+			t.Error("Expected error for truncated message")
+		}
+	})
+}
+
+func TestSplitMethod(t *testing.T) {
+	service, method, ok := SplitMethod("/pkg.Echo/Say")
+	if !ok || service != "pkg.Echo" || method != "Say" {
+		t.Errorf("Unexpected split: %q %q %v", service, method, ok)
+	}
+	if _, _, ok := SplitMethod("/api/users/1"); ok {
+		t.Error("Expected REST path to be rejected")
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("echo.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("EchoMessage"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("text"),
+				JsonName: proto.String("text"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Echo"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Say"),
+				InputType:  proto.String(".test.EchoMessage"),
+				OutputType: proto.String(".test.EchoMessage"),
+			}},
+		}},
+	}
+	data, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	path := filepath.Join(t.TempDir(), "echo.pb")
+	os.WriteFile(path, data, 0644)
+
+	descriptors, err := LoadDescriptors(path)
+	if err != nil {
+		t.Fatalf("Failed to load descriptors: %v", err)
+	}
+	method, err := descriptors.Method("/test.Echo/Say")
+	if err != nil {
+		t.Fatalf("Failed to find method: %v", err)
+	}
+
+	message := dynamicpb.NewMessage(method.Input())
+	message.Set(method.Input().Fields().ByName("text"), protoreflect.ValueOfString("hi"))
+	payload, _ := proto.Marshal(message)
+
+	rendered, err := descriptors.RenderJSON(method.Input(), Frame(payload), "")
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if len(rendered) != 1 || compact(rendered[0]) != `{"text":"hi"}` {
+		t.Errorf("Unexpected JSON %s", rendered)
+	}
+
+	if _, err := descriptors.Method("/test.Echo/Missing"); err == nil {
+		t.Error("Expected error for unknown method")
+	}
+}
+
+// compact strips the whitespace protojson may add
+func compact(data []byte) string {
+	var buf bytes.Buffer
+	json.Compact(&buf, data)
+	return buf.String()
+}
@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pismo/testing-proxy/internal/config"
+)
+
+// Admin roles
+const (
+	RoleRead  = "read"
+	RoleWrite = "write"
+)
+
+// AdminAuth protects the management API with static bearer tokens or
+// basic auth, and writes an audit entry for every mutating call.
+// Proxy traffic never goes through it. Credentials are read from the
+// config on every request so reloads take effect immediately.
+type AdminAuth struct {
+	config *config.Config
+	audit  *AuditLog
+}
+
+// principal is the authenticated caller
+type principal struct {
+	name string
+	role string
+}
+
+// NewAdminAuth creates the admin middleware, opening the audit log if configured
+func NewAdminAuth(cfg *config.Config) (*AdminAuth, error) {
+	// Roles are checked by config validation; the audit log path needs a restart
+	audit, err := NewAuditLog(cfg.AdminSettings().AuditLog)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AdminAuth{
+		config: cfg,
+		audit:  audit,
+	}, nil
+}
+
+// Close releases the audit log
+func (a *AdminAuth) Close() error {
+	return a.audit.Close()
+}
+
+// Middleware authenticates and authorizes admin requests
+func (a *AdminAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller := principal{name: "anonymous", role: RoleWrite}
+
+		settings := a.config.AdminSettings()
+		if settings.AuthEnabled() {
+			var ok bool
+			caller, ok = authenticate(settings, r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Basic realm="proxy admin"`)
+				http.Error(w, `{"error":"Authentication required"}`, http.StatusUnauthorized)
+				return
+			}
+		}
+
+		mutating := isMutating(r)
+		if mutating && caller.role != RoleWrite {
+			a.audit.Write(caller, r, http.StatusForbidden)
+			http.Error(w, `{"error":"Read-only credentials cannot modify the proxy"}`, http.StatusForbidden)
+			return
+		}
+
+		if !mutating {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		a.audit.Write(caller, r, recorder.status)
+	})
+}
+
+// authenticate matches the request's credentials against config
+func authenticate(settings config.AdminConfig, r *http.Request) (principal, bool) {
+	if presented, ok := bearerToken(r); ok {
+		for _, token := range settings.Tokens {
+			if secureEqual(presented, token.Token) {
+				return principal{name: token.Name, role: token.Role}, true
+			}
+		}
+		return principal{}, false
+	}
+
+	if username, password, ok := r.BasicAuth(); ok {
+		for _, user := range settings.Users {
+			if secureEqual(username, user.Username) && secureEqual(password, user.Password) {
+				return principal{name: user.Username, role: user.Role}, true
+			}
+		}
+	}
+
+	return principal{}, false
+}
+
+// AccessTokenParam carries a bearer token in the query string. Browsers
+// can't set headers on EventSource, links or page loads, so it is only
+// accepted on read-only GET requests.
+const AccessTokenParam = "access_token"
+
+// bearerToken returns the token from the Authorization header, or from
+// ?access_token= on read-only GET requests
+func bearerToken(r *http.Request) (string, bool) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer "), true
+	}
+	if r.Method == http.MethodGet && !isMutating(r) && r.URL.Query().Has(AccessTokenParam) {
+		return r.URL.Query().Get(AccessTokenParam), true
+	}
+	return "", false
+}
+
+// secureEqual compares secrets in constant time
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// isMutating reports whether an admin request changes proxy state.
+// GET /admin/mode?mode= switches mode, so it counts as a write; POST
+// /admin/rewrite/preview only tries rules out, so it doesn't.
+func isMutating(r *http.Request) bool {
+	if r.URL.Path == "/admin/rewrite/preview" {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return r.URL.Path == "/admin/mode" && r.URL.Query().Get("mode") != ""
+	default:
+		return true
+	}
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(p)
+}
+
+// Hijack lets WebSocket upgrades take over the connection
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	s.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Flush lets streaming handlers (SSE, recorded streams) push data
+// through the recorder
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// AuditEntry is one line in the audit log
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user"`
+	Role       string    `json:"role"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"`
+	Status     int       `json:"status"`
+	RemoteAddr string    `json:"remote_addr"`
+}
+
+// AuditLog appends JSON lines describing mutating admin calls
+type AuditLog struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewAuditLog opens path for appending; an empty path logs to stdout
+func NewAuditLog(path string) (*AuditLog, error) {
+	if path == "" {
+		return &AuditLog{}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return &AuditLog{file: file}, nil
+}
+
+// Write records a mutating call
+func (l *AuditLog) Write(caller principal, r *http.Request, status int) {
+	entry := AuditEntry{
+		Time:       time.Now().UTC(),
+		User:       caller.name,
+		Role:       caller.role,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Status:     status,
+		RemoteAddr: r.RemoteAddr,
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		log.Printf("[audit] %s", data)
+		return
+	}
+	l.file.Write(append(data, '\n'))
+}
+
+// Close closes the audit log file
+func (l *AuditLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
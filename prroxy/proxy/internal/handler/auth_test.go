@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pismo/testing-proxy/internal/config"
+)
+
+func TestAdminAuth(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	cfg := config.New()
+	cfg.Admin = config.AdminConfig{
+		Tokens: []config.AdminToken{
+			{Name: "ci", Token: "write-token", Role: RoleWrite},
+			{Name: "viewer", Token: "read-token", Role: RoleRead},
+		},
+		Users: []config.AdminUser{
+			{Username: "alice", Password: "secret", Role: RoleWrite},
+		},
+		AuditLog: auditPath,
+	}
+	auth, err := NewAdminAuth(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create auth: %v", err)
+	}
+	defer auth.Close()
+
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		setup  func(r *http.Request)
+		want   int
+	}{
+		{"no credentials", "GET", "/admin/status", nil, http.StatusUnauthorized},
+		{"wrong token", "GET", "/admin/status", func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, http.StatusUnauthorized},
+		{"read token can read", "GET", "/admin/status", func(r *http.Request) { r.Header.Set("Authorization", "Bearer read-token") }, http.StatusOK},
+		{"read token cannot delete", "DELETE", "/admin/recordings", func(r *http.Request) { r.Header.Set("Authorization", "Bearer read-token") }, http.StatusForbidden},
+		{"read token cannot switch mode via GET", "GET", "/admin/mode?mode=record", func(r *http.Request) { r.Header.Set("Authorization", "Bearer read-token") }, http.StatusForbidden},
+		{"write token can delete", "DELETE", "/admin/recordings", func(r *http.Request) { r.Header.Set("Authorization", "Bearer write-token") }, http.StatusOK},
+		{"basic auth", "POST", "/admin/mode", func(r *http.Request) { r.SetBasicAuth("alice", "secret") }, http.StatusOK},
+		{"basic auth wrong password", "GET", "/admin/status", func(r *http.Request) { r.SetBasicAuth("alice", "wrong") }, http.StatusUnauthorized},
+		{"query token for the event stream", "GET", "/admin/stream?access_token=read-token", nil, http.StatusOK},
+		{"wrong query token", "GET", "/admin/ui?access_token=nope", nil, http.StatusUnauthorized},
+		{"query token cannot switch mode", "GET", "/admin/mode?mode=record&access_token=write-token", nil, http.StatusUnauthorized},
+		{"query token only on GET", "DELETE", "/admin/recordings?access_token=write-token", nil, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.setup != nil {
+				tt.setup(req)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+
+	// Mutating calls that passed authentication are audited: 2 forbidden + 2 allowed
+	file, err := os.Open(auditPath)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Invalid audit line: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 audit entries, got %d", len(entries))
+	}
+	if entries[2].User != "ci" || entries[2].Status != http.StatusOK {
+		t.Errorf("Unexpected audit entry: %+v", entries[2])
+	}
+}
+
+func TestAdminAuthDisabled(t *testing.T) {
+	auth, err := NewAdminAuth(config.New())
+	if err != nil {
+		t.Fatalf("Failed to create auth: %v", err)
+	}
+
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected open access without credentials configured, got %d", rec.Code)
+	}
+}
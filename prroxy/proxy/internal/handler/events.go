@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"sync"
+)
+
+// Event types pushed to stream subscribers
+const (
+	EventRequest = "request"
+	EventMiss    = "miss"
+	EventMode    = "mode"
+)
+
+// Event is a single live update for the dashboard stream
+type Event struct {
+	Type  string               `json:"type"`
+	Entry *RequestHistoryEntry `json:"entry,omitempty"`
+	Mode  string               `json:"mode,omitempty"`
+}
+
+// subscriberBuffer bounds how far a slow subscriber may fall behind
+// before events are dropped for it
+const subscriberBuffer = 64
+
+// EventBroker fans out events to all connected stream subscribers
+type EventBroker struct {
+	subscribers map[chan Event]struct{}
+	mu          sync.RWMutex
+}
+
+// NewEventBroker creates a broker with no subscribers
+func NewEventBroker() *EventBroker {
+	return &EventBroker{
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Subscribe registers a new subscriber channel
+func (b *EventBroker) Subscribe() chan Event {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[ch] = struct{}{}
+
+	return ch
+}
+
+// Unsubscribe removes and closes a subscriber channel
+func (b *EventBroker) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish sends an event to every subscriber without blocking the caller.
+// Proxy traffic must never wait on a slow dashboard.
+func (b *EventBroker) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Subscriber is full, drop the event for it
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/pismo/testing-proxy/internal/grpc"
+	"github.com/pismo/testing-proxy/internal/mode"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/tracing"
+)
+
+// ServeGRPC handles unary gRPC calls arriving on the h2c listener.
+// Failures are reported as gRPC statuses so clients see proper errors.
+func (h *ProxyHandler) ServeGRPC(w http.ResponseWriter, r *http.Request) {
+	if !grpc.IsGRPC(r) {
+		http.Error(w, `{"error":"The gRPC listener only accepts application/grpc calls"}`, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Sequential processing with mutex
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Continue the caller's trace if it sent a traceparent
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "ProxyHandler.ServeGRPC",
+		attribute.String("rpc.method", r.URL.Path),
+	)
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	settings := h.config.GRPCSettings()
+	target := r.Header.Get(grpc.TargetHeader)
+	if target == "" {
+		target = settings.Target
+	}
+	r.Header.Del(grpc.TargetHeader)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		grpc.WriteError(w, grpc.StatusInternal, "failed to read request")
+		return
+	}
+
+	currentMode := h.config.GetMode()
+	span.SetAttributes(
+		attribute.String("proxy.target", target),
+		attribute.String("proxy.mode", currentMode),
+	)
+	var interaction *models.Interaction
+	startTime := time.Now()
+
+	outcome := OutcomeHit
+	record := currentMode == "record"
+
+	if !record {
+		interaction, err = h.player.HandleGRPC(r, body)
+		missErr, miss := err.(*mode.ErrNoRecording)
+		switch {
+		case miss && currentMode == mode.Hybrid && target != "":
+			record = true
+		case miss:
+			span.SetAttributes(attribute.String("proxy.outcome", OutcomeMiss))
+			h.addMiss(missErr, target, startTime)
+			grpc.WriteError(w, grpc.StatusNotFound, fmt.Sprintf("no recording found: %s", err.Error()))
+			return
+		case err != nil:
+			tracing.RecordError(span, err)
+			grpc.WriteError(w, grpc.StatusInternal, fmt.Sprintf("playback failed: %s", err.Error()))
+			return
+		default:
+			h.stats.incrementHit()
+		}
+	}
+
+	if record {
+		if target == "" {
+			grpc.WriteError(w, grpc.StatusFailedPrecondition, "no gRPC target: set grpc.target or the "+grpc.TargetHeader+" header")
+			return
+		}
+		outcome = OutcomeRecorded
+		interaction, err = h.recorder.HandleGRPC(r, target, body)
+		if err != nil {
+			tracing.RecordError(span, err)
+			grpc.WriteError(w, grpc.StatusUnavailable, fmt.Sprintf("record failed: %s", err.Error()))
+			return
+		}
+		h.stats.incrementRecord()
+	}
+
+	h.addInteraction(interaction, outcome, startTime)
+	writeGRPCResponse(w, interaction.Response)
+}
+
+// writeGRPCResponse writes a recorded call's headers, body and trailers
+func writeGRPCResponse(w http.ResponseWriter, resp models.RecordedResponse) {
+	for key, values := range resp.Headers {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	mode.RemoveHopByHopHeaders(w.Header())
+	w.Header().Del("Content-Length")
+
+	w.WriteHeader(resp.StatusCode)
+	w.Write(resp.Body)
+
+	// Trailers declared after the body are sent as HTTP/2 trailers
+	for key, values := range resp.Trailers {
+		for _, value := range values {
+			w.Header().Add(http.TrailerPrefix+key, value)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/grpc"
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+// newH2CServer starts a cleartext HTTP/2 test server
+func newH2CServer(handler http.Handler) *httptest.Server {
+	return httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+}
+
+// h2cClient talks cleartext HTTP/2 like a gRPC client
+var h2cClient = &http.Client{Transport: &http2.Transport{
+	AllowHTTP: true,
+	DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, addr)
+	},
+}}
+
+func TestGRPCRecordAndReplay(t *testing.T) {
+	upstream := newH2CServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		messages, _ := grpc.Messages(body, "")
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Write(grpc.Frame(append([]byte("reply to "), messages[0]...)))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}))
+
+	repo, err := storage.NewFileSystemRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	cfg := config.New()
+	cfg.SetMode("record")
+	cfg.GRPC.Target = upstream.URL
+	h := NewProxyHandler(cfg, repo)
+	proxy := newH2CServer(http.HandlerFunc(h.ServeGRPC))
+	defer proxy.Close()
+
+	call := func(message string) (*http.Response, []byte) {
+		req, _ := http.NewRequest("POST", proxy.URL+"/test.Echo/Say", bytes.NewReader(grpc.Frame([]byte(message))))
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("Te", "trailers")
+		resp, err := h2cClient.Do(req)
+		if err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	resp, body := call("hello")
+	if !bytes.Equal(body, grpc.Frame([]byte("reply to hello"))) || resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Fatalf("Unexpected recorded call: %q, trailers %v", body, resp.Trailer)
+	}
+
+	interactions, _ := repo.FindAll()
+	if len(interactions) != 1 || interactions[0].Request.URL != "/test.Echo/Say" {
+		t.Fatalf("Expected one recording for /test.Echo/Say, got %d", len(interactions))
+	}
+	if interactions[0].Response.Trailers["Grpc-Status"][0] != "0" {
+		t.Errorf("Trailers not stored: %v", interactions[0].Response.Trailers)
+	}
+
+	upstream.Close()
+	cfg.SetMode("playback")
+
+	t.Run("Replays body and trailers", func(t *testing.T) {
+		resp, body := call("hello")
+		if !bytes.Equal(body, grpc.Frame([]byte("reply to hello"))) {
+			t.Errorf("Unexpected replayed body %q", body)
+		}
+		if resp.Trailer.Get("Grpc-Status") != "0" {
+			t.Errorf("Expected grpc-status trailer 0, got %v", resp.Trailer)
+		}
+	})
+
+	t.Run("Different payload is a miss", func(t *testing.T) {
+		resp, _ := call("goodbye")
+		if resp.Header.Get("Grpc-Status") != "5" {
+			t.Errorf("Expected NOT_FOUND status, got %q", resp.Header.Get("Grpc-Status"))
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"sync"
+)
+
+// historyCapacity is the number of entries kept in memory per session
+const historyCapacity = 1000
+
+// RequestHistoryEntry tracks a single request in the session
+type RequestHistoryEntry struct {
+	Seq       int64  `json:"seq"` // Monotonic cursor, newer entries have larger values
+	ID        string `json:"id"`
+	Timestamp string `json:"timestamp"`
+	Method    string `json:"method"`
+	URL       string `json:"url"`
+	Target    string `json:"target"`
+	Status    int    `json:"status"`
+	Duration  int64  `json:"duration"`
+	Outcome   string `json:"outcome"` // "recorded", "hit" or "miss"
+	Saved     bool   `json:"saved"`   // Whether this was saved (not a duplicate)
+}
+
+// Request outcomes
+const (
+	OutcomeRecorded = "recorded"
+	OutcomeHit      = "hit"
+	OutcomeMiss     = "miss"
+)
+
+// RequestHistory is a fixed-size ring buffer of the requests seen this session
+type RequestHistory struct {
+	entries []RequestHistoryEntry
+	start   int   // Index of the oldest entry
+	size    int   // Number of valid entries
+	nextSeq int64 // Sequence assigned to the next entry
+	mu      sync.RWMutex
+}
+
+// NewRequestHistory creates a history holding at most capacity entries
+func NewRequestHistory(capacity int) *RequestHistory {
+	return &RequestHistory{
+		entries: make([]RequestHistoryEntry, capacity),
+		nextSeq: 1,
+	}
+}
+
+// Add appends an entry, evicting the oldest when full, and returns it
+// with its sequence number assigned
+func (h *RequestHistory) Add(entry RequestHistoryEntry) RequestHistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entry.Seq = h.nextSeq
+	h.nextSeq++
+
+	capacity := len(h.entries)
+	if h.size < capacity {
+		h.entries[(h.start+h.size)%capacity] = entry
+		h.size++
+	} else {
+		// Overwrite the oldest entry
+		h.entries[h.start] = entry
+		h.start = (h.start + 1) % capacity
+	}
+
+	return entry
+}
+
+// All returns every entry, newest first
+func (h *RequestHistory) All() []RequestHistoryEntry {
+	entries, _ := h.Page(0, 0)
+	return entries
+}
+
+// Page returns up to limit entries older than cursor, newest first.
+// A zero cursor starts from the newest entry and a zero limit means no
+// limit. The returned cursor is 0 when there are no older entries.
+func (h *RequestHistory) Page(cursor int64, limit int) ([]RequestHistoryEntry, int64) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	result := make([]RequestHistoryEntry, 0, h.size)
+	capacity := len(h.entries)
+
+	for i := h.size - 1; i >= 0; i-- {
+		entry := h.entries[(h.start+i)%capacity]
+		if cursor > 0 && entry.Seq >= cursor {
+			continue
+		}
+		if limit > 0 && len(result) == limit {
+			// There is at least one older entry, continue from the last one returned
+			return result, result[len(result)-1].Seq
+		}
+		result = append(result, entry)
+	}
+
+	return result, 0
+}
+
+// Since returns entries newer than seq, oldest first (used to resume streams)
+func (h *RequestHistory) Since(seq int64) []RequestHistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var result []RequestHistoryEntry
+	capacity := len(h.entries)
+
+	for i := 0; i < h.size; i++ {
+		entry := h.entries[(h.start+i)%capacity]
+		if entry.Seq > seq {
+			result = append(result, entry)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"testing"
+)
+
+func TestRequestHistory(t *testing.T) {
+	t.Run("Newest first", func(t *testing.T) {
+		history := NewRequestHistory(10)
+		for i := 0; i < 3; i++ {
+			history.Add(RequestHistoryEntry{Status: 200 + i})
+		}
+
+		entries := history.All()
+		if len(entries) != 3 {
+			t.Fatalf("Expected 3 entries, got %d", len(entries))
+		}
+		if entries[0].Status != 202 || entries[2].Status != 200 {
+			t.Errorf("Entries not newest first: %+v", entries)
+		}
+	})
+
+	t.Run("Evicts oldest when full", func(t *testing.T) {
+		history := NewRequestHistory(3)
+		for i := 0; i < 5; i++ {
+			history.Add(RequestHistoryEntry{Status: i})
+		}
+
+		entries := history.All()
+		if len(entries) != 3 {
+			t.Fatalf("Expected 3 entries, got %d", len(entries))
+		}
+		if entries[0].Seq != 5 || entries[2].Seq != 3 {
+			t.Errorf("Expected seqs 5..3, got %d..%d", entries[0].Seq, entries[2].Seq)
+		}
+	})
+
+	t.Run("Cursor pagination", func(t *testing.T) {
+		history := NewRequestHistory(10)
+		for i := 0; i < 5; i++ {
+			history.Add(RequestHistoryEntry{})
+		}
+
+		page, cursor := history.Page(0, 2)
+		if len(page) != 2 || page[0].Seq != 5 || cursor != 4 {
+			t.Fatalf("Unexpected first page: %+v cursor=%d", page, cursor)
+		}
+
+		page, cursor = history.Page(cursor, 2)
+		if len(page) != 2 || page[0].Seq != 3 || cursor != 2 {
+			t.Fatalf("Unexpected second page: %+v cursor=%d", page, cursor)
+		}
+
+		page, cursor = history.Page(cursor, 2)
+		if len(page) != 1 || page[0].Seq != 1 || cursor != 0 {
+			t.Fatalf("Unexpected last page: %+v cursor=%d", page, cursor)
+		}
+	})
+
+	t.Run("Since for stream resume", func(t *testing.T) {
+		history := NewRequestHistory(10)
+		for i := 0; i < 4; i++ {
+			history.Add(RequestHistoryEntry{})
+		}
+
+		entries := history.Since(2)
+		if len(entries) != 2 || entries[0].Seq != 3 || entries[1].Seq != 4 {
+			t.Errorf("Expected seqs 3,4 oldest first, got %+v", entries)
+		}
+	})
+}
+
+func TestStreamFilter(t *testing.T) {
+	entry := &RequestHistoryEntry{Target: "api.example.com/users/1", Status: 404, Outcome: OutcomeMiss}
+	event := Event{Type: EventMiss, Entry: entry}
+
+	tests := []struct {
+		name   string
+		filter streamFilter
+		want   bool
+	}{
+		{"no filter", streamFilter{}, true},
+		{"target host", streamFilter{target: "api.example.com"}, true},
+		{"target prefix", streamFilter{target: "api.example.com/users"}, true},
+		{"partial host", streamFilter{target: "example"}, false},
+		{"other target", streamFilter{target: "other"}, false},
+		{"exact status", streamFilter{status: "404"}, true},
+		{"status class", streamFilter{status: "4xx"}, true},
+		{"other status class", streamFilter{status: "2xx"}, false},
+		{"outcome", streamFilter{outcome: OutcomeMiss}, true},
+		{"other outcome", streamFilter{outcome: OutcomeHit}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.matches(event); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if !(streamFilter{outcome: OutcomeHit}).matches(Event{Type: EventMode, Mode: "record"}) {
+		t.Error("Mode events should always pass the filter")
+	}
+}
@@ -1,12 +1,23 @@
 package handler
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/grpc"
+	"github.com/pismo/testing-proxy/internal/mode"
+	"github.com/pismo/testing-proxy/internal/models"
 	"github.com/pismo/testing-proxy/internal/storage"
 	"github.com/pismo/testing-proxy/web"
 )
@@ -20,9 +31,9 @@ type ManagementHandler struct {
 }
 
 // NewManagementHandler creates a new management handler
-func NewManagementHandler(repository storage.Repository, proxy *ProxyHandler) *ManagementHandler {
+func NewManagementHandler(cfg *config.Config, repository storage.Repository, proxy *ProxyHandler) *ManagementHandler {
 	return &ManagementHandler{
-		config:     config.GetInstance(),
+		config:     cfg,
 		repository: repository,
 		proxy:      proxy,
 		startTime:  time.Now(),
@@ -59,6 +70,7 @@ func (h *ManagementHandler) HandleMode(w http.ResponseWriter, r *http.Request) {
 				http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
 				return
 			}
+			h.proxy.Events().Publish(Event{Type: EventMode, Mode: modeParam})
 
 			response := map[string]string{
 				"mode":    modeParam,
@@ -91,6 +103,7 @@ func (h *ManagementHandler) HandleMode(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
 			return
 		}
+		h.proxy.Events().Publish(Event{Type: EventMode, Mode: request.Mode})
 
 		response := map[string]string{
 			"mode":    request.Mode,
@@ -104,13 +117,26 @@ func (h *ManagementHandler) HandleMode(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// HandleRecording handles individual recording retrieval
+// HandleRecording handles CRUD on a single recording:
+// GET ?id= reads, PUT creates or replaces, PATCH ?id= edits the response,
+// DELETE ?id= removes it
 func (h *ManagementHandler) HandleRecording(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	switch r.Method {
+	case http.MethodGet:
+		h.getRecording(w, r)
+	case http.MethodPut:
+		h.putRecording(w, r)
+	case http.MethodPatch:
+		h.patchRecording(w, r)
+	case http.MethodDelete:
+		h.deleteRecording(w, r)
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
 	}
+}
 
+// getRecording returns a single recording by hash
+func (h *ManagementHandler) getRecording(w http.ResponseWriter, r *http.Request) {
 	// Get recording ID from query parameter
 	id := r.URL.Query().Get("id")
 	if id == "" {
@@ -129,6 +155,224 @@ func (h *ManagementHandler) HandleRecording(w http.ResponseWriter, r *http.Reque
 	json.NewEncoder(w).Encode(interaction)
 }
 
+// putRecording creates or replaces a recording from a full interaction.
+// With ?id= the existing recording is replaced; if the request part
+// changed, the file under the old hash is removed so filenames always
+// match the content. A different recording with the same hash is only
+// overwritten with ?overwrite=true.
+func (h *ManagementHandler) putRecording(w http.ResponseWriter, r *http.Request) {
+	var interaction models.Interaction
+	if err := json.NewDecoder(r.Body).Decode(&interaction); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"Invalid interaction: %s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	if interaction.Request.Method == "" || interaction.Request.URL == "" {
+		http.Error(w, `{"error":"Request method and url are required"}`, http.StatusBadRequest)
+		return
+	}
+	if interaction.Response.StatusCode == 0 {
+		http.Error(w, `{"error":"Response status_code is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	// The request hash names the file, so it is never taken from the
+	// client: an out-of-line body is hashed again from its blob
+	if err := h.rehashRequestBody(&interaction.Request); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"Invalid request body_ref: %s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	oldID := r.URL.Query().Get("id")
+	status := http.StatusCreated
+	if oldID != "" {
+		existing, err := h.repository.Find(oldID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"Recording not found: %s"}`, err.Error()), http.StatusNotFound)
+			return
+		}
+		// Keep identity fields unless the caller overrides them
+		if interaction.ID == "" {
+			interaction.ID = existing.ID
+		}
+		if interaction.Timestamp.IsZero() {
+			interaction.Timestamp = existing.Timestamp
+		}
+		status = http.StatusOK
+	}
+
+	if interaction.ID == "" {
+		interaction.ID = uuid.New().String()
+	}
+	if interaction.Timestamp.IsZero() {
+		interaction.Timestamp = time.Now()
+	}
+	if interaction.Metadata.Target == "" {
+		interaction.Metadata.Target = interaction.Request.URL
+	}
+
+	newID := interaction.Request.GenerateHash()
+	if newID != oldID && r.URL.Query().Get("overwrite") != "true" {
+		if _, err := h.repository.Find(newID); err == nil {
+			http.Error(w, fmt.Sprintf(`{"error":"Recording already exists: %s, use overwrite=true to replace it"}`, newID), http.StatusConflict)
+			return
+		}
+	}
+
+	if err := h.repository.Save(&interaction); err != nil {
+		if _, ok := err.(storage.ErrInvalidHash); ok {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, fmt.Sprintf(`{"error":"Failed to save recording: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	if oldID != "" && oldID != newID {
+		if err := h.repository.Delete(oldID); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"Saved new recording but failed to remove old one: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":          newID,
+		"previous_id": oldID,
+		"recording":   interaction,
+	})
+}
+
+// rehashRequestBody recomputes BodyHash for a request body stored as a
+// blob, and clears it otherwise
+func (h *ManagementHandler) rehashRequestBody(req *models.RecordedRequest) error {
+	req.BodyHash = ""
+	if req.BodyRef == "" || req.Body != nil {
+		return nil
+	}
+
+	blob, err := h.repository.OpenBlob(req.BodyRef)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	hasher := models.NewRequestHasher(req.Method, req.URL)
+	if _, err := io.Copy(hasher, blob); err != nil {
+		return err
+	}
+	req.BodyHash = hex.EncodeToString(hasher.Sum(nil))
+	return nil
+}
+
+// recordingPatch lists the response fields that PATCH may change.
+// Body is plain text; BodyBase64 is for binary content.
+type recordingPatch struct {
+	StatusCode *int                 `json:"status_code"`
+	Headers    *map[string][]string `json:"headers"`
+	Body       *string              `json:"body"`
+	BodyBase64 *string              `json:"body_base64"`
+}
+
+// patchRecording edits the response of an existing recording. The
+// request part is untouched, so the hash and filename stay the same.
+func (h *ManagementHandler) patchRecording(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, `{"error":"Missing recording ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var patch recordingPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"Invalid patch: %s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	interaction, err := h.repository.Find(id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"Recording not found: %s"}`, err.Error()), http.StatusNotFound)
+		return
+	}
+
+	if patch.StatusCode != nil {
+		if *patch.StatusCode < 100 || *patch.StatusCode > 599 {
+			http.Error(w, `{"error":"Invalid status_code"}`, http.StatusBadRequest)
+			return
+		}
+		interaction.Response.StatusCode = *patch.StatusCode
+	}
+	if patch.Headers != nil {
+		interaction.Response.Headers = *patch.Headers
+	}
+	if patch.Body != nil && patch.BodyBase64 != nil {
+		http.Error(w, `{"error":"Use either body or body_base64, not both"}`, http.StatusBadRequest)
+		return
+	}
+	if patch.Body != nil {
+		interaction.Response.Body = []byte(*patch.Body)
+	}
+	if patch.BodyBase64 != nil {
+		body, err := base64.StdEncoding.DecodeString(*patch.BodyBase64)
+		if err != nil {
+			http.Error(w, `{"error":"Invalid body_base64"}`, http.StatusBadRequest)
+			return
+		}
+		interaction.Response.Body = body
+	}
+	if patch.Body != nil || patch.BodyBase64 != nil {
+		// A stale length would truncate or stall clients on playback
+		delete(interaction.Response.Headers, "Content-Length")
+		// The edited body replaces any blob stored out of line, and the
+		// recorded stream timing no longer lines up with it
+		interaction.Response.BodyRef = ""
+		interaction.Response.BodySize = 0
+		interaction.Response.Chunks = nil
+		// It is served as given, not re-encoded, and no longer the
+		// deduplicated blob
+		interaction.Response.ContentEncoding = ""
+		interaction.Response.BodyDigest = ""
+	}
+
+	if err := h.repository.Save(interaction); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"Failed to save recording: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(interaction)
+}
+
+// deleteRecording removes a single recording by hash
+func (h *ManagementHandler) deleteRecording(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, `{"error":"Missing recording ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repository.Delete(id); err != nil {
+		if _, ok := err.(storage.ErrNotFound); ok {
+			http.Error(w, fmt.Sprintf(`{"error":"Recording not found: %s"}`, err.Error()), http.StatusNotFound)
+			return
+		}
+		if _, ok := err.(storage.ErrInvalidHash); ok {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, fmt.Sprintf(`{"error":"Failed to delete recording: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]string{
+		"message": "Recording deleted successfully",
+		"id":      id,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // HandleHistory returns the request history log
 func (h *ManagementHandler) HandleHistory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -136,12 +380,38 @@ func (h *ManagementHandler) HandleHistory(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	history := h.proxy.GetHistory()
+	query := r.URL.Query()
+
+	// Optional cursor-based pagination: ?limit=50&cursor=<seq from next_cursor>
+	var cursor int64
+	if value := query.Get("cursor"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, `{"error":"Invalid cursor"}`, http.StatusBadRequest)
+			return
+		}
+		cursor = parsed
+	}
+
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, `{"error":"Invalid limit"}`, http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	history, nextCursor := h.proxy.History().Page(cursor, limit)
 
 	response := map[string]interface{}{
 		"count":   len(history),
 		"history": history,
 	}
+	if nextCursor > 0 {
+		response["next_cursor"] = nextCursor
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -151,17 +421,36 @@ func (h *ManagementHandler) HandleHistory(w http.ResponseWriter, r *http.Request
 func (h *ManagementHandler) HandleRecordings(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		// List all recordings
-		interactions, err := h.repository.FindAll()
+		// List recordings, optionally filtered, sorted and paginated
+		query, err := parseRecordingQuery(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		// Staleness depends on the configured ttls
+		if value := r.URL.Query().Get("stale"); value != "" {
+			want, err := strconv.ParseBool(value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf(`{"error":"invalid stale: %s"}`, value), http.StatusBadRequest)
+				return
+			}
+			query.Where = func(interaction *models.Interaction) bool {
+				return mode.IsStale(h.config, interaction) == want
+			}
+		}
+
+		result, err := h.repository.Query(query)
 		if err != nil {
 			http.Error(w, fmt.Sprintf(`{"error":"Failed to list recordings: %s"}`, err.Error()), http.StatusInternalServerError)
 			return
 		}
+		interactions := result.Interactions
 
 		// Convert to summary format for listing
 		var recordings []map[string]interface{}
 		for _, interaction := range interactions {
-			recordings = append(recordings, map[string]interface{}{
+			summary := map[string]interface{}{
 				"id":        interaction.Request.GenerateHash(), // Use hash as ID for retrieval
 				"uuid":      interaction.ID,                      // Keep UUID for reference
 				"timestamp": interaction.Timestamp,
@@ -170,13 +459,25 @@ func (h *ManagementHandler) HandleRecordings(w http.ResponseWriter, r *http.Requ
 				"target":    interaction.Metadata.Target,
 				"status":    interaction.Response.StatusCode,
 				"duration":  interaction.Metadata.DurationMS,
-			})
+			}
+			if op := interaction.Request.GraphQL; op != nil {
+				summary["operation"] = op.Name
+			}
+			if expires := mode.ExpiresAt(h.config, interaction); !expires.IsZero() {
+				summary["expires_at"] = expires
+				summary["stale"] = time.Now().After(expires)
+			}
+			recordings = append(recordings, summary)
 		}
 
 		response := map[string]interface{}{
 			"count":      len(recordings),
+			"total":      result.Total,
 			"recordings": recordings,
 		}
+		if result.NextCursor != "" {
+			response["next_cursor"] = result.NextCursor
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
@@ -199,6 +500,155 @@ func (h *ManagementHandler) HandleRecordings(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// parseRecordingQuery builds a storage query from the request parameters:
+// target, method, status, url (substring), url_regex, since/until (RFC3339),
+// sort (field, "-field" for descending), limit, cursor and page. The stale
+// filter is added by the handler.
+func parseRecordingQuery(r *http.Request) (storage.Query, error) {
+	params := r.URL.Query()
+	query := storage.Query{
+		Target:      params.Get("target"),
+		Method:      params.Get("method"),
+		URLContains: params.Get("url"),
+		Operation:   params.Get("operation"),
+		Cursor:      params.Get("cursor"),
+	}
+
+	if value := params.Get("status"); value != "" {
+		status, err := strconv.Atoi(value)
+		if err != nil {
+			return query, fmt.Errorf("invalid status: %s", value)
+		}
+		query.Status = status
+	}
+
+	if value := params.Get("url_regex"); value != "" {
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return query, fmt.Errorf("invalid url_regex: %v", err)
+		}
+		query.URLPattern = pattern
+	}
+
+	for name, dest := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if value := params.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s (expected RFC3339): %s", name, value)
+			}
+			*dest = parsed
+		}
+	}
+
+	if value := params.Get("sort"); value != "" {
+		query.SortBy = strings.TrimPrefix(value, "-")
+		query.Ascending = !strings.HasPrefix(value, "-")
+	}
+
+	for name, dest := range map[string]*int{"limit": &query.Limit, "page": &query.Page} {
+		if value := params.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				return query, fmt.Errorf("invalid %s: %s", name, value)
+			}
+			*dest = parsed
+		}
+	}
+
+	return query, query.Validate()
+}
+
+// HandleBlob streams a body that was stored out of line
+func (h *ManagementHandler) HandleBlob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ref := r.URL.Query().Get("ref")
+	if ref == "" {
+		http.Error(w, `{"error":"Missing 'ref' query parameter"}`, http.StatusBadRequest)
+		return
+	}
+
+	blob, err := h.repository.OpenBlob(ref)
+	if err != nil {
+		if _, ok := err.(storage.ErrInvalidBlobRef); ok {
+			http.Error(w, `{"error":"Invalid blob reference"}`, http.StatusBadRequest)
+			return
+		}
+		if _, ok := err.(storage.ErrNotFound); ok {
+			http.Error(w, `{"error":"Blob not found"}`, http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf(`{"error":"Failed to open blob: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	io.Copy(w, blob)
+}
+
+// HandleGRPC renders a recorded gRPC call's messages as JSON using the
+// configured descriptor set
+func (h *ManagementHandler) HandleGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, `{"error":"Missing recording ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	path := h.config.GRPCSettings().DescriptorSet
+	if path == "" {
+		http.Error(w, `{"error":"No gRPC descriptor set configured"}`, http.StatusNotFound)
+		return
+	}
+	descriptors, err := grpc.LoadDescriptors(path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	interaction, err := h.repository.Find(id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"Recording not found: %s"}`, err.Error()), http.StatusNotFound)
+		return
+	}
+
+	method, err := descriptors.Method(interaction.Request.URL)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusNotFound)
+		return
+	}
+
+	requestEncoding := http.Header(interaction.Request.Headers).Get("Grpc-Encoding")
+	request, err := descriptors.RenderJSON(method.Input(), interaction.Request.Body, requestEncoding)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusUnprocessableEntity)
+		return
+	}
+	responseEncoding := http.Header(interaction.Response.Headers).Get("Grpc-Encoding")
+	response, err := descriptors.RenderJSON(method.Output(), interaction.Response.Body, responseEncoding)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"method":   string(method.FullName()),
+		"request":  request,
+		"response": response,
+		"trailers": interaction.Response.Trailers,
+	})
+}
+
 // HandleDashboard serves the web UI
 func (h *ManagementHandler) HandleDashboard(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
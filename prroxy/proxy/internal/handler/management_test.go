@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+func TestHandleRecording(t *testing.T) {
+	repo, err := storage.NewFileSystemRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	cfg := config.New()
+	management := NewManagementHandler(cfg, repo, NewProxyHandler(cfg, repo))
+
+	serve := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		management.HandleRecording(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return rec
+	}
+
+	put := `{"request":{"method":"GET","url":"api.example.com/users/1"},"response":{"status_code":200,"body":"e30="}}`
+	rec := serve("PUT", "/admin/recording", put)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &created)
+
+	t.Run("Put refuses to overwrite a recording with the same hash", func(t *testing.T) {
+		rec := serve("PUT", "/admin/recording", put)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("Expected 409, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		rec = serve("PUT", "/admin/recording?overwrite=true", put)
+		if rec.Code != http.StatusCreated {
+			t.Errorf("Expected 201 with overwrite, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		rec = serve("PUT", "/admin/recording?id="+created.ID, put)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected replacing by id to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("Patched body drops the stored encoding and digest", func(t *testing.T) {
+		repo.SetDedup(true)
+		defer repo.SetDedup(false)
+
+		interaction, _ := repo.Find(created.ID)
+		interaction.Response.ContentEncoding = "gzip"
+		interaction.Response.Body = []byte(strings.Repeat("x", storage.DedupMinSize))
+		repo.Save(interaction)
+
+		rec := serve("PATCH", "/admin/recording?id="+created.ID, `{"body":"plain"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var patched models.Interaction
+		json.Unmarshal(rec.Body.Bytes(), &patched)
+		if string(patched.Response.Body) != "plain" || patched.Response.ContentEncoding != "" || patched.Response.BodyDigest != "" {
+			t.Errorf("Unexpected response: %+v", patched.Response)
+		}
+
+		stored, err := repo.Find(created.ID)
+		if err != nil || string(stored.Response.Body) != "plain" || stored.Response.ContentEncoding != "" {
+			t.Errorf("Unexpected stored response: %+v (%v)", stored, err)
+		}
+	})
+
+	t.Run("Client hashes are never used as file names", func(t *testing.T) {
+		ref, _, err := repo.SaveBlob(strings.NewReader("payload"))
+		if err != nil {
+			t.Fatalf("Failed to save blob: %v", err)
+		}
+		crafted := `{"request":{"method":"POST","url":"api.example.com/upload","body_ref":"` + ref + `","body_hash":"../../escaped"},"response":{"status_code":200}}`
+		rec := serve("PUT", "/admin/recording", crafted)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		hasher := models.NewRequestHasher("POST", "api.example.com/upload")
+		hasher.Write([]byte("payload"))
+		var saved struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &saved)
+		if want := hex.EncodeToString(hasher.Sum(nil)); saved.ID != want {
+			t.Errorf("Expected id %s recomputed from the blob, got %s", want, saved.ID)
+		}
+
+		crafted = `{"request":{"method":"POST","url":"api.example.com/upload","body_ref":"a","body_hash":"../../escaped"},"response":{"status_code":200}}`
+		if rec := serve("PUT", "/admin/recording", crafted); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for an unknown body_ref, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		if rec := serve("DELETE", "/admin/recording?id=../../victim", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for a path id, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
\ No newline at end of file
@@ -1,27 +1,38 @@
 package handler
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/pismo/testing-proxy/internal/compression"
 	"github.com/pismo/testing-proxy/internal/config"
 	"github.com/pismo/testing-proxy/internal/mode"
 	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/spool"
 	"github.com/pismo/testing-proxy/internal/storage"
+	"github.com/pismo/testing-proxy/internal/tracing"
 )
 
 // ProxyHandler handles incoming proxy requests
 type ProxyHandler struct {
-	config    *config.Config
-	recorder  *mode.Recorder
-	player    *mode.Player
-	stats     *Statistics
-	history   *RequestHistory
-	mu        sync.Mutex // Sequential processing
+	config     *config.Config
+	repository storage.Repository
+	recorder   *mode.Recorder
+	player     *mode.Player
+	stats      *Statistics
+	history    *RequestHistory
+	events     *EventBroker
+	observers  []func(RequestHistoryEntry) // Registered before serving
+	mu         sync.Mutex                  // Sequential processing
 }
 
 // Statistics tracks proxy metrics
@@ -32,113 +43,175 @@ type Statistics struct {
 	mu            sync.RWMutex
 }
 
-// RequestHistoryEntry tracks a single request in the session
-type RequestHistoryEntry struct {
-	ID        string                `json:"id"`
-	Timestamp string                `json:"timestamp"`
-	Method    string                `json:"method"`
-	URL       string                `json:"url"`
-	Target    string                `json:"target"`
-	Status    int                   `json:"status"`
-	Duration  int64                 `json:"duration"`
-	Saved     bool                  `json:"saved"` // Whether this was saved (not a duplicate)
-}
-
-// RequestHistory tracks all requests this session
-type RequestHistory struct {
-	entries []RequestHistoryEntry
-	mu      sync.RWMutex
-}
-
 // NewProxyHandler creates a new proxy handler
-func NewProxyHandler(repository storage.Repository) *ProxyHandler {
+func NewProxyHandler(cfg *config.Config, repository storage.Repository) *ProxyHandler {
 	return &ProxyHandler{
-		config:   config.GetInstance(),
-		recorder: mode.NewRecorder(repository),
-		player:   mode.NewPlayer(repository),
-		stats:    &Statistics{},
-		history:  &RequestHistory{entries: make([]RequestHistoryEntry, 0, 100)},
+		config:     cfg,
+		repository: repository,
+		recorder:   mode.NewRecorder(cfg, repository),
+		player:     mode.NewPlayer(cfg, repository),
+		stats:      &Statistics{},
+		history:    NewRequestHistory(historyCapacity),
+		events:     NewEventBroker(),
 	}
 }
 
-// AddToHistory adds a request to the history log
+// AddToHistory adds a request to the history log and notifies stream subscribers
 func (h *ProxyHandler) AddToHistory(entry RequestHistoryEntry) {
-	h.history.mu.Lock()
-	defer h.history.mu.Unlock()
-
-	// Prepend to show newest first
-	h.history.entries = append([]RequestHistoryEntry{entry}, h.history.entries...)
+	entry = h.history.Add(entry)
+	for _, observe := range h.observers {
+		observe(entry)
+	}
 
-	// Keep last 1000 entries to prevent memory bloat
-	if len(h.history.entries) > 1000 {
-		h.history.entries = h.history.entries[:1000]
+	eventType := EventRequest
+	if entry.Outcome == OutcomeMiss {
+		eventType = EventMiss
 	}
+	h.events.Publish(Event{Type: eventType, Entry: &entry})
 }
 
-// GetHistory returns the request history
+// Observe calls fn with every request added to the history. Unlike the
+// history itself it never drops entries; register observers before the
+// handler starts serving.
+func (h *ProxyHandler) Observe(fn func(RequestHistoryEntry)) {
+	h.observers = append(h.observers, fn)
+}
+
+// GetHistory returns the request history, newest first
 func (h *ProxyHandler) GetHistory() []RequestHistoryEntry {
-	h.history.mu.RLock()
-	defer h.history.mu.RUnlock()
+	return h.history.All()
+}
 
-	// Return a copy to prevent race conditions
-	result := make([]RequestHistoryEntry, len(h.history.entries))
-	copy(result, h.history.entries)
-	return result
+// History returns the underlying history buffer
+func (h *ProxyHandler) History() *RequestHistory {
+	return h.history
+}
+
+// Events returns the broker used for live dashboard updates
+func (h *ProxyHandler) Events() *EventBroker {
+	return h.events
 }
 
 // ServeHTTP handles incoming HTTP requests
 func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// WebSocket sessions are long-lived, so they don't take the lock
+	if mode.IsWebSocketUpgrade(r) {
+		h.serveWebSocket(w, r)
+		return
+	}
+
 	// Sequential processing with mutex
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	// Extract target from query parameter
-	target := r.URL.Query().Get("target")
-	if target == "" {
-		http.Error(w, `{"error":"Missing 'target' query parameter"}`, http.StatusBadRequest)
-		return
-	}
+	// Continue the caller's trace if it sent a traceparent
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "ProxyHandler.ServeHTTP",
+		attribute.String("http.method", r.Method),
+		attribute.String("http.target", r.URL.Path),
+	)
+	defer span.End()
+	r = r.WithContext(ctx)
 
-	// Validate target URL
-	if _, err := url.Parse(target); err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"Invalid target URL: %s"}`, err.Error()), http.StatusBadRequest)
+	target, ok := requestTarget(w, r)
+	if !ok {
 		return
 	}
 
-	// Read request body
-	body, err := io.ReadAll(r.Body)
+	// Read request body, spilling large uploads to disk
+	body, err := spool.Read(r.Body, h.config.Storage.BlobThresholdBytes())
 	if err != nil {
 		http.Error(w, `{"error":"Failed to read request body"}`, http.StatusBadRequest)
 		return
 	}
+	defer body.Close()
 
 	// Handle based on current mode
 	currentMode := h.config.GetMode()
+	span.SetAttributes(
+		attribute.String("proxy.target", target),
+		attribute.String("proxy.mode", currentMode),
+	)
 	var interaction *models.Interaction
 	startTime := time.Now()
 
-	if currentMode == "record" {
-		interaction, err = h.handleRecord(r, target, body)
-		if err != nil {
-			http.Error(w, fmt.Sprintf(`{"error":"Record failed: %s"}`, err.Error()), http.StatusInternalServerError)
+	outcome := OutcomeHit
+	record := currentMode == "record"
+
+	if !record {
+		interaction, err = h.handlePlayback(r, target, body)
+		missErr, miss := err.(*mode.ErrNoRecording)
+		switch {
+		case miss && currentMode == mode.Hybrid:
+			// Missing or stale: fetch it from the upstream instead
+			record = true
+		case miss:
+			span.SetAttributes(attribute.String("proxy.outcome", OutcomeMiss))
+			h.addMiss(missErr, target, startTime)
+			http.Error(w, fmt.Sprintf(`{"error":"No recording found: %s"}`, err.Error()), http.StatusNotFound)
+			return
+		case err != nil:
+			tracing.RecordError(span, err)
+			http.Error(w, fmt.Sprintf(`{"error":"Playback failed: %s"}`, err.Error()), http.StatusInternalServerError)
 			return
+		default:
+			h.stats.incrementHit()
 		}
-		h.stats.incrementRecord()
-	} else {
-		interaction, err = h.handlePlayback(r, target, body)
+	}
+
+	sw := &statusRecorder{ResponseWriter: w}
+	if record {
+		outcome = OutcomeRecorded
+		interaction, err = h.handleRecord(sw, r, target, body)
 		if err != nil {
-			if _, ok := err.(*mode.ErrNoRecording); ok {
-				h.stats.incrementMiss()
-				http.Error(w, fmt.Sprintf(`{"error":"No recording found: %s"}`, err.Error()), http.StatusNotFound)
+			tracing.RecordError(span, err)
+			if sw.status != 0 {
+				// The response was already on its way; all we can do is stop
+				fmt.Printf("Warning: Response stream interrupted: %v\n", err)
 				return
 			}
-			http.Error(w, fmt.Sprintf(`{"error":"Playback failed: %s"}`, err.Error()), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf(`{"error":"Record failed: %s"}`, err.Error()), http.StatusInternalServerError)
 			return
 		}
-		h.stats.incrementHit()
+		h.stats.incrementRecord()
 	}
 
 	// Add to history log
+	h.addInteraction(interaction, outcome, startTime)
+
+	span.SetAttributes(attribute.Int("http.status_code", interaction.Response.StatusCode))
+
+	// Write response, unless recording already streamed it to the client
+	if !record || sw.status == 0 {
+		h.writeResponse(w, r, interaction.Response)
+	}
+}
+
+// requestTarget extracts and validates the target query parameter,
+// answering the client itself when it is unusable
+func requestTarget(w http.ResponseWriter, r *http.Request) (string, bool) {
+	// Extract target from query parameter
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, `{"error":"Missing 'target' query parameter"}`, http.StatusBadRequest)
+		return "", false
+	}
+
+	// Validate target URL; scheme-less targets such as host:port/path
+	// go out over https
+	check := target
+	if !strings.Contains(target, "://") {
+		check = "https://" + target
+	}
+	if _, err := url.Parse(check); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"Invalid target URL: %s"}`, err.Error()), http.StatusBadRequest)
+		return "", false
+	}
+
+	return target, true
+}
+
+// addInteraction logs a recorded or replayed interaction to the history
+func (h *ProxyHandler) addInteraction(interaction *models.Interaction, outcome string, startTime time.Time) {
 	h.AddToHistory(RequestHistoryEntry{
 		ID:        interaction.Request.GenerateHash(),
 		Timestamp: time.Now().Format(time.RFC3339),
@@ -147,25 +220,84 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Target:    interaction.Metadata.Target,
 		Status:    interaction.Response.StatusCode,
 		Duration:  time.Since(startTime).Milliseconds(),
-		Saved:     currentMode == "record", // In record mode, assume saved (could check if exists)
+		Outcome:   outcome,
+		Saved:     outcome == OutcomeRecorded, // In record mode, assume saved (could check if exists)
 	})
+}
 
-	// Write response
-	h.writeResponse(w, interaction.Response)
+// addMiss counts and logs a playback miss
+func (h *ProxyHandler) addMiss(missErr *mode.ErrNoRecording, target string, startTime time.Time) {
+	h.stats.incrementMiss()
+	h.AddToHistory(RequestHistoryEntry{
+		ID:        missErr.Hash,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Method:    missErr.Method,
+		URL:       missErr.URL,
+		Target:    target,
+		Status:    http.StatusNotFound,
+		Duration:  time.Since(startTime).Milliseconds(),
+		Outcome:   OutcomeMiss,
+	})
 }
 
-// handleRecord processes request in record mode
-func (h *ProxyHandler) handleRecord(r *http.Request, target string, body []byte) (*models.Interaction, error) {
-	return h.recorder.Handle(r, target, body)
+// handleRecord processes request in record mode, streaming the upstream
+// response to w as it arrives. Responses that record-phase rewrite rules
+// may change are left for the caller to write.
+func (h *ProxyHandler) handleRecord(w http.ResponseWriter, r *http.Request, target string, body *spool.Spool) (*models.Interaction, error) {
+	return h.recorder.Stream(w, r, target, body)
 }
 
 // handlePlayback processes request in playback mode
-func (h *ProxyHandler) handlePlayback(r *http.Request, target string, body []byte) (*models.Interaction, error) {
-	return h.player.Handle(r, target, body)
+func (h *ProxyHandler) handlePlayback(r *http.Request, target string, body *spool.Spool) (*models.Interaction, error) {
+	return h.player.HandleSpooled(r, target, body)
 }
 
-// writeResponse writes the recorded response to the client
-func (h *ProxyHandler) writeResponse(w http.ResponseWriter, resp models.RecordedResponse) {
+// writeResponse writes the recorded response to the client, encoding the
+// body to match the client's Accept-Encoding. Bodies stored as blobs are
+// streamed from disk.
+func (h *ProxyHandler) writeResponse(w http.ResponseWriter, r *http.Request, resp models.RecordedResponse) {
+	var body io.Reader
+	var length int64
+
+	if resp.BodyRef != "" {
+		blob, err := storage.WithContext(h.repository, r.Context()).OpenBlob(resp.BodyRef)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"Failed to open recorded body: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		defer blob.Close()
+		body = blob
+		length = resp.BodySize
+	} else {
+		// Recordings made before bodies were stored decoded
+		if err := resp.Decompress(); err != nil {
+			fmt.Printf("Warning: Replaying encoded body as recorded: %v\n", err)
+		}
+		body = bytes.NewReader(resp.Body)
+		length = int64(len(resp.Body))
+	}
+
+	// Only bodies the upstream compressed are compressed again, so
+	// uncompressed recordings replay byte for byte. Blobs are encoded
+	// while streaming, so their encoded length isn't known up front.
+	encoding := compression.Identity
+	if resp.ContentEncoding != "" {
+		encoding = compression.Negotiate(r.Header.Get("Accept-Encoding"), resp.ContentEncoding)
+		if encoding != compression.Identity && resp.BodyRef == "" {
+			if encoded, err := compression.Encode(encoding, resp.Body); err == nil {
+				body = bytes.NewReader(encoded)
+				length = int64(len(encoded))
+			} else {
+				encoding = compression.Identity
+			}
+		}
+	}
+	streamEncode := encoding != compression.Identity && resp.BodyRef != ""
+
+	// Streamed recordings are replayed chunk by chunk, so like the
+	// original they carry no length
+	chunked := len(resp.Chunks) > 0 && encoding == compression.Identity
+
 	// Copy headers
 	for key, values := range resp.Headers {
 		for _, value := range values {
@@ -173,13 +305,80 @@ func (h *ProxyHandler) writeResponse(w http.ResponseWriter, resp models.Recorded
 		}
 	}
 
+	// Never replay transport artifacts from the recording; length and
+	// framing always describe the bytes actually sent (HEAD responses keep
+	// the recorded length of the body they omit)
+	mode.RemoveHopByHopHeaders(w.Header())
+	if streamEncode || chunked {
+		w.Header().Del("Content-Length")
+	} else if r.Method != http.MethodHead && bodyAllowed(resp.StatusCode) {
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	if encoding != compression.Identity {
+		w.Header().Set("Content-Encoding", encoding)
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+
 	// Write status code
 	w.WriteHeader(resp.StatusCode)
 
 	// Write body if present
-	if resp.Body != nil {
-		w.Write(resp.Body)
+	if length == 0 || r.Method == http.MethodHead {
+		return
+	}
+	if chunked {
+		h.writeChunks(w, r, body, resp.Chunks)
+		return
+	}
+	if !streamEncode {
+		io.Copy(w, body)
+		return
+	}
+	encoder, err := compression.NewWriter(encoding, w)
+	if err != nil {
+		return
+	}
+	if _, err := io.Copy(encoder, body); err != nil {
+		fmt.Printf("Warning: Failed to stream recorded body: %v\n", err)
+	}
+	encoder.Close()
+}
+
+// writeChunks replays a streamed body with the recorded gaps between
+// chunks, scaled by playback.timing_scale, flushing each one
+func (h *ProxyHandler) writeChunks(w http.ResponseWriter, r *http.Request, body io.Reader, chunks []models.Chunk) {
+	scale := h.config.PlaybackSettings().TimingScale
+	flusher, _ := w.(http.Flusher)
+	start := time.Now()
+
+	for _, chunk := range chunks {
+		due := time.Duration(float64(chunk.OffsetMS) * scale * float64(time.Millisecond))
+		if wait := due - time.Since(start); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-r.Context().Done():
+				// Client went away
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		if _, err := io.CopyN(w, body, chunk.Size); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
 	}
+
+	// Anything the chunks don't cover
+	io.Copy(w, body)
+}
+
+// bodyAllowed reports whether a status code may carry a body
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
 }
 
 // GetStatistics returns current statistics
@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pismo/testing-proxy/internal/compression"
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+func TestWriteResponse(t *testing.T) {
+	h := NewProxyHandler(config.New(), nil)
+
+	t.Run("Strips transport headers and fixes length", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.writeResponse(rec, httptest.NewRequest("GET", "/", nil), models.RecordedResponse{
+			StatusCode: 200,
+			Headers: map[string][]string{
+				"Transfer-Encoding": {"chunked"},
+				"Content-Length":    {"999"},
+				"Connection":        {"close"},
+				"Content-Type":      {"text/plain"},
+			},
+			Body: []byte("hello"),
+		})
+
+		if rec.Header().Get("Transfer-Encoding") != "" || rec.Header().Get("Connection") != "" {
+			t.Errorf("Hop-by-hop headers replayed: %v", rec.Header())
+		}
+		if rec.Header().Get("Content-Length") != "5" {
+			t.Errorf("Expected Content-Length 5, got %s", rec.Header().Get("Content-Length"))
+		}
+		if rec.Body.String() != "hello" {
+			t.Errorf("Unexpected body %q", rec.Body.String())
+		}
+	})
+
+	t.Run("Re-encodes for the client", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+
+		rec := httptest.NewRecorder()
+		h.writeResponse(rec, req, models.RecordedResponse{
+			StatusCode:      200,
+			Headers:         map[string][]string{},
+			Body:            []byte("hello"),
+			ContentEncoding: "br",
+		})
+
+		if rec.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("Expected gzip, got %q", rec.Header().Get("Content-Encoding"))
+		}
+		decoded, err := compression.Decode("gzip", rec.Body.Bytes())
+		if err != nil || string(decoded) != "hello" {
+			t.Errorf("Body did not round trip: %q %v", decoded, err)
+		}
+	})
+
+	t.Run("Identity when client accepts nothing", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.writeResponse(rec, httptest.NewRequest("GET", "/", nil), models.RecordedResponse{
+			StatusCode:      200,
+			Headers:         map[string][]string{},
+			Body:            []byte("hello"),
+			ContentEncoding: "gzip",
+		})
+
+		if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "hello" {
+			t.Errorf("Expected identity body, got %q (%s)", rec.Body.String(), rec.Header().Get("Content-Encoding"))
+		}
+	})
+
+	t.Run("Legacy encoded recording", func(t *testing.T) {
+		encoded, _ := compression.Encode(compression.Gzip, []byte("legacy"))
+
+		rec := httptest.NewRecorder()
+		h.writeResponse(rec, httptest.NewRequest("GET", "/", nil), models.RecordedResponse{
+			StatusCode: http.StatusOK,
+			Headers:    map[string][]string{"Content-Encoding": {"gzip"}},
+			Body:       encoded,
+		})
+
+		if rec.Body.String() != "legacy" {
+			t.Errorf("Expected decoded legacy body, got %q", rec.Body.String())
+		}
+	})
+
+	t.Run("Streams blob bodies", func(t *testing.T) {
+		repo, err := storage.NewFileSystemRepository(t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to create repository: %v", err)
+		}
+		h := NewProxyHandler(config.New(), repo)
+
+		body := strings.Repeat("large ", 1000)
+		ref, size, err := repo.SaveBlob(strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to save blob: %v", err)
+		}
+		resp := models.RecordedResponse{
+			StatusCode:      http.StatusOK,
+			Headers:         map[string][]string{},
+			BodyRef:         ref,
+			BodySize:        size,
+			ContentEncoding: "gzip",
+		}
+
+		rec := httptest.NewRecorder()
+		h.writeResponse(rec, httptest.NewRequest("GET", "/", nil), resp)
+		if rec.Body.String() != body || rec.Header().Get("Content-Length") != strconv.FormatInt(size, 10) {
+			t.Errorf("Expected %d identity bytes, got %d (Content-Length %s)", size, rec.Body.Len(), rec.Header().Get("Content-Length"))
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec = httptest.NewRecorder()
+		h.writeResponse(rec, req, resp)
+		decoded, err := compression.Decode(rec.Header().Get("Content-Encoding"), rec.Body.Bytes())
+		if err != nil || string(decoded) != body {
+			t.Errorf("Encoded blob did not round trip: %v", err)
+		}
+	})
+
+	t.Run("Replays chunks with scaled timing", func(t *testing.T) {
+		resp := models.RecordedResponse{
+			StatusCode: http.StatusOK,
+			Headers:    map[string][]string{"Content-Type": {"text/event-stream"}},
+			Body:       []byte("data: a\n\ndata: b\n\n"),
+			Chunks:     []models.Chunk{{OffsetMS: 0, Size: 9}, {OffsetMS: 100, Size: 9}},
+		}
+
+		for _, scale := range []float64{1, 0} {
+			cfg := config.New()
+			cfg.Playback.TimingScale = scale
+			h := NewProxyHandler(cfg, nil)
+
+			rec := httptest.NewRecorder()
+			start := time.Now()
+			h.writeResponse(rec, httptest.NewRequest("GET", "/", nil), resp)
+			elapsed := time.Since(start)
+
+			if rec.Body.String() != string(resp.Body) {
+				t.Errorf("Scale %v: unexpected body %q", scale, rec.Body.String())
+			}
+			if rec.Header().Get("Content-Length") != "" {
+				t.Errorf("Scale %v: streamed replay should not set Content-Length", scale)
+			}
+			if scale == 1 && elapsed < 100*time.Millisecond {
+				t.Errorf("Expected original timing, finished in %v", elapsed)
+			}
+			if scale == 0 && elapsed > 50*time.Millisecond {
+				t.Errorf("Expected no delay, took %v", elapsed)
+			}
+		}
+	})
+}
+
+func TestHybridMode(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("rate " + strconv.Itoa(calls)))
+	}))
+	defer upstream.Close()
+
+	repo, err := storage.NewFileSystemRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	cfg := config.New()
+	cfg.SetMode("hybrid")
+	host := strings.TrimPrefix(upstream.URL, "http://")
+	cfg.Upstreams = map[string]config.UpstreamConfig{host: {TTL: "1h"}}
+	h := NewProxyHandler(cfg, repo)
+	management := NewManagementHandler(cfg, repo, h)
+
+	get := func() string {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/proxy?target="+upstream.URL+"/rates", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+
+	t.Run("Records a miss, then replays it", func(t *testing.T) {
+		if got := get(); got != "rate 1" {
+			t.Errorf("Expected the upstream response, got %q", got)
+		}
+		if got := get(); got != "rate 1" || calls != 1 {
+			t.Errorf("Expected a replay, got %q after %d calls", got, calls)
+		}
+	})
+
+	interactions, _ := repo.FindAll()
+	stale := interactions[0]
+	stale.Timestamp = time.Now().Add(-2 * time.Hour)
+	repo.Save(stale)
+
+	t.Run("Admin API flags stale recordings", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		management.HandleRecordings(rec, httptest.NewRequest("GET", "/admin/recordings?stale=true", nil))
+		if !strings.Contains(rec.Body.String(), `"stale":true`) || !strings.Contains(rec.Body.String(), `"count":1`) {
+			t.Errorf("Expected one stale recording: %s", rec.Body.String())
+		}
+	})
+
+	t.Run("Playback still serves stale recordings", func(t *testing.T) {
+		cfg.SetMode("playback")
+		defer cfg.SetMode("hybrid")
+		if got := get(); got != "rate 1" {
+			t.Errorf("Expected the stale recording, got %q", got)
+		}
+	})
+
+	t.Run("Re-records stale recordings", func(t *testing.T) {
+		stale.MaxAge = 60
+		repo.Save(stale)
+
+		if got := get(); got != "rate 2" {
+			t.Errorf("Expected a fresh upstream response, got %q", got)
+		}
+		refreshed, _ := repo.Find(stale.Request.GenerateHash())
+		if refreshed.MaxAge != 60 || time.Since(refreshed.Timestamp) > time.Minute {
+			t.Errorf("Expected a fresh recording keeping max_age, got %d at %v", refreshed.MaxAge, refreshed.Timestamp)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pismo/testing-proxy/internal/diff"
+	"github.com/pismo/testing-proxy/internal/mode"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/rewrite"
+)
+
+// HandleRewritePreview shows what rewrite rules do to a recording's
+// response. GET uses the rules configured for its target; POST tries the
+// rules in the body ({"rules": [...]}) instead. Every rule is applied
+// whatever its phase, and the recording is not changed.
+func (h *ManagementHandler) HandleRewritePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, `{"error":"Missing recording ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	interaction, err := h.repository.Find(id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"Recording not found: %s"}`, err.Error()), http.StatusNotFound)
+		return
+	}
+
+	rules := mode.RewriteRules(h.config, interaction)
+	if r.Method == http.MethodPost {
+		var request struct {
+			Rules []rewrite.Rule `json:"rules"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"Invalid rules: %s"}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		rules = request.Rules
+	}
+	if rules == nil {
+		rules = []rewrite.Rule{}
+	}
+
+	rewritten, err := rewrite.Preview(rules, interaction.Response)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"Invalid rules: %s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       id,
+		"rules":    rules,
+		"response": rewritten,
+		"diff":     diff.Unified("recorded", "rewritten", renderResponse(interaction.Response), renderResponse(rewritten), 3),
+	})
+}
+
+// renderResponse writes a response as status, headers and body text for
+// diffing
+func renderResponse(resp models.RecordedResponse) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%d %s\n", resp.StatusCode, http.StatusText(resp.StatusCode))
+
+	keys := make([]string, 0, len(resp.Headers))
+	for key := range resp.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range resp.Headers[key] {
+			fmt.Fprintf(&out, "%s: %s\n", key, value)
+		}
+	}
+
+	out.WriteString("\n")
+	if resp.BodyRef != "" {
+		fmt.Fprintf(&out, "(body stored as blob %s)\n", resp.BodyRef)
+	} else {
+		out.Write(resp.Body)
+	}
+	return out.String()
+}
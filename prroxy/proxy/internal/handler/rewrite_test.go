@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/rewrite"
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+func TestRewriteRules(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Served-By", "prod-7")
+		w.Write([]byte(`{"url":"https://jsonplaceholder.typicode.com/users/1"}`))
+	}))
+	defer upstream.Close()
+
+	repo, err := storage.NewFileSystemRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	cfg := config.New()
+	cfg.SetMode("record")
+	host := strings.TrimPrefix(upstream.URL, "http://")
+	cfg.Upstreams = map[string]config.UpstreamConfig{host: {Rewrite: []rewrite.Rule{
+		{Path: "$.url", Match: `https://[^/]+`, Replace: "http://api.local"},
+		{Apply: rewrite.Playback, Header: "X-Served-By", Replace: "proxy"},
+	}}}
+	h := NewProxyHandler(cfg, repo)
+	management := NewManagementHandler(cfg, repo, h)
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/proxy?target="+upstream.URL+"/users/1", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+	recording := get()
+
+	interactions, _ := repo.FindAll()
+	if len(interactions) != 1 {
+		t.Fatalf("Expected 1 recording, got %d", len(interactions))
+	}
+	recorded := interactions[0]
+	id := recorded.Request.GenerateHash()
+
+	t.Run("Record rules are persisted", func(t *testing.T) {
+		if string(recorded.Response.Body) != `{"url":"http://api.local/users/1"}` {
+			t.Errorf("Expected the rewritten body to be stored, got %s", recorded.Response.Body)
+		}
+		if recorded.Response.Headers["X-Served-By"][0] != "prod-7" {
+			t.Errorf("Expected playback rules not to be persisted")
+		}
+	})
+
+	t.Run("Record rules apply to the recording client too", func(t *testing.T) {
+		if recording.Body.String() != `{"url":"http://api.local/users/1"}` {
+			t.Errorf("Expected the rewritten body, got %s", recording.Body.String())
+		}
+		if recording.Header().Get("Content-Length") != strconv.Itoa(recording.Body.Len()) {
+			t.Errorf("Expected the rewritten length, got %q", recording.Header().Get("Content-Length"))
+		}
+		if recording.Header().Get("X-Served-By") != "prod-7" {
+			t.Errorf("Expected playback rules not to apply while recording")
+		}
+	})
+
+	t.Run("Playback rules apply on the fly", func(t *testing.T) {
+		cfg.SetMode("playback")
+		rec := get()
+		if rec.Header().Get("X-Served-By") != "proxy" {
+			t.Errorf("Expected the rewritten header, got %q", rec.Header().Get("X-Served-By"))
+		}
+		if rec.Body.String() != `{"url":"http://api.local/users/1"}` {
+			t.Errorf("Unexpected body: %s", rec.Body.String())
+		}
+		stored, _ := repo.Find(id)
+		if stored.Response.Headers["X-Served-By"][0] != "prod-7" {
+			t.Errorf("Playback changed the recording")
+		}
+	})
+
+	t.Run("Preview shows configured or posted rules", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		management.HandleRewritePreview(rec, httptest.NewRequest("GET", "/admin/rewrite/preview?id="+id, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `+X-Served-By: proxy`) {
+			t.Errorf("Expected the header change in the diff: %d %s", rec.Code, rec.Body.String())
+		}
+
+		rec = httptest.NewRecorder()
+		body := strings.NewReader(`{"rules":[{"path":"$.url","replace":"redacted"}]}`)
+		management.HandleRewritePreview(rec, httptest.NewRequest("POST", "/admin/rewrite/preview?id="+id, body))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `+{\"url\":\"redacted\"}`) {
+			t.Errorf("Expected the posted rule in the diff: %d %s", rec.Code, rec.Body.String())
+		}
+
+		rec = httptest.NewRecorder()
+		body = strings.NewReader(`{"rules":[{"match":"("}]}`)
+		management.HandleRewritePreview(rec, httptest.NewRequest("POST", "/admin/rewrite/preview?id="+id, body))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for an invalid rule, got %d", rec.Code)
+		}
+	})
+}
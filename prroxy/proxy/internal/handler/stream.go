@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+// streamHeartbeat keeps idle SSE connections open through proxies
+const streamHeartbeat = 15 * time.Second
+
+// streamFilter selects which request events a subscriber receives.
+// Mode events are always delivered.
+type streamFilter struct {
+	target  string
+	status  string // Exact code ("404") or class ("4xx")
+	outcome string
+}
+
+// parseStreamFilter reads filter parameters from the query string
+func parseStreamFilter(r *http.Request) streamFilter {
+	query := r.URL.Query()
+	return streamFilter{
+		target:  query.Get("target"),
+		status:  strings.ToLower(query.Get("status")),
+		outcome: query.Get("outcome"),
+	}
+}
+
+// matches reports whether an event passes the filter
+func (f streamFilter) matches(event Event) bool {
+	if event.Entry == nil {
+		return true
+	}
+	entry := event.Entry
+
+	if f.target != "" && !storage.MatchTarget(entry.Target, f.target) {
+		return false
+	}
+	if f.outcome != "" && entry.Outcome != f.outcome {
+		return false
+	}
+	if f.status != "" {
+		code := strconv.Itoa(entry.Status)
+		if strings.HasSuffix(f.status, "xx") {
+			if len(f.status) != 3 || code[:1] != f.status[:1] {
+				return false
+			}
+		} else if code != f.status {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HandleStream pushes history entries, misses and mode changes as
+// Server-Sent Events. Filters: ?target=, ?status=, ?outcome=.
+// Reconnecting clients resume from the Last-Event-ID header.
+func (h *ManagementHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `{"error":"Streaming not supported"}`, http.StatusInternalServerError)
+		return
+	}
+
+	filter := parseStreamFilter(r)
+
+	// Subscribe before replaying so nothing is lost in between
+	events := h.proxy.Events().Subscribe()
+	defer h.proxy.Events().Unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// Replay anything the client missed while disconnected
+	var lastSeq int64
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		if seq, err := strconv.ParseInt(lastID, 10, 64); err == nil {
+			for _, entry := range h.proxy.History().Since(seq) {
+				entry := entry
+				eventType := EventRequest
+				if entry.Outcome == OutcomeMiss {
+					eventType = EventMiss
+				}
+				event := Event{Type: eventType, Entry: &entry}
+				if filter.matches(event) {
+					writeEvent(w, event)
+				}
+				lastSeq = entry.Seq
+			}
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			// Skip entries already sent during replay
+			if event.Entry != nil && event.Entry.Seq <= lastSeq {
+				continue
+			}
+			if !filter.matches(event) {
+				continue
+			}
+			writeEvent(w, event)
+			flusher.Flush()
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent writes a single SSE frame. History entries carry their
+// sequence number as the event ID so clients can resume.
+func writeEvent(w http.ResponseWriter, event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	if event.Entry != nil {
+		fmt.Fprintf(w, "id: %d\n", event.Entry.Seq)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pismo/testing-proxy/internal/diff"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+// currentVersion names the live recording in diff requests
+const currentVersion = "current"
+
+// versioner returns the repository's history support, writing an error
+// when it has none
+func (h *ManagementHandler) versioner(w http.ResponseWriter) (storage.Versioner, bool) {
+	versioner, ok := h.repository.(storage.Versioner)
+	if !ok {
+		http.Error(w, `{"error":"Recording history is not supported by this storage"}`, http.StatusNotImplemented)
+	}
+	return versioner, ok
+}
+
+// HandleRecordingHistory lists the previous versions of a recording
+func (h *ManagementHandler) HandleRecordingHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, `{"error":"Missing recording ID"}`, http.StatusBadRequest)
+		return
+	}
+	versioner, ok := h.versioner(w)
+	if !ok {
+		return
+	}
+
+	versions, err := versioner.History(id)
+	if err != nil {
+		if _, ok := err.(storage.ErrInvalidHash); ok {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, fmt.Sprintf(`{"error":"Failed to read history: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	// A quarantined recording can still have history to roll back to
+	var current *storage.Version
+	if interaction, err := h.repository.Find(id); err == nil {
+		current = &storage.Version{
+			Timestamp: interaction.Timestamp,
+			Status:    interaction.Response.StatusCode,
+		}
+	} else if len(versions) == 0 {
+		http.Error(w, fmt.Sprintf(`{"error":"Recording not found: %s"}`, err.Error()), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       id,
+		"current":  current,
+		"versions": versions,
+	})
+}
+
+// HandleRecordingDiff compares two versions of a recording as a unified
+// diff of their readable form. from defaults to the newest previous
+// version and to defaults to the current recording.
+func (h *ManagementHandler) HandleRecordingDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, `{"error":"Missing recording ID"}`, http.StatusBadRequest)
+		return
+	}
+	versioner, ok := h.versioner(w)
+	if !ok {
+		return
+	}
+
+	from := r.URL.Query().Get("from")
+	if from == "" {
+		versions, err := versioner.History(id)
+		if err != nil {
+			if _, ok := err.(storage.ErrInvalidHash); ok {
+				http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf(`{"error":"Failed to read history: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		if len(versions) == 0 {
+			http.Error(w, `{"error":"Recording has no previous versions"}`, http.StatusNotFound)
+			return
+		}
+		from = strconv.Itoa(versions[0].Number)
+	}
+	to := r.URL.Query().Get("to")
+	if to == "" {
+		to = currentVersion
+	}
+
+	texts := make([]string, 2)
+	for i, name := range []string{from, to} {
+		interaction, ok := h.findVersion(w, versioner, id, name)
+		if !ok {
+			return
+		}
+		data, err := storage.MarshalReadable(interaction)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"Failed to render recording: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		texts[i] = string(data)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":   id,
+		"from": from,
+		"to":   to,
+		"diff": diff.Unified(from, to, texts[0], texts[1], 3),
+	})
+}
+
+// findVersion loads a version by number, or the current recording,
+// writing an error when it can't
+func (h *ManagementHandler) findVersion(w http.ResponseWriter, versioner storage.Versioner, id, name string) (*models.Interaction, bool) {
+	if name == currentVersion {
+		interaction, err := h.repository.Find(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"Recording not found: %s"}`, err.Error()), http.StatusNotFound)
+			return nil, false
+		}
+		return interaction, true
+	}
+
+	number, err := strconv.Atoi(name)
+	if err != nil || number < 1 {
+		http.Error(w, fmt.Sprintf(`{"error":"Invalid version: %s"}`, name), http.StatusBadRequest)
+		return nil, false
+	}
+	interaction, err := versioner.Version(id, number)
+	if err != nil {
+		if _, ok := err.(storage.ErrVersionNotFound); ok {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusNotFound)
+			return nil, false
+		}
+		if _, ok := err.(storage.ErrInvalidHash); ok {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+			return nil, false
+		}
+		http.Error(w, fmt.Sprintf(`{"error":"Failed to read version: %s"}`, err.Error()), http.StatusInternalServerError)
+		return nil, false
+	}
+	return interaction, true
+}
+
+// HandleRecordingRollback makes a previous version current again. The
+// version it replaces is kept in the history, so a rollback can be undone.
+func (h *ManagementHandler) HandleRecordingRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, `{"error":"Missing recording ID"}`, http.StatusBadRequest)
+		return
+	}
+	number, err := strconv.Atoi(r.URL.Query().Get("version"))
+	if err != nil || number < 1 {
+		http.Error(w, `{"error":"Invalid or missing 'version' query parameter"}`, http.StatusBadRequest)
+		return
+	}
+	versioner, ok := h.versioner(w)
+	if !ok {
+		return
+	}
+
+	interaction, err := versioner.Rollback(id, number)
+	if err != nil {
+		if _, ok := err.(storage.ErrVersionNotFound); ok {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusNotFound)
+			return
+		}
+		if _, ok := err.(storage.ErrInvalidHash); ok {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, fmt.Sprintf(`{"error":"Failed to roll back recording: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   "Recording rolled back successfully",
+		"id":        id,
+		"version":   number,
+		"recording": interaction,
+	})
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+func TestRecordingVersions(t *testing.T) {
+	fsRepo, err := storage.NewFileSystemRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	repo := storage.NewTracedRepository(fsRepo)
+	cfg := config.New()
+	management := NewManagementHandler(cfg, repo, NewProxyHandler(cfg, repo))
+
+	interaction := &models.Interaction{
+		Request:  models.RecordedRequest{Method: "GET", URL: "/users"},
+		Response: models.RecordedResponse{StatusCode: 200, Body: []byte(`{"name":"Alice"}`)},
+		Metadata: models.InteractionMetadata{Target: "api.example.com"},
+	}
+	repo.Save(interaction)
+	interaction.Response.Body = []byte(`{"name":"Bob"}`)
+	repo.Save(interaction)
+	id := interaction.Request.GenerateHash()
+
+	serve := func(handler http.HandlerFunc, method, url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(method, url, nil))
+		return rec
+	}
+
+	t.Run("History lists previous versions", func(t *testing.T) {
+		rec := serve(management.HandleRecordingHistory, "GET", "/admin/recording/history?id="+id)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), `"version":1`) || !strings.Contains(rec.Body.String(), `"current":{`) {
+			t.Errorf("Expected version 1 and the current recording: %s", rec.Body.String())
+		}
+	})
+
+	t.Run("Diff defaults to the newest version against current", func(t *testing.T) {
+		rec := serve(management.HandleRecordingDiff, "GET", "/admin/recording/diff?id="+id)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, `-      \"name\": \"Alice\"`) || !strings.Contains(body, `+      \"name\": \"Bob\"`) {
+			t.Errorf("Expected the body change in the diff: %s", body)
+		}
+	})
+
+	t.Run("Unknown versions are not found", func(t *testing.T) {
+		if rec := serve(management.HandleRecordingDiff, "GET", "/admin/recording/diff?id="+id+"&from=9"); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", rec.Code)
+		}
+		if rec := serve(management.HandleRecordingRollback, "POST", "/admin/recording/rollback?id="+id+"&version=9"); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", rec.Code)
+		}
+		if rec := serve(management.HandleRecordingRollback, "POST", "/admin/recording/rollback?id="+id); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Rollback restores the old version", func(t *testing.T) {
+		if rec := serve(management.HandleRecordingRollback, "GET", "/admin/recording/rollback?id="+id+"&version=1"); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected 405 for GET, got %d", rec.Code)
+		}
+		rec := serve(management.HandleRecordingRollback, "POST", "/admin/recording/rollback?id="+id+"&version=1")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		current, _ := repo.Find(id)
+		if string(current.Response.Body) != `{"name":"Alice"}` {
+			t.Errorf("Expected the old body, got %s", current.Response.Body)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/pismo/testing-proxy/internal/mode"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/tracing"
+)
+
+// serveWebSocket tunnels and records an upgraded connection in record
+// mode, and replays the recorded session in playback mode
+func (h *ProxyHandler) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "ProxyHandler.ServeWebSocket",
+		attribute.String("http.target", r.URL.Path),
+	)
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	target, ok := requestTarget(w, r)
+	if !ok {
+		return
+	}
+
+	currentMode := h.config.GetMode()
+	span.SetAttributes(
+		attribute.String("proxy.target", target),
+		attribute.String("proxy.mode", currentMode),
+	)
+	startTime := time.Now()
+
+	var interaction *models.Interaction
+	record := currentMode == "record"
+
+	if !record {
+		var err error
+		interaction, err = h.player.Handle(r, target, nil)
+		missErr, miss := err.(*mode.ErrNoRecording)
+		switch {
+		case miss && currentMode == mode.Hybrid:
+			record = true
+		case miss:
+			span.SetAttributes(attribute.String("proxy.outcome", OutcomeMiss))
+			h.addMiss(missErr, target, startTime)
+			http.Error(w, fmt.Sprintf(`{"error":"No recording found: %s"}`, err.Error()), http.StatusNotFound)
+			return
+		case err != nil:
+			tracing.RecordError(span, err)
+			http.Error(w, fmt.Sprintf(`{"error":"Playback failed: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if record {
+		sw := &statusRecorder{ResponseWriter: w}
+		interaction, err := h.recorder.HandleWebSocket(sw, r, target)
+		if err != nil {
+			tracing.RecordError(span, err)
+			if sw.status != 0 {
+				fmt.Printf("Warning: WebSocket session failed: %v\n", err)
+				return
+			}
+			http.Error(w, fmt.Sprintf(`{"error":"Record failed: %s"}`, err.Error()), http.StatusBadGateway)
+			return
+		}
+		h.stats.incrementRecord()
+		h.addInteraction(interaction, OutcomeRecorded, startTime)
+		return
+	}
+
+	h.stats.incrementHit()
+	h.addInteraction(interaction, OutcomeHit, startTime)
+
+	// The upstream refused the upgrade when this was recorded
+	if interaction.WebSocket == nil {
+		h.writeResponse(w, r, interaction.Response)
+		return
+	}
+
+	scale := h.config.PlaybackSettings().TimingScale
+	if err := h.player.ReplayWebSocket(w, r, interaction, scale); err != nil {
+		tracing.RecordError(span, err)
+		fmt.Printf("Warning: WebSocket replay failed: %v\n", err)
+	}
+}
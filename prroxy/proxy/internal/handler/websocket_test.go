@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+func TestWebSocketRecordAndReplay(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte("welcome"))
+		for {
+			opcode, payload, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(opcode, append([]byte("echo: "), payload...))
+		}
+	}))
+
+	repo, err := storage.NewFileSystemRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	cfg := config.New()
+	cfg.SetMode("record")
+	cfg.Playback.TimingScale = 0
+	proxy := httptest.NewServer(NewProxyHandler(cfg, repo))
+	defer proxy.Close()
+
+	proxyURL := "ws" + strings.TrimPrefix(proxy.URL, "http") + "/socket?target=ws" + strings.TrimPrefix(upstream.URL, "http") + "/socket"
+
+	// converse sends each message and returns the replies, after the greeting
+	converse := func(messages ...string) []string {
+		conn, _, err := websocket.DefaultDialer.Dial(proxyURL, nil)
+		if err != nil {
+			t.Fatalf("Failed to dial proxy: %v", err)
+		}
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, greeting, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read greeting: %v", err)
+		}
+		replies := []string{string(greeting)}
+		for _, message := range messages {
+			conn.WriteMessage(websocket.TextMessage, []byte(message))
+			_, reply, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("Failed to read reply to %q: %v", message, err)
+			}
+			replies = append(replies, string(reply))
+		}
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		return replies
+	}
+
+	recorded := converse("one", "two")
+	if strings.Join(recorded, ",") != "welcome,echo: one,echo: two" {
+		t.Fatalf("Unexpected replies while recording: %v", recorded)
+	}
+
+	// The session is saved once both sides have closed
+	var interactions []*models.Interaction
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if interactions, _ = repo.FindAll(); len(interactions) == 1 {
+			break
+		}
+	}
+	if len(interactions) != 1 || interactions[0].WebSocket == nil {
+		t.Fatalf("Expected one recorded WebSocket session, got %d", len(interactions))
+	}
+	frames := interactions[0].WebSocket.Frames
+	if len(frames) < 5 || frames[0].Direction != models.FromServer || frames[1].Direction != models.FromClient {
+		t.Errorf("Unexpected frames: %+v", frames)
+	}
+
+	t.Run("Replays without the upstream", func(t *testing.T) {
+		upstream.Close()
+		cfg.SetMode("playback")
+
+		// Out of order: each frame is matched to its recorded reply
+		replayed := converse("two", "one")
+		if strings.Join(replayed, ",") != "welcome,echo: two,echo: one" {
+			t.Errorf("Unexpected replies on playback: %v", replayed)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package mode
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pismo/testing-proxy/internal/compression"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/spool"
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+// hashSpooledRequest computes the request hash without loading the body
+// into memory; it matches RecordedRequest.GenerateHash for the same body
+func hashSpooledRequest(req *models.RecordedRequest, body *spool.Spool) (string, error) {
+	// Multipart requests hash their parts, not the raw bytes
+	if req.Multipart != nil {
+		return req.GenerateHash(), nil
+	}
+
+	reader, err := body.Open()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	h := models.NewRequestHasher(req.Method, req.URL)
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", fmt.Errorf("failed to hash request body: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// storeRequestBody saves a spilled request body as a blob
+func storeRequestBody(repository storage.Repository, req *models.RecordedRequest, body *spool.Spool) error {
+	hash, err := hashSpooledRequest(req, body)
+	if err != nil {
+		return err
+	}
+
+	reader, err := body.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	ref, size, err := repository.SaveBlob(reader)
+	if err != nil {
+		return fmt.Errorf("failed to store request body: %w", err)
+	}
+
+	req.Body = nil
+	req.BodyRef = ref
+	req.BodySize = size
+	req.BodyHash = hash
+	return nil
+}
+
+// storeResponseBody sets the response body from the spool, decoded like
+// Decompress does. Bodies still over the threshold once decoded are saved
+// as blobs; the rest stay inline.
+func storeResponseBody(repository storage.Repository, resp *models.RecordedResponse, body *spool.Spool, threshold int64) error {
+	headers := http.Header(resp.Headers)
+
+	if encoding := headers.Get("Content-Encoding"); encoding != "" {
+		decoded, err := decodeSpool(encoding, body, threshold)
+		if err != nil {
+			fmt.Printf("Warning: Storing encoded response body: %v\n", err)
+		} else {
+			defer decoded.Close()
+			body = decoded
+			resp.ContentEncoding = encoding
+			headers.Del("Content-Encoding")
+			headers.Del("Content-Length")
+		}
+	}
+
+	if body.InMemory() {
+		resp.Body = body.Bytes()
+		return nil
+	}
+
+	reader, err := body.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	ref, size, err := repository.SaveBlob(reader)
+	if err != nil {
+		return fmt.Errorf("failed to store response body: %w", err)
+	}
+	resp.BodyRef = ref
+	resp.BodySize = size
+	return nil
+}
+
+// decodeSpool streams the spool through a decoder into a new spool
+func decodeSpool(encoding string, body *spool.Spool, threshold int64) (*spool.Spool, error) {
+	reader, err := body.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decoder, err := compression.NewDecoder(encoding, reader)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+
+	decoded, err := spool.Read(decoder, threshold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s body: %w", encoding, err)
+	}
+	return decoded, nil
+}
+
+// relayResponse writes the upstream response to the client as it is read.
+// The body is passed through as the upstream encoded it when the client
+// accepts that coding, and decoded on the fly when it does not.
+func relayResponse(w http.ResponseWriter, req *http.Request, resp *http.Response, body io.Reader) error {
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	RemoveHopByHopHeaders(w.Header())
+
+	src := body
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" {
+		accepted := compression.Negotiate(req.Header.Get("Accept-Encoding"), encoding)
+		if accepted != strings.ToLower(strings.TrimSpace(encoding)) {
+			if decoder, err := compression.NewDecoder(encoding, body); err == nil {
+				defer decoder.Close()
+				src = decoder
+				w.Header().Del("Content-Encoding")
+				w.Header().Del("Content-Length")
+			}
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+
+	if _, err := io.Copy(flushWriter{w}, src); err != nil {
+		return err
+	}
+
+	// A decoder may stop before the end of the stream; drain the rest so
+	// the recording is complete
+	_, err := io.Copy(io.Discard, body)
+	return err
+}
+
+// flushWriter pushes every write to the client straight away
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,93 @@
+package mode
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+// streamBoundary returns a function finding the end of the first complete
+// unit (SSE event or NDJSON line) in a streamed body, or nil when the
+// response isn't a stream worth chunking. Encoded streams are recorded as
+// plain bodies since chunk sizes describe the decoded bytes.
+func streamBoundary(header http.Header) func([]byte) int {
+	if header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch mediaType {
+	case "text/event-stream":
+		return sseBoundary
+	case "application/x-ndjson", "application/ndjson", "application/jsonl",
+		"application/x-jsonlines", "application/stream+json":
+		return lineBoundary
+	default:
+		return nil
+	}
+}
+
+// sseBoundary finds the blank line that ends an SSE event
+func sseBoundary(buf []byte) int {
+	end := -1
+	if i := bytes.Index(buf, []byte("\n\n")); i >= 0 {
+		end = i + 2
+	}
+	if i := bytes.Index(buf, []byte("\r\n\r\n")); i >= 0 && (end < 0 || i+4 < end) {
+		end = i + 4
+	}
+	return end
+}
+
+// lineBoundary finds the newline that ends an NDJSON record
+func lineBoundary(buf []byte) int {
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		return i + 1
+	}
+	return -1
+}
+
+// chunkRecorder notes when each unit of a streamed body arrives. Only the
+// unit currently being received is buffered.
+type chunkRecorder struct {
+	start    time.Time
+	boundary func([]byte) int
+	pending  []byte
+	chunks   []models.Chunk
+}
+
+func newChunkRecorder(boundary func([]byte) int) *chunkRecorder {
+	return &chunkRecorder{start: time.Now(), boundary: boundary}
+}
+
+func (c *chunkRecorder) Write(p []byte) (int, error) {
+	c.pending = append(c.pending, p...)
+	for {
+		end := c.boundary(c.pending)
+		if end < 0 {
+			break
+		}
+		c.add(int64(end))
+		c.pending = c.pending[end:]
+	}
+	return len(p), nil
+}
+
+func (c *chunkRecorder) add(size int64) {
+	c.chunks = append(c.chunks, models.Chunk{
+		OffsetMS: time.Since(c.start).Milliseconds(),
+		Size:     size,
+	})
+}
+
+// finish records any trailing partial unit and returns the chunks
+func (c *chunkRecorder) finish() []models.Chunk {
+	if len(c.pending) > 0 {
+		c.add(int64(len(c.pending)))
+		c.pending = nil
+	}
+	return c.chunks
+}
@@ -0,0 +1,36 @@
+package mode
+
+import (
+	"time"
+
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+// Hybrid plays back what is recorded and records what is missing or stale
+const Hybrid = "hybrid"
+
+// ExpiresAt returns when a recording goes stale under its own max_age or
+// its target's ttl. The zero time means it never does.
+func ExpiresAt(cfg *config.Config, interaction *models.Interaction) time.Time {
+	var ttl time.Duration
+	if target, err := parseTarget(interaction.Metadata.Target); err == nil {
+		ttl = cfg.UpstreamFor(target.Host).TTLDuration()
+	}
+	return interaction.ExpiresAt(ttl)
+}
+
+// IsStale reports whether a recording has expired
+func IsStale(cfg *config.Config, interaction *models.Interaction) bool {
+	expires := ExpiresAt(cfg, interaction)
+	return !expires.IsZero() && time.Now().After(expires)
+}
+
+// keepMaxAge carries a recording's max_age over to its replacement, so
+// refreshing a fixture keeps its freshness policy
+func keepMaxAge(repository storage.Repository, interaction *models.Interaction) {
+	if previous, err := repository.Find(interaction.Request.GenerateHash()); err == nil {
+		interaction.MaxAge = previous.MaxAge
+	}
+}
@@ -0,0 +1,36 @@
+package mode
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/formdata"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/spool"
+)
+
+// applyMultipart lists the parts of a multipart/form-data body so the
+// request matches on them instead of the boundary-laden raw bytes. The
+// upstream's ignore patterns mark parts to leave out of matching.
+func applyMultipart(upstream config.UpstreamConfig, req *models.RecordedRequest, body *spool.Spool) {
+	boundary := formdata.Boundary(http.Header(req.Headers).Get("Content-Type"))
+	if boundary == "" || body.Len() == 0 {
+		return
+	}
+
+	reader, err := body.Open()
+	if err != nil {
+		fmt.Printf("Warning: Matching raw body for %s: %v\n", req.URL, err)
+		return
+	}
+	defer reader.Close()
+
+	parts, err := formdata.Parse(boundary, reader)
+	if err != nil {
+		fmt.Printf("Warning: Matching raw body for %s: %v\n", req.URL, err)
+		return
+	}
+	formdata.Ignore(parts, upstream.MultipartIgnore)
+	req.Multipart = parts
+}
@@ -0,0 +1,26 @@
+package mode
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/graphql"
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+// applyGraphQL attaches the normalized operation to POSTs for upstreams in
+// GraphQL mode, so they match on it rather than on the raw body. Bodies
+// that aren't GraphQL keep matching byte for byte.
+func applyGraphQL(upstream config.UpstreamConfig, req *models.RecordedRequest) {
+	if !upstream.GraphQL || req.Method != http.MethodPost || req.Body == nil {
+		return
+	}
+
+	operation, err := graphql.Parse(req.Body)
+	if err != nil {
+		fmt.Printf("Warning: Matching raw body for %s: %v\n", req.URL, err)
+		return
+	}
+	req.GraphQL = operation
+}
@@ -0,0 +1,184 @@
+package mode
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/http2"
+
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/storage"
+	"github.com/pismo/testing-proxy/internal/tracing"
+)
+
+// newGRPCClient builds an HTTP/2 client over TLS from upstream settings
+func newGRPCClient(settings config.UpstreamConfig) (*http.Client, error) {
+	return newHTTP2Client(settings, false)
+}
+
+// newH2CClient builds an HTTP/2 client over plain TCP (h2c)
+func newH2CClient(settings config.UpstreamConfig) (*http.Client, error) {
+	return newHTTP2Client(settings, true)
+}
+
+// newHTTP2Client reuses the TLS and timeout settings of the HTTP/1.1
+// client; upstream HTTP proxies are not used for gRPC
+func newHTTP2Client(settings config.UpstreamConfig, plaintext bool) (*http.Client, error) {
+	base, err := newUpstreamClient(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http2.Transport{
+		TLSClientConfig: base.Transport.(*http.Transport).TLSClientConfig,
+	}
+	if plaintext {
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   base.Timeout,
+	}, nil
+}
+
+// HandleGRPC records a unary gRPC call. The call is forwarded over HTTP/2
+// (h2c for http:// targets) and stored with its trailers. The recorded URL
+// is the method path, so calls match by service/method and payload bytes
+// whichever upstream served them.
+func (r *Recorder) HandleGRPC(req *http.Request, target string, body []byte) (interaction *models.Interaction, err error) {
+	ctx, span := tracing.Start(req.Context(), "Recorder.HandleGRPC",
+		attribute.String("proxy.target", target),
+		attribute.String("rpc.method", req.URL.Path),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	startTime := time.Now()
+
+	// Create recorded request without transport-level headers
+	recordedReq := newGRPCRequest(req, body)
+	RemoveHopByHopHeaders(recordedReq.Headers)
+
+	parsedTarget, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	parsedTarget.Path = strings.TrimSuffix(parsedTarget.Path, "/") + req.URL.Path
+	parsedTarget.RawQuery = ""
+
+	forwardReq, err := http.NewRequestWithContext(ctx, http.MethodPost, parsedTarget.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create forward request: %w", err)
+	}
+	for k, values := range recordedReq.Headers {
+		for _, v := range values {
+			forwardReq.Header.Add(k, v)
+		}
+	}
+	forwardReq.Header.Del("Host")
+	forwardReq.Host = parsedTarget.Host
+	setForwardingHeaders(forwardReq.Header, req)
+
+	// Required by gRPC, although it is hop-by-hop
+	forwardReq.Header.Set("Te", "trailers")
+
+	// Per-target client settings and header rules
+	upstream := r.config.UpstreamFor(parsedTarget.Host)
+	clients := r.grpcClients
+	if parsedTarget.Scheme == "http" {
+		clients = r.h2cClients
+	}
+	httpClient, err := clients.get(parsedTarget.Host, upstream)
+	if err != nil {
+		return nil, err
+	}
+	applyUpstreamHeaders(forwardReq.Header, upstream)
+	tracing.Inject(ctx, forwardReq.Header)
+
+	resp, err := httpClient.Do(forwardReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to forward gRPC call: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Trailers are only complete once the body has been read
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gRPC response: %w", err)
+	}
+
+	recordedResp := models.FromHTTPResponse(resp, respBody)
+	RemoveHopByHopHeaders(recordedResp.Headers)
+	if len(resp.Trailer) > 0 {
+		recordedResp.Trailers = make(map[string][]string, len(resp.Trailer))
+		for k, v := range resp.Trailer {
+			recordedResp.Trailers[k] = v
+		}
+	}
+	span.SetAttributes(attribute.String("rpc.grpc.status_code", grpcStatus(recordedResp)))
+
+	interaction = &models.Interaction{
+		ID:        uuid.New().String(),
+		Timestamp: startTime,
+		Request:   *recordedReq,
+		Response:  *recordedResp,
+		Metadata: models.InteractionMetadata{
+			Target:     target,
+			DurationMS: time.Since(startTime).Milliseconds(),
+		},
+	}
+
+	// Save to repository
+	repository := storage.WithContext(r.repository, ctx)
+	keepMaxAge(repository, interaction)
+	if err := repository.Save(interaction); err != nil {
+		// Log error but don't fail the request
+		fmt.Printf("Warning: Failed to save interaction: %v\n", err)
+	}
+
+	return interaction, nil
+}
+
+// HandleGRPC finds the recording for a unary gRPC call
+func (r *Player) HandleGRPC(req *http.Request, body []byte) (*models.Interaction, error) {
+	ctx, span := tracing.Start(req.Context(), "Player.HandleGRPC",
+		attribute.String("rpc.method", req.URL.Path),
+	)
+	defer span.End()
+
+	recordedReq := newGRPCRequest(req, body)
+	return r.lookup(ctx, span, recordedReq, recordedReq.GenerateHash())
+}
+
+// newGRPCRequest records a call under its method path
+func newGRPCRequest(req *http.Request, body []byte) *models.RecordedRequest {
+	recorded := models.FromHTTPRequest(req, body, req.URL.Path)
+	recorded.Method = http.MethodPost
+	return recorded
+}
+
+// grpcStatus reads grpc-status from the trailers, or from the headers of
+// a trailers-only response
+func grpcStatus(resp *models.RecordedResponse) string {
+	if status := http.Header(resp.Trailers).Get("Grpc-Status"); status != "" {
+		return status
+	}
+	return http.Header(resp.Headers).Get("Grpc-Status")
+}
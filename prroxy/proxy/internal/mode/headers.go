@@ -0,0 +1,102 @@
+package mode
+
+import (
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// hopByHopHeaders apply to a single transport connection and must not be
+// forwarded by proxies (RFC 7230 section 6.1)
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection", // Non-standard, still sent by some clients
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// upstreamAcceptEncoding lists the codings the recorder can decode, so
+// stored bodies are always readable whatever the client accepts
+const upstreamAcceptEncoding = "gzip, deflate, br"
+
+// RemoveHopByHopHeaders deletes hop-by-hop headers, including any named
+// in the Connection header
+func RemoveHopByHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+}
+
+// setForwardingHeaders adds X-Forwarded-* and Forwarded (RFC 7239)
+// describing the client request, appending to any values set by
+// earlier proxies
+func setForwardingHeaders(header http.Header, req *http.Request) {
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+
+	clientIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		clientIP = req.RemoteAddr
+	}
+
+	if clientIP != "" {
+		if prior := header.Get("X-Forwarded-For"); prior != "" {
+			header.Set("X-Forwarded-For", prior+", "+clientIP)
+		} else {
+			header.Set("X-Forwarded-For", clientIP)
+		}
+	}
+	if req.Host != "" && header.Get("X-Forwarded-Host") == "" {
+		header.Set("X-Forwarded-Host", req.Host)
+	}
+	if header.Get("X-Forwarded-Proto") == "" {
+		header.Set("X-Forwarded-Proto", proto)
+	}
+
+	var element []string
+	if clientIP != "" {
+		element = append(element, "for="+forwardedNode(clientIP))
+	}
+	if req.Host != "" {
+		element = append(element, "host="+quoteIfNeeded(req.Host))
+	}
+	element = append(element, "proto="+proto)
+
+	if prior := header.Get("Forwarded"); prior != "" {
+		header.Set("Forwarded", prior+", "+strings.Join(element, ";"))
+	} else {
+		header.Set("Forwarded", strings.Join(element, ";"))
+	}
+}
+
+// forwardedNode formats an IP for the Forwarded header; IPv6 addresses
+// must be bracketed and quoted
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	return ip
+}
+
+// quoteIfNeeded quotes values containing characters outside RFC 7230 tokens
+func quoteIfNeeded(value string) string {
+	if strings.ContainsAny(value, ":[]\" ") {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+	return value
+}
@@ -0,0 +1,131 @@
+package mode
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pismo/testing-proxy/internal/config"
+)
+
+func TestRemoveHopByHopHeaders(t *testing.T) {
+	header := http.Header{
+		"Connection":          {"keep-alive, X-Custom-Hop"},
+		"Keep-Alive":          {"timeout=5"},
+		"Proxy-Authorization": {"Basic abc"},
+		"Proxy-Connection":    {"keep-alive"},
+		"Te":                  {"trailers"},
+		"Trailer":             {"Expires"},
+		"Transfer-Encoding":   {"chunked"},
+		"Upgrade":             {"h2c"},
+		"X-Custom-Hop":        {"1"},
+		"Content-Type":        {"application/json"},
+		"Authorization":       {"Bearer token"},
+	}
+
+	RemoveHopByHopHeaders(header)
+
+	if len(header) != 2 {
+		t.Errorf("Expected only end-to-end headers to remain, got %v", header)
+	}
+	if header.Get("Content-Type") == "" || header.Get("Authorization") == "" {
+		t.Error("End-to-end headers must be kept")
+	}
+}
+
+func TestSetForwardingHeaders(t *testing.T) {
+	t.Run("First proxy", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://proxy.local:8099/api", nil)
+		req.RemoteAddr = "10.0.0.5:51234"
+		header := http.Header{}
+
+		setForwardingHeaders(header, req)
+
+		if got := header.Get("X-Forwarded-For"); got != "10.0.0.5" {
+			t.Errorf("X-Forwarded-For: got %q", got)
+		}
+		if got := header.Get("X-Forwarded-Host"); got != "proxy.local:8099" {
+			t.Errorf("X-Forwarded-Host: got %q", got)
+		}
+		if got := header.Get("X-Forwarded-Proto"); got != "http" {
+			t.Errorf("X-Forwarded-Proto: got %q", got)
+		}
+		if got := header.Get("Forwarded"); got != `for=10.0.0.5;host="proxy.local:8099";proto=http` {
+			t.Errorf("Forwarded: got %q", got)
+		}
+	})
+
+	t.Run("Appends to earlier proxies", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "https://proxy.local/api", nil)
+		req.RemoteAddr = "[2001:db8::1]:443"
+		req.TLS = &tls.ConnectionState{}
+		header := http.Header{
+			"X-Forwarded-For": {"192.0.2.1"},
+			"Forwarded":       {"for=192.0.2.1"},
+		}
+
+		setForwardingHeaders(header, req)
+
+		if got := header.Get("X-Forwarded-For"); got != "192.0.2.1, 2001:db8::1" {
+			t.Errorf("X-Forwarded-For: got %q", got)
+		}
+		if got := header.Get("Forwarded"); got != `for=192.0.2.1, for="[2001:db8::1]";host=proxy.local;proto=https` {
+			t.Errorf("Forwarded: got %q", got)
+		}
+	})
+}
+
+func TestRecorderHeaderHygiene(t *testing.T) {
+	var received *http.Request
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Clone(r.Context())
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Write([]byte("ok"))
+	}))
+	defer testServer.Close()
+
+	recorder := NewRecorder(config.New(), NewMockRepository())
+
+	req := httptest.NewRequest("GET", "http://proxy.local:8099/api", nil)
+	req.RemoteAddr = "10.0.0.5:51234"
+	req.Header.Set("Connection", "keep-alive")
+	req.Header.Set("Proxy-Authorization", "Basic abc")
+	req.Header.Set("Accept-Encoding", "zstd")
+	req.Header.Set("X-Request-Id", "42")
+
+	interaction, err := recorder.Handle(req, testServer.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to handle request: %v", err)
+	}
+
+	t.Run("Upstream request", func(t *testing.T) {
+		if received.Header.Get("Proxy-Authorization") != "" {
+			t.Error("Proxy-Authorization must not reach the upstream")
+		}
+		if received.Host != testServer.Listener.Addr().String() {
+			t.Errorf("Expected Host %s, got %s", testServer.Listener.Addr(), received.Host)
+		}
+		if received.Header.Get("X-Forwarded-For") != "10.0.0.5" {
+			t.Errorf("Expected X-Forwarded-For, got %q", received.Header.Get("X-Forwarded-For"))
+		}
+		if received.Header.Get("Accept-Encoding") != upstreamAcceptEncoding {
+			t.Errorf("Expected decodable Accept-Encoding, got %q", received.Header.Get("Accept-Encoding"))
+		}
+		if received.Header.Get("X-Request-Id") != "42" {
+			t.Error("End-to-end headers must be forwarded")
+		}
+	})
+
+	t.Run("Recording", func(t *testing.T) {
+		for _, name := range []string{"Connection", "Proxy-Authorization"} {
+			if _, ok := interaction.Request.Headers[name]; ok {
+				t.Errorf("Recorded request should not carry %s", name)
+			}
+		}
+		if _, ok := interaction.Response.Headers["Keep-Alive"]; ok {
+			t.Error("Recorded response should not carry Keep-Alive")
+		}
+	})
+}
@@ -2,18 +2,36 @@ package mode
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/pismo/testing-proxy/internal/compression"
+	"github.com/pismo/testing-proxy/internal/config"
 	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/spool"
 	"github.com/pismo/testing-proxy/internal/storage"
+	"github.com/pismo/testing-proxy/internal/tracing"
 )
 
 // MockRepository implements storage.Repository for testing
 type MockRepository struct {
 	interactions map[string]*models.Interaction
+	blobs        map[string][]byte
 	saveError    error
 	findError    error
 }
@@ -43,6 +61,14 @@ func (m *MockRepository) Find(hash string) (*models.Interaction, error) {
 	return nil, storage.ErrNotFound{Hash: hash}
 }
 
+func (m *MockRepository) Delete(hash string) error {
+	if _, ok := m.interactions[hash]; !ok {
+		return storage.ErrNotFound{Hash: hash}
+	}
+	delete(m.interactions, hash)
+	return nil
+}
+
 func (m *MockRepository) FindAll() ([]*models.Interaction, error) {
 	var result []*models.Interaction
 	for _, interaction := range m.interactions {
@@ -51,6 +77,33 @@ func (m *MockRepository) FindAll() ([]*models.Interaction, error) {
 	return result, nil
 }
 
+func (m *MockRepository) Query(query storage.Query) (*storage.QueryResult, error) {
+	all, _ := m.FindAll()
+	return storage.ApplyQuery(all, query)
+}
+
+func (m *MockRepository) SaveBlob(body io.Reader) (string, int64, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", 0, err
+	}
+	if m.blobs == nil {
+		m.blobs = make(map[string][]byte)
+	}
+	sum := sha256.Sum256(data)
+	ref := hex.EncodeToString(sum[:])
+	m.blobs[ref] = data
+	return ref, int64(len(data)), nil
+}
+
+func (m *MockRepository) OpenBlob(ref string) (io.ReadCloser, error) {
+	data, ok := m.blobs[ref]
+	if !ok {
+		return nil, storage.ErrNotFound{Hash: ref}
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
 func (m *MockRepository) Clear() error {
 	m.interactions = make(map[string]*models.Interaction)
 	return nil
@@ -77,7 +130,7 @@ func TestRecorder(t *testing.T) {
 
 	t.Run("Record GET request", func(t *testing.T) {
 		repo := NewMockRepository()
-		recorder := NewRecorder(repo)
+		recorder := NewRecorder(config.New(), repo)
 
 		// Create test request
 		req, _ := http.NewRequest("GET", "/api/test", nil)
@@ -109,7 +162,7 @@ func TestRecorder(t *testing.T) {
 
 	t.Run("Record POST request with body", func(t *testing.T) {
 		repo := NewMockRepository()
-		recorder := NewRecorder(repo)
+		recorder := NewRecorder(config.New(), repo)
 
 		// Create test request with body
 		body := []byte(`{"name":"test"}`)
@@ -131,7 +184,7 @@ func TestRecorder(t *testing.T) {
 	t.Run("Handle save error gracefully", func(t *testing.T) {
 		repo := NewMockRepository()
 		repo.saveError = storage.ErrNotFound{Hash: "test"}
-		recorder := NewRecorder(repo)
+		recorder := NewRecorder(config.New(), repo)
 
 		req, _ := http.NewRequest("GET", "/api/test", nil)
 
@@ -146,10 +199,310 @@ func TestRecorder(t *testing.T) {
 	})
 }
 
+func TestRecorderTracing(t *testing.T) {
+	// Install an in-memory tracer provider for the duration of the test
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+	if _, err := tracing.Setup(config.TracingConfig{}); err != nil {
+		t.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	var traceparent string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	repo := storage.NewTracedRepository(NewMockRepository())
+	recorder := NewRecorder(config.New(), repo)
+
+	req, _ := http.NewRequest("GET", "/api/test", nil)
+	if _, err := recorder.Handle(req, testServer.URL, nil); err != nil {
+		t.Fatalf("Failed to handle request: %v", err)
+	}
+
+	if traceparent == "" {
+		t.Fatal("Expected traceparent header to be sent upstream")
+	}
+
+	names := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range spans.Ended() {
+		names[span.Name()] = span
+	}
+	for _, name := range []string{"Recorder.Handle", "Recorder.upstream", "Repository.Save"} {
+		if _, ok := names[name]; !ok {
+			t.Errorf("Expected span %s to be recorded", name)
+		}
+	}
+
+	// The upstream's traceparent must point at our upstream span
+	upstream := names["Recorder.upstream"]
+	if upstream != nil && !strings.Contains(traceparent, upstream.SpanContext().SpanID().String()) {
+		t.Errorf("traceparent %s does not reference upstream span %s", traceparent, upstream.SpanContext().SpanID())
+	}
+
+	// Storage span must be parented by the recorder span
+	handle, save := names["Recorder.Handle"], names["Repository.Save"]
+	if handle != nil && save != nil && save.Parent().SpanID() != handle.SpanContext().SpanID() {
+		t.Error("Repository.Save span is not a child of Recorder.Handle")
+	}
+}
+
+func TestRecorderUpstreamSettings(t *testing.T) {
+	var received http.Header
+	testServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	host := strings.TrimPrefix(testServer.URL, "https://")
+	verify := false
+
+	t.Run("Verification fails without CA", func(t *testing.T) {
+		cfg := config.New()
+		cfg.Upstreams = map[string]config.UpstreamConfig{
+			host: {SkipVerify: &verify},
+		}
+		recorder := NewRecorder(cfg, NewMockRepository())
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		if _, err := recorder.Handle(req, testServer.URL, nil); err == nil {
+			t.Error("Expected TLS verification error")
+		}
+	})
+
+	t.Run("Custom CA bundle and header rules", func(t *testing.T) {
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testServer.Certificate().Raw})
+		if err := os.WriteFile(caFile, caPEM, 0644); err != nil {
+			t.Fatalf("Failed to write CA: %v", err)
+		}
+
+		cfg := config.New()
+		cfg.Upstreams = map[string]config.UpstreamConfig{
+			host: {
+				SkipVerify:    &verify,
+				CAFile:        caFile,
+				Timeout:       "5s",
+				InjectHeaders: map[string]string{"X-Api-Key": "secret"},
+				StripHeaders:  []string{"Cookie"},
+			},
+		}
+		repo := NewMockRepository()
+		recorder := NewRecorder(cfg, repo)
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Cookie", "session=abc")
+		interaction, err := recorder.Handle(req, testServer.URL, nil)
+		if err != nil {
+			t.Fatalf("Expected request to succeed with CA bundle: %v", err)
+		}
+
+		if received.Get("X-Api-Key") != "secret" {
+			t.Error("Expected injected header upstream")
+		}
+		if received.Get("Cookie") != "" {
+			t.Error("Expected Cookie to be stripped upstream")
+		}
+		// Upstream-only rules must not change what is recorded
+		if _, ok := interaction.Request.Headers["X-Api-Key"]; ok {
+			t.Error("Injected header must not be recorded")
+		}
+	})
+}
+
+func TestRecorderDecodesCompressedBody(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := compression.Encode(compression.Gzip, []byte(`{"ok":true}`))
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	defer testServer.Close()
+
+	recorder := NewRecorder(config.New(), NewMockRepository())
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	interaction, err := recorder.Handle(req, testServer.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to handle request: %v", err)
+	}
+
+	if string(interaction.Response.Body) != `{"ok":true}` {
+		t.Errorf("Expected decoded body, got %q", interaction.Response.Body)
+	}
+	if interaction.Response.ContentEncoding != "gzip" {
+		t.Errorf("Expected original encoding gzip, got %q", interaction.Response.ContentEncoding)
+	}
+	if _, ok := interaction.Response.Headers["Content-Encoding"]; ok {
+		t.Error("Content-Encoding header should not be stored with a decoded body")
+	}
+}
+
+func TestRecorderLargeBodies(t *testing.T) {
+	responseBody := strings.Repeat("response ", 100)
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		body, _ := compression.Encode(compression.Gzip, []byte(responseBody))
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(body)
+	}))
+	defer testServer.Close()
+
+	cfg := config.New()
+	cfg.Storage.BlobThreshold = 64
+	repo := NewMockRepository()
+	recorder := NewRecorder(cfg, repo)
+
+	requestBody := strings.Repeat("upload ", 100)
+	newBody := func() *spool.Spool {
+		body, err := spool.Read(strings.NewReader(requestBody), 64)
+		if err != nil {
+			t.Fatalf("Failed to spool body: %v", err)
+		}
+		return body
+	}
+
+	// The client doesn't accept gzip, so the relay decodes on the fly
+	body := newBody()
+	defer body.Close()
+	req, _ := http.NewRequest("POST", "/upload", nil)
+	rec := httptest.NewRecorder()
+
+	interaction, err := recorder.Stream(rec, req, testServer.URL, body)
+	if err != nil {
+		t.Fatalf("Failed to stream request: %v", err)
+	}
+
+	if rec.Body.String() != responseBody {
+		t.Errorf("Client got %d bytes, want %d", rec.Body.Len(), len(responseBody))
+	}
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Error("Relayed body should be decoded for a client without Accept-Encoding")
+	}
+
+	t.Run("Bodies stored as blobs", func(t *testing.T) {
+		if interaction.Request.Body != nil || interaction.Request.BodyRef == "" {
+			t.Fatalf("Expected request body out of line, got ref %q", interaction.Request.BodyRef)
+		}
+		if interaction.Response.Body != nil || interaction.Response.BodyRef == "" {
+			t.Fatalf("Expected response body out of line, got ref %q", interaction.Response.BodyRef)
+		}
+		if interaction.Response.ContentEncoding != "gzip" {
+			t.Errorf("Expected original encoding gzip, got %q", interaction.Response.ContentEncoding)
+		}
+
+		blob, err := repo.OpenBlob(interaction.Response.BodyRef)
+		if err != nil {
+			t.Fatalf("Failed to open blob: %v", err)
+		}
+		stored, _ := io.ReadAll(blob)
+		if string(stored) != responseBody {
+			t.Error("Response blob should hold the decoded body")
+		}
+	})
+
+	t.Run("Hash matches an inline body", func(t *testing.T) {
+		inline := models.RecordedRequest{Method: "POST", URL: testServer.URL, Body: []byte(requestBody)}
+		if interaction.Request.GenerateHash() != inline.GenerateHash() {
+			t.Error("Spooled and inline bodies should hash the same")
+		}
+	})
+
+	t.Run("Playback finds spooled request", func(t *testing.T) {
+		body := newBody()
+		defer body.Close()
+
+		found, err := NewPlayer(config.New(), repo).HandleSpooled(req, testServer.URL, body)
+		if err != nil {
+			t.Fatalf("Failed to play back: %v", err)
+		}
+		if found.ID != interaction.ID {
+			t.Errorf("Expected interaction %s, got %s", interaction.ID, found.ID)
+		}
+	})
+}
+
+func TestRecorderStreamChunks(t *testing.T) {
+	events := []string{"data: one\n\n", "data: two\n\n", "data: three\n\n"}
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			io.WriteString(w, event)
+			w.(http.Flusher).Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+	}))
+	defer testServer.Close()
+
+	recorder := NewRecorder(config.New(), NewMockRepository())
+	req, _ := http.NewRequest("GET", "/events", nil)
+	rec := httptest.NewRecorder()
+
+	interaction, err := recorder.Stream(rec, req, testServer.URL, spool.FromBytes(nil))
+	if err != nil {
+		t.Fatalf("Failed to stream request: %v", err)
+	}
+
+	if rec.Body.String() != strings.Join(events, "") {
+		t.Errorf("Client got %q", rec.Body.String())
+	}
+
+	chunks := interaction.Response.Chunks
+	if len(chunks) != len(events) {
+		t.Fatalf("Expected %d chunks, got %d: %+v", len(events), len(chunks), chunks)
+	}
+	for i, chunk := range chunks {
+		if chunk.Size != int64(len(events[i])) {
+			t.Errorf("Chunk %d: expected size %d, got %d", i, len(events[i]), chunk.Size)
+		}
+	}
+	if chunks[2].OffsetMS < 50 {
+		t.Errorf("Expected the last event about 60ms in, got %dms", chunks[2].OffsetMS)
+	}
+}
+
+func TestStreamBoundary(t *testing.T) {
+	tests := []struct {
+		contentType string
+		buf         string
+		want        int
+	}{
+		{"text/event-stream", "data: a\n\ndata: b", 9},
+		{"text/event-stream; charset=utf-8", "data: a\r\n\r\n", 11},
+		{"text/event-stream", "data: a\n", -1},
+		{"application/x-ndjson", "{\"a\":1}\n{", 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			boundary := streamBoundary(http.Header{"Content-Type": {tt.contentType}})
+			if boundary == nil {
+				t.Fatal("Expected a stream boundary")
+			}
+			if got := boundary([]byte(tt.buf)); got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("Plain JSON is not chunked", func(t *testing.T) {
+		if streamBoundary(http.Header{"Content-Type": {"application/json"}}) != nil {
+			t.Error("Expected no boundary for application/json")
+		}
+	})
+}
+
 func TestPlayer(t *testing.T) {
 	t.Run("Playback existing recording", func(t *testing.T) {
 		repo := NewMockRepository()
-		player := NewPlayer(repo)
+		player := NewPlayer(config.New(), repo)
 
 		// Pre-save an interaction
 		interaction := &models.Interaction{
@@ -173,7 +526,7 @@ func TestPlayer(t *testing.T) {
 		req.Header.Set("Accept", "application/json")
 
 		// Handle request
-		found, err := player.Handle(req, nil)
+		found, err := player.Handle(req, "/api/test", nil)
 		if err != nil {
 			t.Fatalf("Failed to handle request: %v", err)
 		}
@@ -189,12 +542,12 @@ func TestPlayer(t *testing.T) {
 
 	t.Run("Return error when no recording exists", func(t *testing.T) {
 		repo := NewMockRepository()
-		player := NewPlayer(repo)
+		player := NewPlayer(config.New(), repo)
 
 		req, _ := http.NewRequest("GET", "/api/unknown", nil)
 
 		// Handle request
-		_, err := player.Handle(req, nil)
+		_, err := player.Handle(req, "/api/unknown", nil)
 		if err == nil {
 			t.Fatal("Expected error for non-existent recording")
 		}
@@ -207,7 +560,7 @@ func TestPlayer(t *testing.T) {
 
 	t.Run("Match based on full request", func(t *testing.T) {
 		repo := NewMockRepository()
-		player := NewPlayer(repo)
+		player := NewPlayer(config.New(), repo)
 
 		// Save interaction with specific headers
 		interaction := &models.Interaction{
@@ -233,7 +586,7 @@ func TestPlayer(t *testing.T) {
 		req1.Header.Set("Content-Type", "application/json")
 		req1.Header.Set("X-Tenant", "org-123")
 
-		found, err := player.Handle(req1, body)
+		found, err := player.Handle(req1, "/api/users", body)
 		if err != nil {
 			t.Errorf("Should find matching request: %v", err)
 		}
@@ -246,7 +599,7 @@ func TestPlayer(t *testing.T) {
 		req2.Header.Set("Content-Type", "application/json")
 		req2.Header.Set("X-Tenant", "org-456") // Different tenant
 
-		_, err = player.Handle(req2, body)
+		_, err = player.Handle(req2, "/api/users", body)
 		if err == nil {
 			t.Error("Should not find request with different header")
 		}
@@ -257,11 +610,47 @@ func TestPlayer(t *testing.T) {
 		req3.Header.Set("Content-Type", "application/json")
 		req3.Header.Set("X-Tenant", "org-123")
 
-		_, err = player.Handle(req3, body2)
+		_, err = player.Handle(req3, "/api/users", body2)
 		if err == nil {
 			t.Error("Should not find request with different body")
 		}
 	})
+
+	t.Run("Recording made before https targets were normalized", func(t *testing.T) {
+		repo := NewMockRepository()
+		player := NewPlayer(config.New(), repo)
+
+		// Older recordings kept the scheme, so they hash differently
+		interaction := &models.Interaction{
+			ID: "legacy-789",
+			Request: models.RecordedRequest{
+				Method: "POST",
+				URL:    "https://api.example.com/users",
+				Body:   json.RawMessage(`{"name":"Alice"}`),
+			},
+			Response: models.RecordedResponse{
+				StatusCode: 201,
+			},
+		}
+		repo.Save(interaction)
+
+		body := []byte(`{"name":"Alice"}`)
+		for _, target := range []string{"https://api.example.com/users", "api.example.com/users"} {
+			req, _ := http.NewRequest("POST", "/", bytes.NewReader(body))
+			found, err := player.Handle(req, target, body)
+			if err != nil {
+				t.Fatalf("Should find legacy recording for %s: %v", target, err)
+			}
+			if found.ID != interaction.ID {
+				t.Errorf("Wrong interaction returned for %s", target)
+			}
+		}
+
+		req, _ := http.NewRequest("POST", "/", bytes.NewReader(body))
+		if _, err := player.Handle(req, "http://api.example.com/users", body); err == nil {
+			t.Error("Should not match an http target against an https recording")
+		}
+	})
 }
 
 func TestBuildTargetURL(t *testing.T) {
@@ -273,6 +662,7 @@ func TestBuildTargetURL(t *testing.T) {
 		{"http://api.example.com", "http://api.example.com"},
 		{"https://api.example.com", "https://api.example.com"},
 		{"0.0.0.0:8080", "https://0.0.0.0:8080"},
+		{"wss://api.example.com/socket", "wss://api.example.com/socket"},
 	}
 
 	for _, tt := range tests {
@@ -283,4 +673,127 @@ func TestBuildTargetURL(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestGraphQLMatching(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"user":{"name":"Alice"}}}`))
+	}))
+	defer testServer.Close()
+
+	cfg := config.New()
+	cfg.Upstreams = map[string]config.UpstreamConfig{
+		strings.TrimPrefix(testServer.URL, "http://"): {GraphQL: true},
+	}
+	repo := NewMockRepository()
+	target := testServer.URL + "/graphql"
+
+	recorded := []byte(`{"query":"query GetUser($id: ID!) {\n  user(id: $id) { name }\n}","variables":{"id":"1","active":true}}`)
+	req, _ := http.NewRequest("POST", "/graphql", bytes.NewReader(recorded))
+	interaction, err := NewRecorder(cfg, repo).Handle(req, target, recorded)
+	if err != nil {
+		t.Fatalf("Failed to record: %v", err)
+	}
+	if interaction.Request.GraphQL == nil || interaction.Request.GraphQL.Name != "GetUser" {
+		t.Fatalf("Expected GetUser operation, got %+v", interaction.Request.GraphQL)
+	}
+
+	player := NewPlayer(cfg, repo)
+
+	t.Run("Reformatted query and reordered variables match", func(t *testing.T) {
+		body := []byte(`{"variables":{"active":true,"id":"1"},"query":"query GetUser($id:ID!){user(id:$id){name}}"}`)
+		req, _ := http.NewRequest("POST", "/graphql", bytes.NewReader(body))
+		found, err := player.Handle(req, target, body)
+		if err != nil {
+			t.Fatalf("Expected a match: %v", err)
+		}
+		if found.ID != interaction.ID {
+			t.Errorf("Wrong interaction returned: %s", found.ID)
+		}
+	})
+
+	t.Run("Different variables miss", func(t *testing.T) {
+		body := []byte(`{"query":"query GetUser($id:ID!){user(id:$id){name}}","variables":{"id":"2","active":true}}`)
+		req, _ := http.NewRequest("POST", "/graphql", bytes.NewReader(body))
+		if _, err := player.Handle(req, target, body); err == nil {
+			t.Error("Expected a miss for different variables")
+		}
+	})
+
+	t.Run("Other targets match raw bodies", func(t *testing.T) {
+		body := []byte(`{"query":"{ me { id } }"}`)
+		req, _ := http.NewRequest("POST", "/graphql", bytes.NewReader(body))
+		interaction, err := NewRecorder(config.New(), NewMockRepository()).Handle(req, target, body)
+		if err != nil {
+			t.Fatalf("Failed to record: %v", err)
+		}
+		if interaction.Request.GraphQL != nil {
+			t.Error("Expected no GraphQL operation without graphql mode")
+		}
+	})
+}
+
+func TestMultipartMatching(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer testServer.Close()
+
+	// Each form gets a fresh random boundary
+	form := func(nonce, file string) (*http.Request, *spool.Spool) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		w.WriteField("nonce", nonce)
+		part, _ := w.CreateFormFile("upload", "data.txt")
+		part.Write([]byte(file))
+		w.Close()
+
+		body, err := spool.Read(&buf, 64) // Spills to disk
+		if err != nil {
+			t.Fatalf("Failed to spool body: %v", err)
+		}
+		t.Cleanup(func() { body.Close() })
+		req, _ := http.NewRequest("POST", "/upload", nil)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return req, body
+	}
+
+	cfg := config.New()
+	cfg.Storage.BlobThreshold = 64
+	cfg.Upstreams = map[string]config.UpstreamConfig{
+		strings.TrimPrefix(testServer.URL, "http://"): {MultipartIgnore: []string{"nonce"}},
+	}
+	repo := NewMockRepository()
+
+	req, body := form("a1", "file contents")
+	interaction, err := NewRecorder(cfg, repo).Stream(nil, req, testServer.URL, body)
+	if err != nil {
+		t.Fatalf("Failed to record: %v", err)
+	}
+	if len(interaction.Request.Multipart) != 2 || !interaction.Request.Multipart[0].Ignored {
+		t.Fatalf("Expected two parts with nonce ignored, got %+v", interaction.Request.Multipart)
+	}
+	if interaction.Request.BodyRef == "" {
+		t.Error("Expected the raw upload to be stored as a blob")
+	}
+
+	player := NewPlayer(cfg, repo)
+
+	t.Run("New boundary and ignored part still match", func(t *testing.T) {
+		req, body := form("b2", "file contents")
+		found, err := player.HandleSpooled(req, testServer.URL, body)
+		if err != nil {
+			t.Fatalf("Expected a match: %v", err)
+		}
+		if found.ID != interaction.ID {
+			t.Errorf("Wrong interaction returned: %s", found.ID)
+		}
+	})
+
+	t.Run("Different file content misses", func(t *testing.T) {
+		req, body := form("a1", "other contents")
+		if _, err := player.HandleSpooled(req, testServer.URL, body); err == nil {
+			t.Error("Expected a miss for different file content")
+		}
+	})
+}
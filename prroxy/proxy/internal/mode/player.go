@@ -1,56 +1,159 @@
 package mode
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pismo/testing-proxy/internal/config"
 	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/rewrite"
+	"github.com/pismo/testing-proxy/internal/spool"
 	"github.com/pismo/testing-proxy/internal/storage"
+	"github.com/pismo/testing-proxy/internal/tracing"
 )
 
 // Player handles playback of recorded HTTP interactions
 type Player struct {
+	config     *config.Config
 	repository storage.Repository
 }
 
 // NewPlayer creates a new Player instance
-func NewPlayer(repository storage.Repository) *Player {
+func NewPlayer(cfg *config.Config, repository storage.Repository) *Player {
 	return &Player{
+		config:     cfg,
 		repository: repository,
 	}
 }
 
 // Handle processes a request in playback mode
 func (r *Player) Handle(req *http.Request, target string, body []byte) (*models.Interaction, error) {
+	return r.HandleSpooled(req, target, spool.FromBytes(body))
+}
+
+// HandleSpooled processes a request in playback mode, hashing a spilled
+// body from disk instead of memory
+func (r *Player) HandleSpooled(req *http.Request, target string, body *spool.Spool) (*models.Interaction, error) {
+	ctx, span := tracing.Start(req.Context(), "Player.Handle",
+		attribute.String("proxy.target", target),
+		attribute.String("http.method", req.Method),
+	)
+	defer span.End()
+
 	// Create recorded request from incoming request
-	recordedReq := models.FromHTTPRequest(req, body, target)
+	recordedReq := models.FromHTTPRequest(req, body.Bytes(), target)
+	var upstream config.UpstreamConfig
+	if parsedTarget, err := parseTarget(target); err == nil {
+		upstream = r.config.UpstreamFor(parsedTarget.Host)
+		applyGraphQL(upstream, recordedReq)
+		applyMultipart(upstream, recordedReq, body)
+	}
 
 	// Generate hash for lookup
 	hash := recordedReq.GenerateHash()
+	if !body.InMemory() {
+		var err error
+		if hash, err = hashSpooledRequest(recordedReq, body); err != nil {
+			tracing.RecordError(span, err)
+			return nil, err
+		}
+	}
+	span.SetAttributes(attribute.String("proxy.hash", hash))
 
+	interaction, err := r.lookup(ctx, span, recordedReq, hash)
+	if miss, ok := err.(*ErrNoRecording); ok && !miss.Expired {
+		interaction, err = r.lookupLegacy(ctx, span, recordedReq, body, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Rewrite rules for the playback phase leave the recording untouched
+	rewrite.Apply(upstream.Rewrite, rewrite.Playback, &interaction.Response)
+	return interaction, nil
+}
+
+// lookup finds the interaction recorded under hash
+func (r *Player) lookup(ctx context.Context, span trace.Span, recordedReq *models.RecordedRequest, hash string) (*models.Interaction, error) {
 	// Find matching interaction
-	interaction, err := r.repository.Find(hash)
+	interaction, err := storage.WithContext(r.repository, ctx).Find(hash)
 	if err != nil {
 		if _, ok := err.(storage.ErrNotFound); ok {
+			span.SetAttributes(attribute.Bool("proxy.miss", true))
 			return nil, &ErrNoRecording{
 				Method: recordedReq.Method,
 				URL:    recordedReq.URL,
 				Hash:   hash,
 			}
 		}
+		tracing.RecordError(span, err)
 		return nil, fmt.Errorf("failed to retrieve recording: %w", err)
 	}
 
+	// Stale recordings still play back, except in hybrid mode where
+	// they are re-recorded
+	if IsStale(r.config, interaction) {
+		if r.config.GetMode() == Hybrid {
+			span.SetAttributes(attribute.Bool("proxy.miss", true), attribute.Bool("proxy.expired", true))
+			return nil, &ErrNoRecording{
+				Method:  recordedReq.Method,
+				URL:     recordedReq.URL,
+				Hash:    hash,
+				Expired: true,
+			}
+		}
+		span.SetAttributes(attribute.Bool("proxy.stale", true))
+	}
+
 	return interaction, nil
 }
 
-// ErrNoRecording indicates that no recording was found for the request
+// lookupLegacy retries a miss under the hash the request had before
+// targets were normalized, when an https:// target was recorded with its
+// scheme. miss is returned if that finds nothing either.
+func (r *Player) lookupLegacy(ctx context.Context, span trace.Span, recordedReq *models.RecordedRequest, body *spool.Spool, miss error) (*models.Interaction, error) {
+	if strings.Contains(recordedReq.URL, "://") {
+		return nil, miss
+	}
+
+	legacyReq := *recordedReq
+	legacyReq.URL = "https://" + recordedReq.URL
+	hash := legacyReq.GenerateHash()
+	if !body.InMemory() {
+		var err error
+		if hash, err = hashSpooledRequest(&legacyReq, body); err != nil {
+			tracing.RecordError(span, err)
+			return nil, err
+		}
+	}
+
+	interaction, err := r.lookup(ctx, span, recordedReq, hash)
+	if _, ok := err.(*ErrNoRecording); ok {
+		return nil, miss
+	}
+	if err == nil {
+		span.SetAttributes(attribute.Bool("proxy.miss", false), attribute.String("proxy.hash", hash))
+	}
+	return interaction, err
+}
+
+// ErrNoRecording indicates that no recording was found for the request,
+// or in hybrid mode that the one found has expired
 type ErrNoRecording struct {
-	Method string
-	URL    string
-	Hash   string
+	Method  string
+	URL     string
+	Hash    string
+	Expired bool
 }
 
 func (e *ErrNoRecording) Error() string {
+	if e.Expired {
+		return fmt.Sprintf("recording expired for %s %s (hash: %s)", e.Method, e.URL, e.Hash)
+	}
 	return fmt.Sprintf("no recording found for %s %s (hash: %s)", e.Method, e.URL, e.Hash)
 }
\ No newline at end of file
@@ -1,113 +1,187 @@
 package mode
 
 import (
-	"bytes"
-	"crypto/tls"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/pismo/testing-proxy/internal/config"
 	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/rewrite"
+	"github.com/pismo/testing-proxy/internal/spool"
 	"github.com/pismo/testing-proxy/internal/storage"
+	"github.com/pismo/testing-proxy/internal/tracing"
 )
 
 // Recorder handles recording of HTTP interactions
 type Recorder struct {
-	repository storage.Repository
-	httpClient *http.Client
+	config      *config.Config
+	repository  storage.Repository
+	clients     *upstreamClients
+	grpcClients *upstreamClients // HTTP/2 over TLS
+	h2cClients  *upstreamClients // HTTP/2 over plain TCP
 }
 
 // NewRecorder creates a new Recorder instance
-func NewRecorder(repository storage.Repository) *Recorder {
-	// Create HTTP client that accepts any certificate (for testing)
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-
+func NewRecorder(cfg *config.Config, repository storage.Repository) *Recorder {
 	return &Recorder{
-		repository: repository,
-		httpClient: &http.Client{
-			Transport: tr,
-			Timeout:   30 * time.Second, // Generous timeout for external services
-		},
+		config:      cfg,
+		repository:  repository,
+		clients:     newUpstreamClients(),
+		grpcClients: newClientCache(newGRPCClient),
+		h2cClients:  newClientCache(newH2CClient),
 	}
 }
 
-// Handle processes a request in record mode
+// Handle processes a request in record mode, buffering the response
 func (r *Recorder) Handle(req *http.Request, target string, body []byte) (*models.Interaction, error) {
-	startTime := time.Now()
+	return r.Stream(nil, req, target, spool.FromBytes(body))
+}
 
-	// Create recorded request
-	recordedReq := models.FromHTTPRequest(req, body, target)
+// Stream processes a request in record mode. When w is not nil the
+// upstream response is relayed to it as it arrives while a copy is
+// spooled for storage, so large bodies never have to fit in memory.
+// Bodies above the storage blob threshold are saved as blob files.
+// When record-phase rewrite rules could change the body, it is read in
+// full and nothing is written to w; the caller sends the rewritten
+// response from the returned interaction, as on playback.
+func (r *Recorder) Stream(w http.ResponseWriter, req *http.Request, target string, body *spool.Spool) (interaction *models.Interaction, err error) {
+	ctx, span := tracing.Start(req.Context(), "Recorder.Handle",
+		attribute.String("proxy.target", target),
+		attribute.String("http.method", req.Method),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
 
-	// Build the full target URL (adds https:// if needed)
-	targetURL := buildTargetURL(target)
+	startTime := time.Now()
+	repository := storage.WithContext(r.repository, ctx)
 
-	// The target from Query().Get() is URL-decoded, which corrupts URLs with
-	// special characters (spaces, etc). We need to parse and manually re-encode
-	// the query parameters to preserve proper URL encoding.
-	parsedTarget, err := url.Parse(targetURL)
+	// Create recorded request without transport-level headers
+	recordedReq := models.FromHTTPRequest(req, body.Bytes(), target)
+	RemoveHopByHopHeaders(recordedReq.Headers)
+
+	parsedTarget, err := parseTarget(target)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse target URL: %w", err)
+		return nil, err
 	}
+	properlyEncodedURL := parsedTarget.String()
 
-	// If there are query parameters, we need to re-encode them properly
-	// because Query().Get() decoded them
-	if parsedTarget.RawQuery != "" {
-		// Parse the query parameters
-		queryValues, err := url.ParseQuery(parsedTarget.RawQuery)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse query: %w", err)
+	// Structured bodies match on their parsed form
+	upstream := r.config.UpstreamFor(parsedTarget.Host)
+	applyGraphQL(upstream, recordedReq)
+	applyMultipart(upstream, recordedReq, body)
+
+	// Large uploads are stored out of line
+	if !body.InMemory() {
+		if err := storeRequestBody(repository, recordedReq, body); err != nil {
+			return nil, err
 		}
-		// Re-encode them properly - this will convert spaces to %20
-		parsedTarget.RawQuery = queryValues.Encode()
 	}
 
-	properlyEncodedURL := parsedTarget.String()
+	// The upstream call gets its own span so proxy overhead and upstream
+	// latency can be told apart
+	upstreamCtx, upstreamSpan := tracing.Start(ctx, "Recorder.upstream",
+		attribute.String("http.url", properlyEncodedURL),
+	)
+	defer upstreamSpan.End()
 
 	// Create forward request using the properly encoded target URL
-	forwardReq, err := http.NewRequest(recordedReq.Method, properlyEncodedURL, nil)
+	forwardReq, err := http.NewRequestWithContext(upstreamCtx, recordedReq.Method, properlyEncodedURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create forward request: %w", err)
 	}
 
-	// Copy headers from original request
+	// Copy end-to-end headers from original request
 	for k, values := range recordedReq.Headers {
 		for _, v := range values {
 			forwardReq.Header.Add(k, v)
 		}
 	}
 
-	// Add body if present
-	if body != nil && len(body) > 0 {
-		forwardReq.Body = io.NopCloser(bytes.NewReader(body))
-		forwardReq.ContentLength = int64(len(body))
+	// Address the upstream, not the proxy, and say who we forward for
+	forwardReq.Header.Del("Host")
+	forwardReq.Host = parsedTarget.Host
+	setForwardingHeaders(forwardReq.Header, req)
+
+	// Ask only for codings we can decode before storing
+	forwardReq.Header.Set("Accept-Encoding", upstreamAcceptEncoding)
+
+	// Per-target client settings and header rules
+	httpClient, err := r.clients.get(parsedTarget.Host, upstream)
+	if err != nil {
+		return nil, err
+	}
+	applyUpstreamHeaders(forwardReq.Header, upstream)
+
+	// Propagate the upstream span as a W3C traceparent
+	tracing.Inject(upstreamCtx, forwardReq.Header)
+
+	// Stream the body from the spool rather than from memory
+	if body.Len() > 0 {
+		reqBody, err := body.Open()
+		if err != nil {
+			return nil, err
+		}
+		forwardReq.Body = reqBody
+		forwardReq.ContentLength = body.Len()
 	}
 
 	// Execute the request
-	resp, err := r.httpClient.Do(forwardReq)
+	resp, err := httpClient.Do(forwardReq)
 	if err != nil {
+		tracing.RecordError(upstreamSpan, err)
 		return nil, fmt.Errorf("failed to forward request: %w", err)
 	}
 	defer resp.Body.Close()
+	upstreamSpan.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 
-	// Read response body
-	respBody, err := io.ReadAll(resp.Body)
+	// Tee the response body into a spool while relaying it, noting when
+	// each event arrives if the upstream streams
+	threshold := r.config.Storage.BlobThresholdBytes()
+	respBody := spool.New(threshold)
+	defer respBody.Close()
+	var sink io.Writer = respBody
+	var chunks *chunkRecorder
+	if boundary := streamBoundary(resp.Header); boundary != nil {
+		chunks = newChunkRecorder(boundary)
+		sink = io.MultiWriter(respBody, chunks)
+	}
+	tee := io.TeeReader(resp.Body, sink)
+
+	if w != nil && !rewritesBody(upstream, resp, chunks, threshold) {
+		err = relayResponse(w, req, resp, tee)
+	} else {
+		_, err = io.Copy(io.Discard, tee)
+	}
 	if err != nil {
+		tracing.RecordError(upstreamSpan, err)
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
+	upstreamSpan.End()
 
-	// Create recorded response
-	recordedResp := models.FromHTTPResponse(resp, respBody)
+	// Create recorded response, stored decoded so it stays readable
+	recordedResp := models.FromHTTPResponse(resp, nil)
+	RemoveHopByHopHeaders(recordedResp.Headers)
+	if err := storeResponseBody(repository, recordedResp, respBody, threshold); err != nil {
+		return nil, err
+	}
+	if chunks != nil {
+		recordedResp.Chunks = chunks.finish()
+	}
 
 	// Calculate duration
 	duration := time.Since(startTime).Milliseconds()
 
 	// Create interaction
-	interaction := &models.Interaction{
+	interaction = &models.Interaction{
 		ID:        uuid.New().String(),
 		Timestamp: startTime,
 		Request:   *recordedReq,
@@ -118,8 +192,12 @@ func (r *Recorder) Handle(req *http.Request, target string, body []byte) (*model
 		},
 	}
 
+	// Rewrite rules for the record phase are persisted
+	rewrite.Apply(upstream.Rewrite, rewrite.Record, &interaction.Response)
+
 	// Save to repository
-	if err := r.repository.Save(interaction); err != nil {
+	keepMaxAge(repository, interaction)
+	if err := repository.Save(interaction); err != nil {
 		// Log error but don't fail the request
 		fmt.Printf("Warning: Failed to save interaction: %v\n", err)
 	}
@@ -127,6 +205,41 @@ func (r *Recorder) Handle(req *http.Request, target string, body []byte) (*model
 	return interaction, nil
 }
 
+// rewritesBody reports whether record-phase rules may change a response
+// before it reaches the client. Streamed and large bodies are relayed as
+// they arrive, since the rules skip them anyway.
+func rewritesBody(upstream config.UpstreamConfig, resp *http.Response, chunks *chunkRecorder, threshold int64) bool {
+	return rewrite.HasPhase(upstream.Rewrite, rewrite.Record) && chunks == nil && resp.ContentLength <= threshold
+}
+
+// parseTarget builds the upstream URL for a target
+func parseTarget(target string) (*url.URL, error) {
+	// Build the full target URL (adds https:// if needed)
+	targetURL := buildTargetURL(target)
+
+	// The target from Query().Get() is URL-decoded, which corrupts URLs with
+	// special characters (spaces, etc). We need to parse and manually re-encode
+	// the query parameters to preserve proper URL encoding.
+	parsedTarget, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse target URL: %w", err)
+	}
+
+	// If there are query parameters, we need to re-encode them properly
+	// because Query().Get() decoded them
+	if parsedTarget.RawQuery != "" {
+		// Parse the query parameters
+		queryValues, err := url.ParseQuery(parsedTarget.RawQuery)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse query: %w", err)
+		}
+		// Re-encode them properly - this will convert spaces to %20
+		parsedTarget.RawQuery = queryValues.Encode()
+	}
+
+	return parsedTarget, nil
+}
+
 // buildTargetURL constructs the full target URL
 func buildTargetURL(target string) string {
 	// Check if target already has protocol
@@ -137,7 +250,12 @@ func buildTargetURL(target string) string {
 	return target
 }
 
-// hasProtocol checks if URL has http:// or https:// prefix
+// hasProtocol checks if URL has an http(s):// or ws(s):// prefix
 func hasProtocol(url string) bool {
-	return len(url) >= 7 && (url[:7] == "http://" || (len(url) >= 8 && url[:8] == "https://"))
+	for _, scheme := range []string{"http://", "https://", "ws://", "wss://"} {
+		if strings.HasPrefix(url, scheme) {
+			return true
+		}
+	}
+	return false
 }
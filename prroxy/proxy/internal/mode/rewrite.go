@@ -0,0 +1,16 @@
+package mode
+
+import (
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/rewrite"
+)
+
+// RewriteRules returns the rewrite rules configured for a recording's
+// target
+func RewriteRules(cfg *config.Config, interaction *models.Interaction) []rewrite.Rule {
+	if target, err := parseTarget(interaction.Metadata.Target); err == nil {
+		return cfg.UpstreamFor(target.Host).Rewrite
+	}
+	return nil
+}
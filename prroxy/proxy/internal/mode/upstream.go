@@ -0,0 +1,127 @@
+package mode
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/pismo/testing-proxy/internal/config"
+)
+
+// upstreamClients caches one http.Client per target host. A client is
+// rebuilt when the host's settings change (e.g. after a config reload),
+// which keeps connection pools per upstream.
+type upstreamClients struct {
+	clients map[string]cachedClient
+	build   func(config.UpstreamConfig) (*http.Client, error)
+	mu      sync.Mutex
+}
+
+// cachedClient is a client with the settings fingerprint it was built from
+type cachedClient struct {
+	client      *http.Client
+	fingerprint string
+}
+
+// newUpstreamClients creates an empty client cache
+func newUpstreamClients() *upstreamClients {
+	return newClientCache(newUpstreamClient)
+}
+
+// newClientCache creates an empty cache of clients made by build
+func newClientCache(build func(config.UpstreamConfig) (*http.Client, error)) *upstreamClients {
+	return &upstreamClients{
+		clients: make(map[string]cachedClient),
+		build:   build,
+	}
+}
+
+// get returns the client for host built from settings
+func (u *upstreamClients) get(host string, settings config.UpstreamConfig) (*http.Client, error) {
+	data, _ := json.Marshal(settings)
+	fingerprint := string(data)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if cached, ok := u.clients[host]; ok && cached.fingerprint == fingerprint {
+		return cached.client, nil
+	}
+
+	client, err := u.build(settings)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream settings for %s: %w", host, err)
+	}
+
+	// Release idle connections of the client being replaced
+	if cached, ok := u.clients[host]; ok {
+		cached.client.CloseIdleConnections()
+	}
+	u.clients[host] = cachedClient{client: client, fingerprint: fingerprint}
+
+	return client, nil
+}
+
+// newUpstreamClient builds an http.Client from upstream settings
+func newUpstreamClient(settings config.UpstreamConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: settings.SkipVerify != nil && *settings.SkipVerify,
+	}
+
+	if settings.CAFile != "" {
+		pem, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", settings.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if settings.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	tr := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: settings.MaxIdleConns,
+	}
+
+	if settings.Proxy != "" {
+		proxyURL, err := url.Parse(settings.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		tr.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{
+		Transport: tr,
+		Timeout:   settings.TimeoutDuration(),
+	}, nil
+}
+
+// applyUpstreamHeaders strips and injects the configured headers on a
+// request about to be forwarded
+func applyUpstreamHeaders(header http.Header, settings config.UpstreamConfig) {
+	for _, name := range settings.StripHeaders {
+		header.Del(name)
+	}
+	for name, value := range settings.InjectHeaders {
+		header.Set(name, value)
+	}
+}
@@ -0,0 +1,407 @@
+package mode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/storage"
+	"github.com/pismo/testing-proxy/internal/tracing"
+)
+
+// handshakeHeaders are generated per connection by the WebSocket dialer
+// and upgrader, so they are neither forwarded nor recorded
+var handshakeHeaders = []string{
+	"Sec-Websocket-Key",
+	"Sec-Websocket-Version",
+	"Sec-Websocket-Extensions",
+	"Sec-Websocket-Accept",
+}
+
+// closeGrace is how long a session waits for the other side's close
+// frame once one side has closed
+const closeGrace = time.Second
+
+// controlTimeout bounds writes of control frames
+const controlTimeout = time.Second
+
+// IsWebSocketUpgrade reports whether req asks to switch to WebSocket
+func IsWebSocketUpgrade(req *http.Request) bool {
+	return websocket.IsWebSocketUpgrade(req)
+}
+
+// HandleWebSocket records a WebSocket session: the upgrade is forwarded
+// to the target, and every frame relayed in either direction is logged
+// with its time offset. It returns once either side closes.
+func (r *Recorder) HandleWebSocket(w http.ResponseWriter, req *http.Request, target string) (interaction *models.Interaction, err error) {
+	ctx, span := tracing.Start(req.Context(), "Recorder.HandleWebSocket",
+		attribute.String("proxy.target", target),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	startTime := time.Now()
+
+	// Create recorded request without transport-level headers
+	recordedReq := models.FromHTTPRequest(req, nil, target)
+	RemoveHopByHopHeaders(recordedReq.Headers)
+	removeHandshakeHeaders(recordedReq.Headers)
+
+	parsedTarget, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	switch parsedTarget.Scheme {
+	case "https":
+		parsedTarget.Scheme = "wss"
+	case "http":
+		parsedTarget.Scheme = "ws"
+	}
+
+	// Forward end-to-end headers; the dialer adds the handshake itself
+	header := make(http.Header)
+	for k, values := range recordedReq.Headers {
+		header[k] = append([]string(nil), values...)
+	}
+	header.Del("Host")
+	setForwardingHeaders(header, req)
+
+	// Per-target client settings and header rules
+	upstream := r.config.UpstreamFor(parsedTarget.Host)
+	httpClient, err := r.clients.get(parsedTarget.Host, upstream)
+	if err != nil {
+		return nil, err
+	}
+	applyUpstreamHeaders(header, upstream)
+	tracing.Inject(ctx, header)
+
+	dialer := websocket.Dialer{HandshakeTimeout: upstream.TimeoutDuration()}
+	if transport, ok := httpClient.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = transport.TLSClientConfig
+		dialer.Proxy = transport.Proxy
+	}
+
+	upstreamConn, resp, err := dialer.DialContext(ctx, parsedTarget.String(), header)
+	if err != nil {
+		if resp == nil {
+			return nil, fmt.Errorf("failed to connect to upstream WebSocket: %w", err)
+		}
+		// The upstream refused the upgrade; record and relay its answer
+		// like any other response
+		return r.recordRefusedUpgrade(ctx, w, recordedReq, resp, target, startTime)
+	}
+
+	// Accept the client's upgrade with the subprotocol the upstream chose
+	responseHeader := make(http.Header)
+	for k, values := range resp.Header {
+		responseHeader[k] = values
+	}
+	RemoveHopByHopHeaders(responseHeader)
+	removeHandshakeHeaders(responseHeader)
+
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	if protocol := resp.Header.Get("Sec-Websocket-Protocol"); protocol != "" {
+		upgrader.Subprotocols = []string{protocol}
+	}
+	clientConn, err := upgrader.Upgrade(w, req, responseHeader)
+	if err != nil {
+		upstreamConn.Close()
+		return nil, fmt.Errorf("failed to upgrade client connection: %w", err)
+	}
+
+	frames := relayWebSocket(clientConn, upstreamConn)
+	span.SetAttributes(attribute.Int("websocket.frames", len(frames)))
+
+	interaction = &models.Interaction{
+		ID:        uuid.New().String(),
+		Timestamp: startTime,
+		Request:   *recordedReq,
+		Response: models.RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    responseHeader,
+		},
+		Metadata: models.InteractionMetadata{
+			Target:     target,
+			DurationMS: time.Since(startTime).Milliseconds(),
+		},
+		WebSocket: &models.WebSocketSession{Frames: frames},
+	}
+
+	// Save to repository
+	repository := storage.WithContext(r.repository, ctx)
+	keepMaxAge(repository, interaction)
+	if err := repository.Save(interaction); err != nil {
+		// Log error but don't fail the request
+		fmt.Printf("Warning: Failed to save interaction: %v\n", err)
+	}
+
+	return interaction, nil
+}
+
+// recordRefusedUpgrade stores and relays an upstream's non-101 answer
+func (r *Recorder) recordRefusedUpgrade(ctx context.Context, w http.ResponseWriter, recordedReq *models.RecordedRequest, resp *http.Response, target string, startTime time.Time) (*models.Interaction, error) {
+	body, _ := io.ReadAll(resp.Body)
+
+	recordedResp := models.FromHTTPResponse(resp, body)
+	RemoveHopByHopHeaders(recordedResp.Headers)
+	if err := recordedResp.Decompress(); err != nil {
+		fmt.Printf("Warning: Storing encoded response body: %v\n", err)
+	}
+
+	for k, values := range recordedResp.Headers {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.Header().Del("Content-Length")
+	w.WriteHeader(recordedResp.StatusCode)
+	w.Write(recordedResp.Body)
+
+	interaction := &models.Interaction{
+		ID:        uuid.New().String(),
+		Timestamp: startTime,
+		Request:   *recordedReq,
+		Response:  *recordedResp,
+		Metadata: models.InteractionMetadata{
+			Target:     target,
+			DurationMS: time.Since(startTime).Milliseconds(),
+		},
+	}
+	repository := storage.WithContext(r.repository, ctx)
+	keepMaxAge(repository, interaction)
+	if err := repository.Save(interaction); err != nil {
+		fmt.Printf("Warning: Failed to save interaction: %v\n", err)
+	}
+	return interaction, nil
+}
+
+// relayWebSocket pumps frames both ways until one side closes, and
+// returns everything that passed through
+func relayWebSocket(clientConn, upstreamConn *websocket.Conn) []models.WebSocketFrame {
+	session := newFrameRecorder()
+
+	// Control frames are forwarded as they arrive too
+	forwardControl := func(direction string, opcode int, dst *websocket.Conn) func(string) error {
+		return func(data string) error {
+			session.add(direction, opcode, []byte(data))
+			return dst.WriteControl(opcode, []byte(data), time.Now().Add(controlTimeout))
+		}
+	}
+	clientConn.SetPingHandler(forwardControl(models.FromClient, websocket.PingMessage, upstreamConn))
+	clientConn.SetPongHandler(forwardControl(models.FromClient, websocket.PongMessage, upstreamConn))
+	upstreamConn.SetPingHandler(forwardControl(models.FromServer, websocket.PingMessage, clientConn))
+	upstreamConn.SetPongHandler(forwardControl(models.FromServer, websocket.PongMessage, clientConn))
+
+	done := make(chan struct{}, 2)
+	go func() {
+		relayFrames(clientConn, upstreamConn, models.FromClient, session)
+		done <- struct{}{}
+	}()
+	go func() {
+		relayFrames(upstreamConn, clientConn, models.FromServer, session)
+		done <- struct{}{}
+	}()
+
+	// Give the other side a moment to answer the close handshake
+	<-done
+	select {
+	case <-done:
+	case <-time.After(closeGrace):
+		clientConn.Close()
+		upstreamConn.Close()
+		<-done
+	}
+	clientConn.Close()
+	upstreamConn.Close()
+
+	return session.frames
+}
+
+// relayFrames copies messages from src to dst until src closes
+func relayFrames(src, dst *websocket.Conn, direction string, session *frameRecorder) {
+	for {
+		opcode, payload, err := src.ReadMessage()
+		if err != nil {
+			if closeErr, ok := err.(*websocket.CloseError); ok {
+				message := websocket.FormatCloseMessage(closeErr.Code, closeErr.Text)
+				session.add(direction, websocket.CloseMessage, message)
+				dst.WriteControl(websocket.CloseMessage, message, time.Now().Add(controlTimeout))
+			}
+			return
+		}
+
+		session.add(direction, opcode, payload)
+		if err := dst.WriteMessage(opcode, payload); err != nil {
+			return
+		}
+	}
+}
+
+// frameRecorder collects frames from both directions of a session
+type frameRecorder struct {
+	start  time.Time
+	frames []models.WebSocketFrame
+	mu     sync.Mutex
+}
+
+func newFrameRecorder() *frameRecorder {
+	return &frameRecorder{start: time.Now()}
+}
+
+func (f *frameRecorder) add(direction string, opcode int, payload []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.frames = append(f.frames, models.WebSocketFrame{
+		Direction: direction,
+		Opcode:    opcode,
+		Payload:   payload,
+		OffsetMS:  time.Since(f.start).Milliseconds(),
+	})
+}
+
+// ReplayWebSocket plays a recorded session back to a client. Server frames
+// are sent in order, with the recorded gaps scaled by timingScale; each
+// frame the client sends is matched against the recorded client frames
+// (next in order first, then anywhere in the script) and the server frames
+// that followed it are sent in reply. Unmatched client frames get no reply.
+func (r *Player) ReplayWebSocket(w http.ResponseWriter, req *http.Request, interaction *models.Interaction, timingScale float64) error {
+	ctx, span := tracing.Start(req.Context(), "Player.ReplayWebSocket",
+		attribute.String("proxy.target", interaction.Metadata.Target),
+	)
+	defer span.End()
+
+	responseHeader := make(http.Header)
+	for k, values := range interaction.Response.Headers {
+		responseHeader[k] = values
+	}
+	removeHandshakeHeaders(responseHeader)
+
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	if protocol := responseHeader.Get("Sec-Websocket-Protocol"); protocol != "" {
+		upgrader.Subprotocols = []string{protocol}
+	}
+	conn, err := upgrader.Upgrade(w, req, responseHeader)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return fmt.Errorf("failed to upgrade client connection: %w", err)
+	}
+	defer conn.Close()
+
+	// Read client frames in the background, so a client that goes away
+	// is noticed while a recorded gap is waited out
+	type message struct {
+		opcode  int
+		payload []byte
+	}
+	messages := make(chan message, 16)
+	closed := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(closed)
+		for {
+			opcode, payload, err := conn.ReadMessage()
+			if err != nil {
+				// Client closed or went away
+				return
+			}
+			select {
+			case messages <- message{opcode, payload}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	script := interaction.WebSocket.Frames
+	cursor := 0
+	var lastOffset int64
+
+	for {
+		// Send what the server said before the client's next frame
+		for cursor < len(script) && script[cursor].Direction == models.FromServer {
+			frame := script[cursor]
+			cursor++
+
+			if gap := frame.OffsetMS - lastOffset; gap > 0 {
+				timer := time.NewTimer(time.Duration(float64(gap) * timingScale * float64(time.Millisecond)))
+				select {
+				case <-timer.C:
+				case <-closed:
+					timer.Stop()
+					return nil
+				case <-ctx.Done():
+					timer.Stop()
+					return nil
+				}
+			}
+			lastOffset = frame.OffsetMS
+
+			switch frame.Opcode {
+			case websocket.CloseMessage:
+				conn.WriteControl(websocket.CloseMessage, frame.Payload, time.Now().Add(controlTimeout))
+				return nil
+			case websocket.PingMessage, websocket.PongMessage:
+				// Keep-alives are answered live, not replayed
+			default:
+				if err := conn.WriteMessage(frame.Opcode, frame.Payload); err != nil {
+					return nil
+				}
+			}
+		}
+
+		var received message
+		select {
+		case received = <-messages:
+		case <-closed:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+
+		i := matchClientFrame(script, cursor, received.opcode, received.payload)
+		if i < 0 {
+			fmt.Printf("Warning: No recorded WebSocket frame matches client frame (%d bytes)\n", len(received.payload))
+			continue
+		}
+		cursor = i + 1
+		lastOffset = script[i].OffsetMS
+	}
+}
+
+// matchClientFrame finds the recorded client frame equal to the one
+// received, preferring the first at or after cursor
+func matchClientFrame(script []models.WebSocketFrame, cursor int, opcode int, payload []byte) int {
+	matches := func(frame models.WebSocketFrame) bool {
+		return frame.Direction == models.FromClient && frame.Opcode == opcode && bytes.Equal(frame.Payload, payload)
+	}
+	for i := cursor; i < len(script); i++ {
+		if matches(script[i]) {
+			return i
+		}
+	}
+	for i := 0; i < cursor && i < len(script); i++ {
+		if matches(script[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeHandshakeHeaders drops per-connection handshake headers
+func removeHandshakeHeaders(header map[string][]string) {
+	for _, name := range handshakeHeaders {
+		delete(header, name)
+	}
+}
@@ -0,0 +1,50 @@
+package mode
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+func TestReplayWebSocketStopsWhenClientLeaves(t *testing.T) {
+	interaction := &models.Interaction{
+		WebSocket: &models.WebSocketSession{Frames: []models.WebSocketFrame{
+			{Direction: models.FromServer, Opcode: websocket.TextMessage, Payload: []byte("hello")},
+			{Direction: models.FromServer, Opcode: websocket.TextMessage, Payload: []byte("much later"), OffsetMS: 60000},
+		}},
+	}
+	player := NewPlayer(config.New(), nil)
+
+	done := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done <- player.ReplayWebSocket(w, r, interaction, 1)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, payload, err := conn.ReadMessage(); err != nil || string(payload) != "hello" {
+		t.Fatalf("Expected the first frame, got %q (%v)", payload, err)
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	conn.Close()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected a clean return, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Replay kept waiting out the recorded gap after the client left")
+	}
+}
@@ -4,9 +4,14 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/pismo/testing-proxy/internal/compression"
+	"github.com/pismo/testing-proxy/internal/formdata"
+	"github.com/pismo/testing-proxy/internal/graphql"
 )
 
 // Interaction represents a recorded HTTP request/response pair
@@ -16,6 +21,45 @@ type Interaction struct {
 	Request   RecordedRequest   `json:"request"`
 	Response  RecordedResponse  `json:"response"`
 	Metadata  InteractionMetadata `json:"metadata"`
+
+	// WebSocket holds the frames exchanged after a WebSocket upgrade
+	WebSocket *WebSocketSession `json:"websocket,omitempty"`
+
+	// MaxAge is how many seconds the recording stays fresh, overriding
+	// the target's ttl; 0 defers to the ttl
+	MaxAge int64 `json:"max_age,omitempty"`
+}
+
+// ExpiresAt returns when the recording goes stale: MaxAge, or else ttl,
+// after it was recorded. The zero time means it never does.
+func (i *Interaction) ExpiresAt(ttl time.Duration) time.Time {
+	if i.MaxAge > 0 {
+		ttl = time.Duration(i.MaxAge) * time.Second
+	}
+	if ttl <= 0 || i.Timestamp.IsZero() {
+		return time.Time{}
+	}
+	return i.Timestamp.Add(ttl)
+}
+
+// Frame directions in a WebSocket session
+const (
+	FromClient = "client"
+	FromServer = "server"
+)
+
+// WebSocketSession is the script of a recorded WebSocket connection
+type WebSocketSession struct {
+	Frames []WebSocketFrame `json:"frames"`
+}
+
+// WebSocketFrame is one message or control frame, received OffsetMS
+// milliseconds after the upgrade
+type WebSocketFrame struct {
+	Direction string `json:"direction"`
+	Opcode    int    `json:"opcode"`
+	Payload   []byte `json:"payload,omitempty"`
+	OffsetMS  int64  `json:"offset_ms"`
 }
 
 // RecordedRequest contains the recorded request details
@@ -24,6 +68,20 @@ type RecordedRequest struct {
 	URL     string              `json:"url"`
 	Headers map[string][]string `json:"headers"`
 	Body    []byte              `json:"body,omitempty"`
+
+	// Large bodies are stored out of line: BodyRef names the blob and
+	// BodyHash carries the request hash computed while streaming it
+	BodyRef  string `json:"body_ref,omitempty"`
+	BodySize int64  `json:"body_size,omitempty"`
+	BodyHash string `json:"body_hash,omitempty"`
+
+	// GraphQL is set for targets in GraphQL mode; requests then match on
+	// the normalized operation instead of the raw body
+	GraphQL *graphql.Operation `json:"graphql,omitempty"`
+
+	// Multipart lists the parts of a multipart/form-data body; such
+	// requests match on the parts, so the random boundary doesn't matter
+	Multipart []formdata.Part `json:"multipart,omitempty"`
 }
 
 // RecordedResponse contains the recorded response details
@@ -31,6 +89,56 @@ type RecordedResponse struct {
 	StatusCode int                 `json:"status_code"`
 	Headers    map[string][]string `json:"headers"`
 	Body       []byte              `json:"body,omitempty"`
+
+	// ContentEncoding is the upstream's original Content-Encoding. Body is
+	// stored decoded, and re-encoded on playback to suit the client.
+	ContentEncoding string `json:"content_encoding,omitempty"`
+
+	// Large bodies are stored out of line in the blob named by BodyRef
+	BodyRef  string `json:"body_ref,omitempty"`
+	BodySize int64  `json:"body_size,omitempty"`
+
+	// BodyDigest names the blob a deduplicated body is stored in. Only
+	// recording files carry it; storage puts the body back on load.
+	BodyDigest string `json:"body_digest,omitempty"`
+
+	// Trailers sent after the body, e.g. grpc-status for gRPC calls
+	Trailers map[string][]string `json:"trailers,omitempty"`
+
+	// Chunks splits a streamed body (SSE events, NDJSON lines) into the
+	// pieces the upstream sent, in order, so playback can repeat its timing
+	Chunks []Chunk `json:"chunks,omitempty"`
+}
+
+// Chunk is one piece of a streamed body: the next Size bytes of the body,
+// received OffsetMS milliseconds after the response headers
+type Chunk struct {
+	OffsetMS int64 `json:"offset_ms"`
+	Size     int64 `json:"size"`
+}
+
+// Decompress decodes a body stored with its Content-Encoding (as received
+// from the upstream, or in recordings made before bodies were stored
+// decoded). The encoding moves to ContentEncoding and the headers that
+// describe the encoded bytes are dropped. Unsupported encodings are left
+// untouched and reported as an error.
+func (r *RecordedResponse) Decompress() error {
+	headers := http.Header(r.Headers)
+	encoding := headers.Get("Content-Encoding")
+	if encoding == "" {
+		return nil
+	}
+
+	decoded, err := compression.Decode(encoding, r.Body)
+	if err != nil {
+		return err
+	}
+
+	r.Body = decoded
+	r.ContentEncoding = encoding
+	headers.Del("Content-Encoding")
+	headers.Del("Content-Length")
+	return nil
 }
 
 // InteractionMetadata contains additional information about the interaction
@@ -43,11 +151,19 @@ type InteractionMetadata struct {
 // Uses simplified match strategy: URL + Method + Body (excludes headers)
 // This allows different HTTP clients to match the same recordings
 func (r *RecordedRequest) GenerateHash() string {
-	h := sha256.New()
+	if r.GraphQL != nil {
+		return r.graphQLHash()
+	}
+	if r.Multipart != nil {
+		return r.multipartHash()
+	}
 
-	// Add method and URL
-	h.Write([]byte(r.Method))
-	h.Write([]byte(r.URL))
+	// Out-of-line bodies were hashed while streaming
+	if r.BodyRef != "" && r.Body == nil && r.BodyHash != "" {
+		return r.BodyHash
+	}
+
+	h := NewRequestHasher(r.Method, r.URL)
 
 	// NOTE: Headers are intentionally excluded from hashing
 	// Different HTTP clients send different auto-generated headers
@@ -62,6 +178,41 @@ func (r *RecordedRequest) GenerateHash() string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// graphQLHash matches on operation name, normalized query and variables
+func (r *RecordedRequest) graphQLHash() string {
+	h := NewRequestHasher(r.Method, r.URL)
+	h.Write([]byte("graphql\x00" + r.GraphQL.Name + "\x00" + r.GraphQL.Query + "\x00"))
+	h.Write(r.GraphQL.Variables)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// multipartHash matches on each part's name, filename, content type and
+// content, skipping ignored parts
+func (r *RecordedRequest) multipartHash() string {
+	h := NewRequestHasher(r.Method, r.URL)
+	h.Write([]byte("multipart\x00"))
+	for _, part := range r.Multipart {
+		if part.Ignored {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00", part.Name, part.Filename, part.ContentType, part.Hash)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NewRequestHasher starts a request hash; write the body to it and
+// hex-encode Sum(nil) to get the same value as GenerateHash. This lets
+// large bodies be hashed without holding them in memory.
+func NewRequestHasher(method, url string) hash.Hash {
+	h := sha256.New()
+
+	// Add method and URL
+	h.Write([]byte(method))
+	h.Write([]byte(url))
+
+	return h
+}
+
 // ToHTTPRequest converts RecordedRequest to http.Request for forwarding
 func (r *RecordedRequest) ToHTTPRequest(targetURL string) (*http.Request, error) {
 	// Build the full URL
@@ -88,11 +239,18 @@ func (r *RecordedRequest) ToHTTPRequest(targetURL string) (*http.Request, error)
 	return req, nil
 }
 
+// NormalizeTarget returns the form a target is recorded under. The proxy
+// sends scheme-less targets over https, so an explicit https:// is
+// dropped and both spellings find the same recording; http:// is kept.
+func NormalizeTarget(target string) string {
+	return strings.TrimPrefix(target, "https://")
+}
+
 // FromHTTPRequest creates a RecordedRequest from an http.Request
 func FromHTTPRequest(req *http.Request, body []byte, target string) *RecordedRequest {
 	recorded := &RecordedRequest{
 		Method:  req.Method,
-		URL:     target, // Store the full target URL
+		URL:     NormalizeTarget(target), // Store the target as NormalizeTarget records it
 		Headers: make(map[string][]string),
 	}
 
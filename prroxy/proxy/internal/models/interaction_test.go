@@ -4,6 +4,9 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/pismo/testing-proxy/internal/graphql"
 )
 
 func TestGenerateHash(t *testing.T) {
@@ -111,6 +114,36 @@ func TestGenerateHash(t *testing.T) {
 			},
 			shouldMatch: true,
 		},
+		{
+			name: "GraphQL requests match on the operation, not the raw body",
+			request1: RecordedRequest{
+				Method:  "POST",
+				URL:     "/graphql",
+				Body:    []byte(`{"query":"{ me { id } }"}`),
+				GraphQL: &graphql.Operation{Query: "{me{id}}"},
+			},
+			request2: RecordedRequest{
+				Method:  "POST",
+				URL:     "/graphql",
+				Body:    []byte(`{"query":"{me{id}}"}`),
+				GraphQL: &graphql.Operation{Query: "{me{id}}"},
+			},
+			shouldMatch: true,
+		},
+		{
+			name: "GraphQL variables are part of the hash",
+			request1: RecordedRequest{
+				Method:  "POST",
+				URL:     "/graphql",
+				GraphQL: &graphql.Operation{Name: "User", Query: "query User($id:ID){user(id:$id){name}}", Variables: []byte(`{"id":"1"}`)},
+			},
+			request2: RecordedRequest{
+				Method:  "POST",
+				URL:     "/graphql",
+				GraphQL: &graphql.Operation{Name: "User", Query: "query User($id:ID){user(id:$id){name}}", Variables: []byte(`{"id":"2"}`)},
+			},
+			shouldMatch: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -346,6 +379,30 @@ func TestFromHTTPResponse(t *testing.T) {
 	}
 }
 
+func TestExpiresAt(t *testing.T) {
+	recorded := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		maxAge int64
+		ttl    time.Duration
+		want   time.Time
+	}{
+		{"no policy never expires", 0, 0, time.Time{}},
+		{"ttl from config", 0, time.Hour, recorded.Add(time.Hour)},
+		{"max_age overrides ttl", 60, time.Hour, recorded.Add(time.Minute)},
+		{"max_age without ttl", 60, 0, recorded.Add(time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interaction := &Interaction{Timestamp: recorded, MaxAge: tt.maxAge}
+			if got := interaction.ExpiresAt(tt.ttl); !got.Equal(tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
 // Helper function
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -0,0 +1,216 @@
+package rewrite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path is a compiled JSONPath expression. The supported subset is $,
+// .name, ['name'], [n], .* and [*] for any child, and ..name (or ..*,
+// ..[n]) to look at any depth.
+type Path struct {
+	steps []step
+}
+
+type step struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+	descend  bool // Matches at any depth below the previous step
+}
+
+// segment is one level of a concrete location in a document
+type segment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// ParsePath compiles a JSONPath expression
+func ParsePath(expr string) (*Path, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("path must start with $: %s", expr)
+	}
+
+	var steps []step
+	rest := expr[1:]
+	for rest != "" {
+		descend := strings.HasPrefix(rest, "..")
+		switch {
+		case descend:
+			rest = rest[2:]
+		case rest[0] == '.':
+			rest = rest[1:]
+		case rest[0] != '[':
+			return nil, fmt.Errorf("unexpected %q in path %s", rest[0], expr)
+		}
+
+		var s step
+		if strings.HasPrefix(rest, "[") {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in path %s", expr)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+
+			switch {
+			case inner == "*":
+				s.wildcard = true
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				s.name = inner[1 : len(inner)-1]
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid index %q in path %s", inner, expr)
+				}
+				s.index, s.isIndex = n, true
+			}
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			s.name, rest = rest[:end], rest[end:]
+			if s.name == "" {
+				return nil, fmt.Errorf("missing name in path %s", expr)
+			}
+			s.wildcard = s.name == "*"
+		}
+		s.descend = descend
+		steps = append(steps, s)
+	}
+	return &Path{steps: steps}, nil
+}
+
+// Replace calls fn with the raw JSON of every value the path selects and
+// splices in the results, leaving the rest of the document byte for byte
+// as it was. It reports false when data isn't JSON or nothing changed.
+func (p *Path) Replace(data []byte, fn func(raw []byte) ([]byte, bool)) ([]byte, bool) {
+	if !json.Valid(data) {
+		return data, false
+	}
+
+	type edit struct {
+		start, end int
+		text       []byte
+	}
+	var edits []edit
+	walk(data, 0, nil, func(path []segment, start, end int) {
+		if !matchSteps(p.steps, path) {
+			return
+		}
+		text, ok := fn(data[start:end])
+		if !ok {
+			return
+		}
+		// Values are visited after the values inside them, whose edits
+		// the replacement supersedes
+		for len(edits) > 0 && edits[len(edits)-1].start >= start {
+			edits = edits[:len(edits)-1]
+		}
+		edits = append(edits, edit{start, end, text})
+	})
+	if len(edits) == 0 {
+		return data, false
+	}
+
+	var out bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		out.Write(data[last:e.start])
+		out.Write(e.text)
+		last = e.end
+	}
+	out.Write(data[last:])
+	return out.Bytes(), true
+}
+
+// matchSteps reports whether a concrete location matches the steps
+func matchSteps(steps []step, path []segment) bool {
+	if len(steps) == 0 {
+		return len(path) == 0
+	}
+	s := steps[0]
+	if !s.descend {
+		return len(path) > 0 && s.matches(path[0]) && matchSteps(steps[1:], path[1:])
+	}
+	for i := range path {
+		if s.matches(path[i]) && matchSteps(steps[1:], path[i+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s step) matches(seg segment) bool {
+	switch {
+	case s.wildcard:
+		return true
+	case s.isIndex:
+		return seg.isIndex && seg.index == s.index
+	default:
+		return !seg.isIndex && seg.key == s.name
+	}
+}
+
+// walk visits the value at data[i] and everything inside it, innermost
+// first, with each value's location and byte range. data must be valid
+// JSON. It returns the offset after the value.
+func walk(data []byte, i int, path []segment, visit func(path []segment, start, end int)) int {
+	i = skipSpace(data, i)
+	start := i
+	switch data[i] {
+	case '{':
+		i = skipSpace(data, i+1)
+		for data[i] != '}' {
+			keyEnd := skipString(data, i)
+			var key string
+			json.Unmarshal(data[i:keyEnd], &key)
+			i = skipSpace(data, keyEnd) + 1 // The colon
+			i = skipSpace(data, walk(data, i, append(path, segment{key: key}), visit))
+			if data[i] == ',' {
+				i = skipSpace(data, i+1)
+			}
+		}
+		i++
+	case '[':
+		i = skipSpace(data, i+1)
+		for n := 0; data[i] != ']'; n++ {
+			i = skipSpace(data, walk(data, i, append(path, segment{index: n, isIndex: true}), visit))
+			if data[i] == ',' {
+				i = skipSpace(data, i+1)
+			}
+		}
+		i++
+	case '"':
+		i = skipString(data, i)
+	default:
+		for i < len(data) && !strings.ContainsRune(",}] \t\r\n", rune(data[i])) {
+			i++
+		}
+	}
+	visit(path, start, i)
+	return i
+}
+
+// skipString returns the offset after the string starting at data[i]
+func skipString(data []byte, i int) int {
+	for i++; data[i] != '"'; i++ {
+		if data[i] == '\\' {
+			i++
+		}
+	}
+	return i + 1
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && strings.ContainsRune(" \t\r\n", rune(data[i])) {
+		i++
+	}
+	return i
+}
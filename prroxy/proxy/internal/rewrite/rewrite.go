@@ -0,0 +1,214 @@
+// Package rewrite applies per-target replacement rules to recorded
+// response headers and bodies
+package rewrite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+// Phases a rule can apply in
+const (
+	Record   = "record"   // Before saving, so the rewritten response is persisted
+	Playback = "playback" // On the fly, leaving the recording untouched
+)
+
+// Rule replaces text in a response. With Header set it rewrites that
+// header's values; with Path it rewrites the JSON body values the path
+// selects; otherwise Match runs over the whole body.
+type Rule struct {
+	Apply   string `json:"apply" yaml:"apply"`     // "record" (default) or "playback"
+	Header  string `json:"header" yaml:"header"`   // Response header to rewrite instead of the body
+	Path    string `json:"path" yaml:"path"`       // JSONPath into the body, e.g. "$..url"
+	Match   string `json:"match" yaml:"match"`     // Regular expression; empty replaces whole values
+	Replace string `json:"replace" yaml:"replace"` // Replacement, $1 expands a group
+}
+
+// Phase returns when the rule applies
+func (r Rule) Phase() string {
+	if r.Apply == "" {
+		return Record
+	}
+	return r.Apply
+}
+
+// compiled is a rule with its expressions parsed
+type compiled struct {
+	Rule
+	match *regexp.Regexp
+	path  *Path
+}
+
+// cache holds compiled rules for Apply; configured rules are few and
+// reused. Rules that are only validated or previewed are not cached, so
+// clients trying rules out can't grow it.
+var cache sync.Map // Rule -> *compiled
+
+// Validate checks that the rule is complete and its expressions parse
+func (r Rule) Validate() error {
+	_, err := build(r)
+	return err
+}
+
+// compile returns the cached compiled rule, building it on first use
+func compile(r Rule) (*compiled, error) {
+	if c, ok := cache.Load(r); ok {
+		return c.(*compiled), nil
+	}
+
+	c, err := build(r)
+	if err != nil {
+		return nil, err
+	}
+	cache.Store(r, c)
+	return c, nil
+}
+
+// build parses the rule's expressions
+func build(r Rule) (*compiled, error) {
+	if r.Phase() != Record && r.Phase() != Playback {
+		return nil, fmt.Errorf("apply must be record or playback, got %q", r.Apply)
+	}
+	if r.Header != "" && r.Path != "" {
+		return nil, fmt.Errorf("use either header or path, not both")
+	}
+	if r.Header == "" && r.Path == "" && r.Match == "" {
+		return nil, fmt.Errorf("a body rule needs match or path")
+	}
+
+	c := &compiled{Rule: r}
+	if r.Match != "" {
+		match, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match: %w", err)
+		}
+		c.match = match
+	}
+	if r.Path != "" {
+		path, err := ParsePath(r.Path)
+		if err != nil {
+			return nil, err
+		}
+		c.path = path
+	}
+
+	return c, nil
+}
+
+// HasPhase reports whether any of the rules apply in phase
+func HasPhase(rules []Rule, phase string) bool {
+	for _, rule := range rules {
+		if rule.Phase() == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply runs the rules for phase on resp and reports whether it changed.
+// Bodies stored as blobs or recorded as timed chunks are left alone.
+func Apply(rules []Rule, phase string, resp *models.RecordedResponse) bool {
+	changed := false
+	for _, rule := range rules {
+		if rule.Phase() != phase {
+			continue
+		}
+		c, err := compile(rule)
+		if err != nil {
+			fmt.Printf("Warning: Skipping rewrite rule: %v\n", err)
+			continue
+		}
+		if c.apply(resp) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Preview returns a copy of resp with every rule applied, whatever its
+// phase, for trying rules out against a recording
+func Preview(rules []Rule, resp models.RecordedResponse) (models.RecordedResponse, error) {
+	headers := make(map[string][]string, len(resp.Headers))
+	for key, values := range resp.Headers {
+		headers[key] = append([]string(nil), values...)
+	}
+	resp.Headers = headers
+
+	for i, rule := range rules {
+		c, err := build(rule)
+		if err != nil {
+			return resp, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		c.apply(&resp)
+	}
+	return resp, nil
+}
+
+func (c *compiled) apply(resp *models.RecordedResponse) bool {
+	if c.Header != "" {
+		values := resp.Headers[http.CanonicalHeaderKey(c.Header)]
+		changed := false
+		for i, value := range values {
+			if rewritten := c.replace(value); rewritten != value {
+				values[i] = rewritten
+				changed = true
+			}
+		}
+		return changed
+	}
+
+	if len(resp.Body) == 0 || resp.BodyRef != "" || resp.Chunks != nil {
+		return false
+	}
+
+	var body []byte
+	var changed bool
+	if c.path != nil {
+		body, changed = c.path.Replace(resp.Body, c.replaceJSON)
+	} else {
+		body = c.match.ReplaceAll(resp.Body, []byte(c.Replace))
+		changed = !bytes.Equal(body, resp.Body)
+	}
+	if !changed {
+		return false
+	}
+
+	resp.Body = body
+	// A stale length would truncate or stall clients on playback
+	delete(resp.Headers, "Content-Length")
+	return true
+}
+
+// replace rewrites one string: matches of the expression, or all of it
+func (c *compiled) replace(value string) string {
+	if c.match == nil {
+		return c.Replace
+	}
+	return c.match.ReplaceAllString(value, c.Replace)
+}
+
+// replaceJSON rewrites a selected JSON value. With a match only strings
+// change; without one the whole value becomes the replacement string.
+func (c *compiled) replaceJSON(raw []byte) ([]byte, bool) {
+	var value string
+	if c.match != nil {
+		if raw[0] != '"' || json.Unmarshal(raw, &value) != nil {
+			return nil, false
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(c.replace(value)); err != nil {
+		return nil, false
+	}
+	text := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	return text, !bytes.Equal(text, raw)
+}
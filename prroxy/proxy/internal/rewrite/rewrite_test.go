@@ -0,0 +1,194 @@
+package rewrite
+
+import (
+	"testing"
+
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		valid   bool
+		matches [][]segment
+		misses  [][]segment
+	}{
+		{"$", true, [][]segment{{}}, [][]segment{{{key: "a"}}}},
+		{"$.a.b", true, [][]segment{{{key: "a"}, {key: "b"}}}, [][]segment{{{key: "a"}}}},
+		{"$['a b'][2]", true, [][]segment{{{key: "a b"}, {index: 2, isIndex: true}}}, [][]segment{{{key: "a b"}, {key: "2"}}}},
+		{"$.items[*].url", true, [][]segment{{{key: "items"}, {index: 7, isIndex: true}, {key: "url"}}}, nil},
+		{"$..url", true, [][]segment{{{key: "url"}}, {{key: "a"}, {index: 0, isIndex: true}, {key: "url"}}}, [][]segment{{{key: "url"}, {key: "x"}}}},
+		{"$..[0]", true, [][]segment{{{key: "a"}, {index: 0, isIndex: true}}}, nil},
+		{"a.b", false, nil, nil},
+		{"$.", false, nil, nil},
+		{"$[x]", false, nil, nil},
+		{"$[0", false, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path, err := ParsePath(tt.path)
+			if (err == nil) != tt.valid {
+				t.Fatalf("Expected valid=%v, got %v", tt.valid, err)
+			}
+			for _, location := range tt.matches {
+				if !matchSteps(path.steps, location) {
+					t.Errorf("Expected a match for %+v", location)
+				}
+			}
+			for _, location := range tt.misses {
+				if matchSteps(path.steps, location) {
+					t.Errorf("Expected no match for %+v", location)
+				}
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	body := `{
+  "id": 1,
+  "website": "https://jsonplaceholder.typicode.com/users/1",
+  "links": [{"url": "https://jsonplaceholder.typicode.com/posts"}, {"url": 3}]
+}`
+	newResponse := func() *models.RecordedResponse {
+		return &models.RecordedResponse{
+			StatusCode: 200,
+			Headers: map[string][]string{
+				"Location":       {"https://jsonplaceholder.typicode.com/users/1"},
+				"Content-Length": {"140"},
+			},
+			Body: []byte(body),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		headers string
+		body    string
+	}{
+		{
+			name:    "Header regex",
+			rule:    Rule{Header: "location", Match: `https://[^/]+`, Replace: "http://api.local"},
+			headers: "http://api.local/users/1",
+			body:    body,
+		},
+		{
+			name: "JSONPath regex keeps the layout",
+			rule: Rule{Path: "$..url", Match: `jsonplaceholder\.typicode\.com`, Replace: "api.local"},
+			body: `{
+  "id": 1,
+  "website": "https://jsonplaceholder.typicode.com/users/1",
+  "links": [{"url": "https://api.local/posts"}, {"url": 3}]
+}`,
+		},
+		{
+			name: "JSONPath without match replaces the value",
+			rule: Rule{Path: "$.id", Replace: "<id>"},
+			body: `{
+  "id": "<id>",
+  "website": "https://jsonplaceholder.typicode.com/users/1",
+  "links": [{"url": "https://jsonplaceholder.typicode.com/posts"}, {"url": 3}]
+}`,
+		},
+		{
+			name: "Body regex",
+			rule: Rule{Match: `https://jsonplaceholder\.typicode\.com`, Replace: "$$BASE_URL"},
+			body: `{
+  "id": 1,
+  "website": "$BASE_URL/users/1",
+  "links": [{"url": "$BASE_URL/posts"}, {"url": 3}]
+}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); err != nil {
+				t.Fatalf("Invalid rule: %v", err)
+			}
+			resp := newResponse()
+			changed := Apply([]Rule{tt.rule}, Record, resp)
+			if !changed {
+				t.Fatalf("Expected a change")
+			}
+			if string(resp.Body) != tt.body {
+				t.Errorf("Unexpected body:\n%s", resp.Body)
+			}
+			if tt.headers != "" && resp.Headers["Location"][0] != tt.headers {
+				t.Errorf("Unexpected header: %s", resp.Headers["Location"][0])
+			}
+			if _, ok := resp.Headers["Content-Length"]; ok == (tt.rule.Header == "") {
+				t.Errorf("Content-Length should only be dropped when the body changes")
+			}
+		})
+	}
+
+	t.Run("Rules only apply in their phase", func(t *testing.T) {
+		resp := newResponse()
+		rule := Rule{Apply: Playback, Header: "Location", Replace: "/"}
+		if Apply([]Rule{rule}, Record, resp) {
+			t.Errorf("Expected a playback rule to be skipped at record time")
+		}
+		if !Apply([]Rule{rule}, Playback, resp) || resp.Headers["Location"][0] != "/" {
+			t.Errorf("Expected the playback rule to apply: %v", resp.Headers)
+		}
+	})
+
+	t.Run("Blob bodies are left alone", func(t *testing.T) {
+		resp := &models.RecordedResponse{StatusCode: 200, BodyRef: "abc"}
+		if Apply([]Rule{{Match: ".", Replace: "x"}}, Record, resp) {
+			t.Errorf("Expected no change")
+		}
+	})
+
+	t.Run("Preview leaves the response alone", func(t *testing.T) {
+		resp := newResponse()
+		preview, err := Preview([]Rule{{Apply: Playback, Header: "Location", Replace: "/"}, {Path: "$.id", Replace: "x"}}, *resp)
+		if err != nil {
+			t.Fatalf("Preview failed: %v", err)
+		}
+		if preview.Headers["Location"][0] != "/" || string(preview.Body) == body {
+			t.Errorf("Expected both rules applied: %+v", preview)
+		}
+		if resp.Headers["Location"][0] == "/" || string(resp.Body) != body {
+			t.Errorf("Preview changed the original")
+		}
+	})
+
+	t.Run("Previewed and validated rules are not cached", func(t *testing.T) {
+		rule := Rule{Match: "preview-only", Replace: "x"}
+		Preview([]Rule{rule}, *newResponse())
+		rule.Validate()
+		if _, ok := cache.Load(rule); ok {
+			t.Errorf("Expected the rule to stay out of the cache")
+		}
+
+		Apply([]Rule{rule}, Record, newResponse())
+		if _, ok := cache.Load(rule); !ok {
+			t.Errorf("Expected applied rules to be cached")
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"Unknown phase", Rule{Apply: "always", Match: "a"}},
+		{"Header and path", Rule{Header: "Location", Path: "$.a"}},
+		{"Body rule without match", Rule{Replace: "x"}},
+		{"Bad regex", Rule{Match: "("}},
+		{"Bad path", Rule{Path: "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
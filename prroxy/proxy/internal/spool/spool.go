@@ -0,0 +1,119 @@
+package spool
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DefaultThreshold is the size above which bodies leave memory
+const DefaultThreshold = 1 << 20 // 1 MiB
+
+// Spool collects a body of unknown size. It stays in memory up to the
+// threshold and spills to a temporary file beyond it, so large uploads
+// and downloads never have to fit in memory. A Spool can be re-read any
+// number of times with Open.
+type Spool struct {
+	threshold int64
+	buf       bytes.Buffer
+	file      *os.File
+	size      int64
+}
+
+// New creates an empty spool that spills above threshold bytes
+func New(threshold int64) *Spool {
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	return &Spool{threshold: threshold}
+}
+
+// FromBytes wraps an in-memory body
+func FromBytes(body []byte) *Spool {
+	s := &Spool{threshold: int64(len(body)) + 1}
+	s.buf.Write(body)
+	s.size = int64(len(body))
+	return s
+}
+
+// Read fully drains r into a new spool
+func Read(r io.Reader, threshold int64) (*Spool, error) {
+	s := New(threshold)
+	if r == nil {
+		return s, nil
+	}
+	if _, err := io.Copy(s, r); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write appends to the spool, spilling to disk once over the threshold
+func (s *Spool) Write(p []byte) (int, error) {
+	if s.file == nil && int64(s.buf.Len()+len(p)) > s.threshold {
+		file, err := os.CreateTemp("", "proxy-spool-*")
+		if err != nil {
+			return 0, fmt.Errorf("failed to create spool file: %w", err)
+		}
+		if _, err := file.Write(s.buf.Bytes()); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return 0, fmt.Errorf("failed to spill spool: %w", err)
+		}
+		s.file = file
+		s.buf = bytes.Buffer{}
+	}
+
+	var n int
+	var err error
+	if s.file != nil {
+		n, err = s.file.Write(p)
+	} else {
+		n, err = s.buf.Write(p)
+	}
+	s.size += int64(n)
+	return n, err
+}
+
+// Len returns the number of bytes written
+func (s *Spool) Len() int64 {
+	return s.size
+}
+
+// InMemory reports whether the body is still held in memory
+func (s *Spool) InMemory() bool {
+	return s.file == nil
+}
+
+// Bytes returns the body if it is in memory, nil otherwise
+func (s *Spool) Bytes() []byte {
+	if s.file != nil {
+		return nil
+	}
+	return s.buf.Bytes()
+}
+
+// Open returns a reader over the whole body from the start
+func (s *Spool) Open() (io.ReadCloser, error) {
+	if s.file == nil {
+		return io.NopCloser(bytes.NewReader(s.buf.Bytes())), nil
+	}
+	file, err := os.Open(s.file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to reopen spool file: %w", err)
+	}
+	return file, nil
+}
+
+// Close releases the temporary file, if any
+func (s *Spool) Close() error {
+	if s == nil || s.file == nil {
+		return nil
+	}
+	name := s.file.Name()
+	s.file.Close()
+	s.file = nil
+	return os.Remove(name)
+}
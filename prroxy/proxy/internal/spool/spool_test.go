@@ -0,0 +1,72 @@
+package spool
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	t.Run("Small bodies stay in memory", func(t *testing.T) {
+		s, err := Read(strings.NewReader("hello"), 16)
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		defer s.Close()
+
+		if !s.InMemory() {
+			t.Error("Expected body to stay in memory")
+		}
+		if string(s.Bytes()) != "hello" || s.Len() != 5 {
+			t.Errorf("Unexpected contents %q (len %d)", s.Bytes(), s.Len())
+		}
+	})
+
+	t.Run("Large bodies spill to disk", func(t *testing.T) {
+		body := bytes.Repeat([]byte("x"), 100)
+		s, err := Read(bytes.NewReader(body), 16)
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+
+		if s.InMemory() || s.Bytes() != nil {
+			t.Fatal("Expected body to spill to disk")
+		}
+		if s.Len() != 100 {
+			t.Errorf("Expected length 100, got %d", s.Len())
+		}
+
+		// Can be read more than once
+		for i := 0; i < 2; i++ {
+			reader, err := s.Open()
+			if err != nil {
+				t.Fatalf("Failed to open: %v", err)
+			}
+			got, _ := io.ReadAll(reader)
+			reader.Close()
+			if !bytes.Equal(got, body) {
+				t.Errorf("Read %d returned %d bytes, want %d", i, len(got), len(body))
+			}
+		}
+
+		name := s.file.Name()
+		if err := s.Close(); err != nil {
+			t.Fatalf("Failed to close: %v", err)
+		}
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Error("Expected temporary file to be removed on Close")
+		}
+	})
+
+	t.Run("Nil reader gives an empty spool", func(t *testing.T) {
+		s, err := Read(nil, 0)
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		if s.Len() != 0 || !s.InMemory() {
+			t.Errorf("Expected empty in-memory spool, got len %d", s.Len())
+		}
+	})
+}
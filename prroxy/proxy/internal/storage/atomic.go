@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lockName is the advisory lock file shared by every process writing to
+// the recordings directory
+const lockName = ".lock"
+
+// tmpPrefix marks files still being written; they are renamed into place
+// once complete, so readers never see a partial recording or blob
+const tmpPrefix = ".tmp-"
+
+// staleTempAge is how old a temporary file must be before Verify treats
+// it as left behind by a crash rather than a write in progress
+const staleTempAge = time.Minute
+
+// writeFile atomically replaces path with data: it writes and fsyncs a
+// temporary file in the same directory, renames it over path and fsyncs
+// the directory, so a crash leaves either the old file or the new one
+func writeFile(path string, data []byte) error {
+	tmp, err := createTemp(filepath.Dir(path), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	return commitTemp(tmp, path)
+}
+
+// createTemp writes a temporary file in dir and fsyncs it. The caller
+// moves it into place with commitTemp and removes it if that fails.
+func createTemp(dir string, write func(io.Writer) error) (string, error) {
+	tmp, err := os.CreateTemp(dir, tmpPrefix+"*")
+	if err != nil {
+		return "", err
+	}
+
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// commitTemp renames a finished temporary file over path, readable like
+// any other recording, and fsyncs the directory
+func commitTemp(tmp, path string) error {
+	if err := os.Chmod(tmp, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// lock takes the advisory lock on the recordings directory, so writers in
+// other processes sharing it wait their turn. Readers don't need it since
+// files are only ever replaced by rename.
+func (r *FileSystemRepository) lock() (func(), error) {
+	file, err := os.OpenFile(filepath.Join(r.basePath, lockName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock recordings directory: %w", err)
+	}
+
+	return func() {
+		unlockFile(file)
+		file.Close()
+	}, nil
+}
+
+// isTemp reports whether name is an unfinished write
+func isTemp(name string) bool {
+	return strings.HasPrefix(name, tmpPrefix)
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+func TestAtomicWrites(t *testing.T) {
+	newInteraction := func(target string, body string) *models.Interaction {
+		return &models.Interaction{
+			Request:  models.RecordedRequest{Method: "GET", URL: "/shared"},
+			Response: models.RecordedResponse{StatusCode: 200, Body: []byte(body)},
+			Metadata: models.InteractionMetadata{Target: target},
+		}
+	}
+
+	t.Run("Readers never see a partial file", func(t *testing.T) {
+		dir := t.TempDir()
+		writer, _ := NewFileSystemRepository(dir)
+		reader, _ := NewFileSystemRepository(dir)
+
+		interaction := newInteraction("api.example.com", strings.Repeat("x", 1<<20))
+		hash := interaction.Request.GenerateHash()
+		if err := writer.Save(interaction); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 20; i++ {
+				writer.Save(interaction)
+			}
+		}()
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := reader.Find(hash); err != nil {
+				t.Fatalf("Reader saw a damaged recording: %v", err)
+			}
+		}
+	})
+
+	t.Run("Interrupted write leaves the store intact", func(t *testing.T) {
+		dir := t.TempDir()
+		repo, _ := NewFileSystemRepository(dir)
+		interaction := newInteraction("api.example.com", "complete")
+		repo.Save(interaction)
+
+		// A crash between writing and renaming leaves only the temp file
+		tmp := filepath.Join(dir, "api_example_com", tmpPrefix+"123456")
+		os.WriteFile(tmp, []byte(`{"request":{"met`), 0644)
+
+		found, err := repo.Find(interaction.Request.GenerateHash())
+		if err != nil || string(found.Response.Body) != "complete" {
+			t.Fatalf("Expected the previous recording, got %v", err)
+		}
+		if count, _ := repo.Count(); count != 1 {
+			t.Errorf("Expected 1 recording, got %d", count)
+		}
+
+		// Only reported once it's too old to be a write in progress
+		if problems, _ := repo.Verify(); len(problems) != 0 {
+			t.Errorf("Expected a fresh temp file to be ignored, got %+v", problems)
+		}
+		old := time.Now().Add(-2 * staleTempAge)
+		os.Chtimes(tmp, old, old)
+		problems, _ := repo.Verify()
+		if len(problems) != 1 || problems[0].Kind != ProblemInterrupted {
+			t.Errorf("Expected an interrupted write, got %+v", problems)
+		}
+	})
+
+	t.Run("Failed write keeps the old file and no temp", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "old.json")
+		os.WriteFile(path, []byte("old"), 0644)
+
+		// Renaming a file over a non-empty directory fails
+		blocked := filepath.Join(dir, "blocked")
+		os.MkdirAll(filepath.Join(blocked, "child"), 0755)
+		if err := writeFile(blocked, []byte("new")); err == nil {
+			t.Fatal("Expected the rename to fail")
+		}
+
+		if data, _ := os.ReadFile(path); string(data) != "old" {
+			t.Errorf("Old file changed: %q", data)
+		}
+		leftovers, _ := filepath.Glob(filepath.Join(dir, tmpPrefix+"*"))
+		if len(leftovers) != 0 {
+			t.Errorf("Expected the temp file to be removed, got %v", leftovers)
+		}
+	})
+
+	t.Run("Processes sharing a directory take turns", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("advisory locking is Unix only")
+		}
+		dir := t.TempDir()
+		first, _ := NewFileSystemRepository(dir)
+		second, _ := NewFileSystemRepository(dir)
+
+		// Each save moves the recording to its target's directory and
+		// removes the other copy; unserialized, both copies can vanish
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				first.Save(newInteraction("one.example.com", "one"))
+			}()
+			go func() {
+				defer wg.Done()
+				second.Save(newInteraction("two.example.com", "two"))
+			}()
+		}
+		wg.Wait()
+
+		matches, _ := first.locate(newInteraction("", "").Request.GenerateHash())
+		if len(matches) != 1 {
+			t.Errorf("Expected exactly one copy, got %v", matches)
+		}
+	})
+
+	t.Run("Lock excludes other repositories", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("advisory locking is Unix only")
+		}
+		dir := t.TempDir()
+		first, _ := NewFileSystemRepository(dir)
+		second, _ := NewFileSystemRepository(dir)
+
+		unlock, err := first.lock()
+		if err != nil {
+			t.Fatalf("Failed to lock: %v", err)
+		}
+
+		saved := make(chan error)
+		go func() {
+			saved <- second.Save(newInteraction("api.example.com", "waited"))
+		}()
+
+		select {
+		case <-saved:
+			t.Fatal("Save went ahead while another repository held the lock")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		unlock()
+		if err := <-saved; err != nil {
+			t.Errorf("Save failed after unlock: %v", err)
+		}
+	})
+}
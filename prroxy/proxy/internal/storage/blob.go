@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// blobDir holds bodies stored out of line, named by their SHA-256 digest
+const blobDir = "_blobs"
+
+// ErrInvalidBlobRef is returned for references that are not SHA-256 digests
+type ErrInvalidBlobRef struct {
+	Ref string
+}
+
+func (e ErrInvalidBlobRef) Error() string {
+	return "invalid blob reference: " + e.Ref
+}
+
+// validBlobRef reports whether ref looks like a hex SHA-256 digest, which
+// also keeps references from escaping the blob directory
+func validBlobRef(ref string) bool {
+	if len(ref) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(ref)
+	return err == nil
+}
+
+// SaveBlob streams a body to the blob directory and returns its digest.
+// Identical bodies share one file.
+func (r *FileSystemRepository) SaveBlob(body io.Reader) (string, int64, error) {
+	dir := filepath.Join(r.basePath, blobDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	// Stream to a temporary file while hashing, without holding the locks
+	hasher := sha256.New()
+	var size int64
+	tmp, err := createTemp(dir, func(w io.Writer) error {
+		var err error
+		size, err = io.Copy(io.MultiWriter(w, hasher), body)
+		return err
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to write blob: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	ref := hex.EncodeToString(hasher.Sum(nil))
+
+	// Move it into place under the same locks as GC, so a blob is either
+	// in place before GC looks (and new enough to be kept) or arrives after
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unlock, err := r.lock()
+	if err != nil {
+		return "", 0, err
+	}
+	defer unlock()
+
+	if err := commitTemp(tmp, filepath.Join(dir, ref)); err != nil {
+		return "", 0, fmt.Errorf("failed to store blob: %w", err)
+	}
+
+	return ref, size, nil
+}
+
+// OpenBlob opens a body stored with SaveBlob
+func (r *FileSystemRepository) OpenBlob(ref string) (io.ReadCloser, error) {
+	if !validBlobRef(ref) {
+		return nil, ErrInvalidBlobRef{Ref: ref}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	file, err := os.Open(filepath.Join(r.basePath, blobDir, ref))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound{Hash: ref}
+		}
+		return nil, fmt.Errorf("failed to open blob: %w", err)
+	}
+	return file, nil
+}
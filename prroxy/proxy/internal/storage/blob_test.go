@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBlobs(t *testing.T) {
+	repo, err := NewFileSystemRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	t.Run("Save and open", func(t *testing.T) {
+		ref, size, err := repo.SaveBlob(strings.NewReader("large body"))
+		if err != nil {
+			t.Fatalf("Failed to save blob: %v", err)
+		}
+		if size != 10 {
+			t.Errorf("Expected size 10, got %d", size)
+		}
+
+		blob, err := repo.OpenBlob(ref)
+		if err != nil {
+			t.Fatalf("Failed to open blob: %v", err)
+		}
+		defer blob.Close()
+		data, _ := io.ReadAll(blob)
+		if string(data) != "large body" {
+			t.Errorf("Unexpected blob contents %q", data)
+		}
+	})
+
+	t.Run("Blobs are readable like recordings", func(t *testing.T) {
+		ref, _, err := repo.SaveBlob(strings.NewReader("shared body"))
+		if err != nil {
+			t.Fatalf("Failed to save blob: %v", err)
+		}
+		info, err := os.Stat(filepath.Join(repo.basePath, blobDir, ref))
+		if err != nil || info.Mode().Perm() != 0644 {
+			t.Errorf("Expected mode 0644, got %v (%v)", info.Mode().Perm(), err)
+		}
+		temps, _ := filepath.Glob(filepath.Join(repo.basePath, blobDir, tmpPrefix+"*"))
+		if len(temps) != 0 {
+			t.Errorf("Expected no temporary files, got %v", temps)
+		}
+	})
+
+	t.Run("Identical bodies share a ref", func(t *testing.T) {
+		ref1, _, _ := repo.SaveBlob(strings.NewReader("same"))
+		ref2, _, _ := repo.SaveBlob(strings.NewReader("same"))
+		if ref1 != ref2 {
+			t.Errorf("Expected identical refs, got %s and %s", ref1, ref2)
+		}
+	})
+
+	t.Run("Blobs are not recordings", func(t *testing.T) {
+		count, err := repo.Count()
+		if err != nil || count != 0 {
+			t.Errorf("Expected no recordings, got %d (%v)", count, err)
+		}
+	})
+
+	t.Run("Invalid and missing refs", func(t *testing.T) {
+		if _, err := repo.OpenBlob("../../etc/passwd"); err == nil {
+			t.Error("Expected error for invalid ref")
+		} else if _, ok := err.(ErrInvalidBlobRef); !ok {
+			t.Errorf("Expected ErrInvalidBlobRef, got %T", err)
+		}
+
+		missing := strings.Repeat("0", 64)
+		if _, err := repo.OpenBlob(missing); err == nil {
+			t.Error("Expected error for missing blob")
+		} else if _, ok := err.(ErrNotFound); !ok {
+			t.Errorf("Expected ErrNotFound, got %T", err)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+// DedupMinSize is the smallest response body deduplication moves to the
+// blob store; below it a reference saves too little to be worth a file
+const DedupMinSize = 1024
+
+// SetDedup turns on storing response bodies in the blob store, so
+// recordings with the same body share one file
+func (r *FileSystemRepository) SetDedup(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dedup = enabled
+}
+
+// deduplicate returns the interaction to write: with dedup on, a copy
+// whose response body is replaced by the digest of a blob holding it.
+// Callers hold the locks, so GC can't remove the blob before the
+// recording referring to it is written.
+func (r *FileSystemRepository) deduplicate(interaction *models.Interaction) (*models.Interaction, error) {
+	body := interaction.Response.Body
+	if !r.dedup || len(body) < DedupMinSize || interaction.Response.BodyRef != "" {
+		return interaction, nil
+	}
+
+	sum := sha256.Sum256(body)
+	digest := hex.EncodeToString(sum[:])
+	path := filepath.Join(r.basePath, blobDir, digest)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create blob directory: %w", err)
+		}
+		if err := writeFile(path, body); err != nil {
+			return nil, fmt.Errorf("failed to store response body: %w", err)
+		}
+	}
+
+	stored := *interaction
+	stored.Response.Body = nil
+	stored.Response.BodyDigest = digest
+	return &stored, nil
+}
+
+// load decodes a recording file and puts a deduplicated body back
+func (r *FileSystemRepository) load(data []byte) (*models.Interaction, error) {
+	interaction, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := interaction.Response.BodyDigest
+	if digest == "" {
+		return interaction, nil
+	}
+	if !validBlobRef(digest) {
+		return nil, ErrInvalidBlobRef{Ref: digest}
+	}
+	body, err := os.ReadFile(filepath.Join(r.basePath, blobDir, digest))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	interaction.Response.Body = body
+	interaction.Response.BodyDigest = ""
+	return interaction, nil
+}
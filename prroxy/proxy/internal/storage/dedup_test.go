@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+func TestDedup(t *testing.T) {
+	body := []byte(strings.Repeat(`{"id":1,"name":"Alice"},`, 100))
+	newInteraction := func(url string, body []byte) *models.Interaction {
+		return &models.Interaction{
+			Request:  models.RecordedRequest{Method: "GET", URL: url},
+			Response: models.RecordedResponse{StatusCode: 200, Body: body},
+			Metadata: models.InteractionMetadata{Target: "api.example.com"},
+		}
+	}
+	blobs := func(dir string) []string {
+		files, _ := filepath.Glob(filepath.Join(dir, blobDir, "*"))
+		return files
+	}
+
+	t.Run("Identical bodies share one blob", func(t *testing.T) {
+		dir := t.TempDir()
+		repo, _ := NewFileSystemRepository(dir)
+		repo.SetDedup(true)
+
+		first := newInteraction("/users?page=1", body)
+		repo.Save(first)
+		repo.Save(newInteraction("/users?page=2", body))
+		repo.Save(newInteraction("/small", []byte("ok")))
+
+		if files := blobs(dir); len(files) != 1 {
+			t.Fatalf("Expected 1 blob, got %v", files)
+		}
+		if first.Response.Body == nil || first.Response.BodyDigest != "" {
+			t.Errorf("Save changed the caller's interaction")
+		}
+
+		all, _ := repo.FindAll()
+		for _, interaction := range all {
+			if interaction.Response.BodyDigest != "" {
+				t.Errorf("Expected the digest to be resolved on load")
+			}
+		}
+		found, err := repo.Find(first.Request.GenerateHash())
+		if err != nil || !bytes.Equal(found.Response.Body, body) {
+			t.Errorf("Expected the body back, got %v", err)
+		}
+		if problems, _ := repo.Verify(); len(problems) != 0 {
+			t.Errorf("Expected no problems, got %+v", problems)
+		}
+	})
+
+	t.Run("Files refer to the blob by digest", func(t *testing.T) {
+		dir := t.TempDir()
+		repo, _ := NewFileSystemRepository(dir)
+		repo.SetDedup(true)
+		interaction := newInteraction("/users", body)
+		repo.Save(interaction)
+
+		matches, _ := repo.locate(interaction.Request.GenerateHash())
+		data, _ := os.ReadFile(matches[0])
+		if !strings.Contains(string(data), `"body_digest"`) || strings.Contains(string(data), `"body":`) {
+			t.Errorf("Expected a digest instead of the body:\n%s", data)
+		}
+	})
+
+	t.Run("A missing blob is reported", func(t *testing.T) {
+		dir := t.TempDir()
+		repo, _ := NewFileSystemRepository(dir)
+		repo.SetDedup(true)
+		interaction := newInteraction("/users", body)
+		repo.Save(interaction)
+		os.Remove(blobs(dir)[0])
+
+		if _, err := repo.Find(interaction.Request.GenerateHash()); err == nil {
+			t.Errorf("Expected an error for the missing body")
+		}
+		problems, _ := repo.Verify()
+		if len(problems) != 1 || problems[0].Kind != ProblemMissingBlob {
+			t.Errorf("Expected a missing blob, got %+v", problems)
+		}
+	})
+}
+
+func TestGC(t *testing.T) {
+	dir := t.TempDir()
+	repo, _ := NewFileSystemRepository(dir)
+	repo.SetDedup(true)
+
+	body := func(name string) []byte {
+		return []byte(strings.Repeat(name, DedupMinSize))
+	}
+	save := func(url string, body []byte) string {
+		interaction := &models.Interaction{
+			Request:  models.RecordedRequest{Method: "GET", URL: url},
+			Response: models.RecordedResponse{StatusCode: 200, Body: body},
+			Metadata: models.InteractionMetadata{Target: "api.example.com"},
+		}
+		if err := repo.Save(interaction); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+		return interaction.Request.GenerateHash()
+	}
+	age := func() {
+		old := time.Now().Add(-2 * gcGracePeriod)
+		files, _ := filepath.Glob(filepath.Join(dir, blobDir, "*"))
+		for _, file := range files {
+			os.Chtimes(file, old, old)
+		}
+	}
+
+	kept := save("/kept", body("k"))
+	deleted := save("/deleted", body("d"))
+	versioned := save("/versioned", body("1"))
+	save("/versioned", body("2"))
+	repo.Delete(deleted)
+
+	t.Run("Dry run removes nothing", func(t *testing.T) {
+		age()
+		result, err := repo.GC(true)
+		if err != nil {
+			t.Fatalf("GC failed: %v", err)
+		}
+		if len(result.Removed) != 1 || result.Bytes != DedupMinSize || result.Kept != 3 {
+			t.Errorf("Expected 1 removable blob and 3 kept, got %+v", result)
+		}
+		if files, _ := filepath.Glob(filepath.Join(dir, blobDir, "*")); len(files) != 4 {
+			t.Errorf("Expected all 4 blobs left, got %d", len(files))
+		}
+	})
+
+	t.Run("Removes only unreferenced blobs", func(t *testing.T) {
+		if _, err := repo.GC(false); err != nil {
+			t.Fatalf("GC failed: %v", err)
+		}
+		if _, err := repo.Find(kept); err != nil {
+			t.Errorf("Lost a current body: %v", err)
+		}
+		if _, err := repo.Rollback(versioned, 1); err != nil {
+			t.Errorf("Lost a body kept in the history: %v", err)
+		}
+	})
+
+	t.Run("New blobs are kept", func(t *testing.T) {
+		ref, _, _ := repo.SaveBlob(strings.NewReader("being recorded"))
+		result, _ := repo.GC(false)
+		if len(result.Removed) != 0 {
+			t.Errorf("Expected nothing removed, got %+v", result)
+		}
+		if _, err := os.Stat(filepath.Join(dir, blobDir, ref)); err != nil {
+			t.Errorf("Removed a new blob: %v", err)
+		}
+	})
+
+	t.Run("Unreadable recordings stop GC", func(t *testing.T) {
+		os.WriteFile(filepath.Join(dir, "api_example_com", "broken.json"), []byte("{"), 0644)
+		if _, err := repo.GC(false); err == nil {
+			t.Errorf("Expected an error")
+		}
+	})
+}
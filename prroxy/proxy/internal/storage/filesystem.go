@@ -1,7 +1,6 @@
 package storage
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,7 +14,11 @@ import (
 // FileSystemRepository implements Repository using filesystem storage
 type FileSystemRepository struct {
 	basePath string
+	format   string       // FormatJSON or FormatReadable for new files
 	mu       sync.RWMutex // Ensures thread-safe operations
+
+	historyLimit int  // Previous versions kept per hash
+	dedup        bool // Response bodies go to the blob store
 }
 
 // NewFileSystemRepository creates a new filesystem-based repository
@@ -26,17 +29,28 @@ func NewFileSystemRepository(basePath string) (*FileSystemRepository, error) {
 	}
 
 	return &FileSystemRepository{
-		basePath: basePath,
+		basePath:     basePath,
+		historyLimit: DefaultHistoryLimit,
 	}, nil
 }
 
-// Save stores an interaction to the filesystem
+// Save stores an interaction to the filesystem. The file is replaced
+// atomically and other processes sharing the directory are locked out.
 func (r *FileSystemRepository) Save(interaction *models.Interaction) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Generate hash for the request
 	hash := interaction.Request.GenerateHash()
+	if !ValidHash(hash) {
+		return ErrInvalidHash{Hash: hash}
+	}
 
 	// Extract service name from target URL for organization
 	serviceName := extractServiceName(interaction.Metadata.Target)
@@ -48,30 +62,91 @@ func (r *FileSystemRepository) Save(interaction *models.Interaction) error {
 	}
 
 	// Save interaction as JSON file
-	filename := filepath.Join(serviceDir, hash+".json")
+	filename := filepath.Join(serviceDir, r.filename(&interaction.Request, hash))
 
-	// Marshal interaction to JSON
-	data, err := json.MarshalIndent(interaction, "", "  ")
+	// Marshal interaction to JSON, with the body stored apart if deduplicating
+	stored, err := r.deduplicate(interaction)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(stored)
 	if err != nil {
 		return fmt.Errorf("failed to marshal interaction: %w", err)
 	}
 
+	// Keep the version being replaced
+	if previous, _ := r.locate(hash); len(previous) > 0 {
+		if err := r.archive(hash, previous[0], data); err != nil {
+			return err
+		}
+	}
+
 	// Write to file
-	if err := os.WriteFile(filename, data, 0644); err != nil {
+	if err := writeFile(filename, data); err != nil {
 		return fmt.Errorf("failed to write interaction file: %w", err)
 	}
 
+	// Remove copies left in other service directories (target changed)
+	// or in the other format, so each hash maps to exactly one file
+	matches, _ := r.locate(hash)
+	for _, match := range matches {
+		if match != filename {
+			os.Remove(match)
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a single interaction by request hash, along with its
+// history: once gone, its versions would otherwise be kept forever and
+// hold on to their blobs through GC
+func (r *FileSystemRepository) Delete(hash string) error {
+	if !ValidHash(hash) {
+		return ErrInvalidHash{Hash: hash}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	matches, err := r.locate(hash)
+	if err != nil {
+		return fmt.Errorf("failed to search for interaction: %w", err)
+	}
+
+	if len(matches) == 0 {
+		return ErrNotFound{Hash: hash}
+	}
+
+	for _, match := range matches {
+		if err := os.Remove(match); err != nil {
+			return fmt.Errorf("failed to delete interaction file: %w", err)
+		}
+	}
+	if err := os.RemoveAll(r.historyPath(hash)); err != nil {
+		return fmt.Errorf("failed to delete history: %w", err)
+	}
+
 	return nil
 }
 
 // Find retrieves an interaction by request hash
 func (r *FileSystemRepository) Find(hash string) (*models.Interaction, error) {
+	if !ValidHash(hash) {
+		return nil, ErrInvalidHash{Hash: hash}
+	}
+
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	// Search for the file in all service directories
-	pattern := filepath.Join(r.basePath, "*", hash+".json")
-	matches, err := filepath.Glob(pattern)
+	matches, err := r.locate(hash)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search for interaction: %w", err)
 	}
@@ -87,12 +162,12 @@ func (r *FileSystemRepository) Find(hash string) (*models.Interaction, error) {
 	}
 
 	// Unmarshal JSON
-	var interaction models.Interaction
-	if err := json.Unmarshal(data, &interaction); err != nil {
+	interaction, err := r.load(data)
+	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal interaction: %w", err)
 	}
 
-	return &interaction, nil
+	return interaction, nil
 }
 
 // FindAll returns all stored interactions
@@ -100,15 +175,62 @@ func (r *FileSystemRepository) FindAll() ([]*models.Interaction, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	interactions, err := r.loadDir(r.basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort by timestamp descending (newest first)
+	sort.Slice(interactions, func(i, j int) bool {
+		return interactions[i].Timestamp.After(interactions[j].Timestamp)
+	})
+
+	return interactions, nil
+}
+
+// Query returns a filtered, sorted page of interactions. Recordings are
+// stored per service directory, so a target filter only reads that
+// directory instead of the whole store.
+func (r *FileSystemRepository) Query(query Query) (*QueryResult, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	root := r.basePath
+	if query.Target != "" {
+		root = filepath.Join(r.basePath, extractServiceName(query.Target))
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			return &QueryResult{Interactions: []*models.Interaction{}}, nil
+		}
+	}
+
+	interactions, err := r.loadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return ApplyQuery(interactions, query)
+}
+
+// loadDir reads every interaction file below root. Damaged files are
+// skipped with a warning so one bad file can't hide all the others; run
+// Verify to find and Repair to fix them.
+func (r *FileSystemRepository) loadDir(root string) ([]*models.Interaction, error) {
 	var interactions []*models.Interaction
 
 	// Walk through all JSON files in the directory
-	err := filepath.Walk(r.basePath, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Skip directories and non-JSON files
+		// Skip quarantined files and history, directories and non-JSON files
+		if info.IsDir() && isHidden(info.Name()) {
+			return filepath.SkipDir
+		}
 		if info.IsDir() || !strings.HasSuffix(info.Name(), ".json") {
 			return nil
 		}
@@ -116,15 +238,17 @@ func (r *FileSystemRepository) FindAll() ([]*models.Interaction, error) {
 		// Read and unmarshal the file
 		data, err := os.ReadFile(path)
 		if err != nil {
-			return fmt.Errorf("failed to read file %s: %w", path, err)
+			fmt.Printf("Warning: Skipping unreadable recording %s: %v\n", path, err)
+			return nil
 		}
 
-		var interaction models.Interaction
-		if err := json.Unmarshal(data, &interaction); err != nil {
-			return fmt.Errorf("failed to unmarshal file %s: %w", path, err)
+		interaction, err := r.load(data)
+		if err != nil {
+			fmt.Printf("Warning: Skipping corrupt recording %s: %v\n", path, err)
+			return nil
 		}
 
-		interactions = append(interactions, &interaction)
+		interactions = append(interactions, interaction)
 		return nil
 	})
 
@@ -132,19 +256,27 @@ func (r *FileSystemRepository) FindAll() ([]*models.Interaction, error) {
 		return nil, fmt.Errorf("failed to walk directory: %w", err)
 	}
 
-	// Sort by timestamp descending (newest first)
-	sort.Slice(interactions, func(i, j int) bool {
-		return interactions[i].Timestamp.After(interactions[j].Timestamp)
-	})
-
 	return interactions, nil
 }
 
-// Clear removes all stored interactions
+// isHidden reports whether a directory holds files that aren't current
+// recordings
+func isHidden(name string) bool {
+	return name == quarantineDir || name == historyDir
+}
+
+// Clear removes all stored interactions along with their history, blobs
+// and quarantined files
 func (r *FileSystemRepository) Clear() error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Remove all subdirectories
 	entries, err := os.ReadDir(r.basePath)
 	if err != nil {
@@ -152,6 +284,10 @@ func (r *FileSystemRepository) Clear() error {
 	}
 
 	for _, entry := range entries {
+		// Other processes may be waiting on the lock file
+		if entry.Name() == lockName {
+			continue
+		}
 		path := filepath.Join(r.basePath, entry.Name())
 		if err := os.RemoveAll(path); err != nil {
 			return fmt.Errorf("failed to remove %s: %w", path, err)
@@ -174,6 +310,9 @@ func (r *FileSystemRepository) Count() (int, error) {
 			return err
 		}
 
+		if info.IsDir() && isHidden(info.Name()) {
+			return filepath.SkipDir
+		}
 		if !info.IsDir() && strings.HasSuffix(info.Name(), ".json") {
 			count++
 		}
@@ -191,8 +330,7 @@ func (r *FileSystemRepository) Count() (int, error) {
 // extractServiceName extracts a clean service name from a target URL
 func extractServiceName(target string) string {
 	// Remove protocol if present
-	target = strings.TrimPrefix(target, "http://")
-	target = strings.TrimPrefix(target, "https://")
+	target = trimScheme(target)
 
 	// Take the first part (domain/service name)
 	parts := strings.Split(target, "/")
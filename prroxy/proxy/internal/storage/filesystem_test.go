@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -83,7 +84,7 @@ func TestFileSystemRepository(t *testing.T) {
 	t.Run("Find non-existent", func(t *testing.T) {
 		repo, _ := NewFileSystemRepository(filepath.Join(tempDir, "find-missing"))
 
-		_, err := repo.Find("non-existent-hash")
+		_, err := repo.Find(strings.Repeat("0", 64))
 		if err == nil {
 			t.Fatal("Expected error for non-existent hash")
 		}
@@ -93,6 +94,46 @@ func TestFileSystemRepository(t *testing.T) {
 		}
 	})
 
+	t.Run("Hashes can't name files outside the store", func(t *testing.T) {
+		dir := filepath.Join(tempDir, "escape")
+		repo, _ := NewFileSystemRepository(filepath.Join(dir, "store"))
+		victim := filepath.Join(dir, "victim.json")
+		os.WriteFile(victim, []byte(`{}`), 0644)
+
+		for _, id := range []string{"../victim", "../../escape/victim", strings.Repeat("A", 64), "*"} {
+			if _, err := repo.Find(id); err == nil {
+				t.Errorf("Expected Find(%q) to fail", id)
+			} else if _, ok := err.(ErrInvalidHash); !ok {
+				t.Errorf("Expected ErrInvalidHash for %q, got %T", id, err)
+			}
+			if err := repo.Delete(id); err == nil {
+				t.Errorf("Expected Delete(%q) to fail", id)
+			}
+			if _, err := repo.History(id); err == nil {
+				t.Errorf("Expected History(%q) to fail", id)
+			}
+			if _, err := repo.Rollback(id, 1); err == nil {
+				t.Errorf("Expected Rollback(%q) to fail", id)
+			}
+		}
+		if _, err := os.Stat(victim); err != nil {
+			t.Errorf("Delete removed a file outside the store: %v", err)
+		}
+
+		crafted := &models.Interaction{
+			Request:  models.RecordedRequest{Method: "GET", URL: "x", BodyRef: "a", BodyHash: "../../escaped"},
+			Response: models.RecordedResponse{StatusCode: 200},
+		}
+		if err := repo.Save(crafted); err == nil {
+			t.Errorf("Expected a crafted body hash to be rejected")
+		} else if _, ok := err.(ErrInvalidHash); !ok {
+			t.Errorf("Expected ErrInvalidHash, got %T", err)
+		}
+		if matches, _ := filepath.Glob(filepath.Join(dir, "*escaped*")); len(matches) != 0 {
+			t.Errorf("Save wrote outside the store: %v", matches)
+		}
+	})
+
 	t.Run("FindAll", func(t *testing.T) {
 		repo, _ := NewFileSystemRepository(filepath.Join(tempDir, "find-all"))
 
@@ -228,6 +269,60 @@ func TestFileSystemRepository(t *testing.T) {
 		}
 	})
 
+	t.Run("Delete", func(t *testing.T) {
+		repo, _ := NewFileSystemRepository(filepath.Join(tempDir, "delete"))
+
+		interaction := &models.Interaction{
+			ID:        "delete-me",
+			Timestamp: time.Now(),
+			Request: models.RecordedRequest{
+				Method: "GET",
+				URL:    "/api/delete",
+			},
+			Metadata: models.InteractionMetadata{
+				Target: "api.example.com",
+			},
+		}
+		repo.Save(interaction)
+		hash := interaction.Request.GenerateHash()
+
+		if err := repo.Delete(hash); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+		if _, err := repo.Find(hash); err == nil {
+			t.Error("Expected interaction to be gone after delete")
+		}
+
+		if _, ok := repo.Delete(hash).(ErrNotFound); !ok {
+			t.Error("Expected ErrNotFound when deleting twice")
+		}
+	})
+
+	t.Run("Save moves file when target changes", func(t *testing.T) {
+		repo, _ := NewFileSystemRepository(filepath.Join(tempDir, "move"))
+
+		interaction := &models.Interaction{
+			ID:        "moved",
+			Timestamp: time.Now(),
+			Request: models.RecordedRequest{
+				Method: "GET",
+				URL:    "/api/move",
+			},
+			Metadata: models.InteractionMetadata{
+				Target: "old.example.com",
+			},
+		}
+		repo.Save(interaction)
+
+		interaction.Metadata.Target = "new.example.com"
+		repo.Save(interaction)
+
+		count, _ := repo.Count()
+		if count != 1 {
+			t.Errorf("Expected one file per hash, got %d", count)
+		}
+	})
+
 	t.Run("Service organization", func(t *testing.T) {
 		repo, _ := NewFileSystemRepository(filepath.Join(tempDir, "services"))
 
@@ -0,0 +1,407 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+// Recording file formats
+const (
+	// FormatJSON names files by request hash and stores bodies as base64
+	FormatJSON = "json"
+
+	// FormatReadable names files after the method and path and stores
+	// bodies as embedded JSON or text where possible, so fixture diffs
+	// can be reviewed
+	FormatReadable = "readable"
+)
+
+// shortHashLen is how much of the request hash readable filenames keep
+const shortHashLen = 12
+
+// maxSlugLen keeps readable filenames well below filesystem limits
+const maxSlugLen = 80
+
+// SetFormat selects the format new recordings are written in. Files in
+// either format are always read, so a store can be converted gradually.
+func (r *FileSystemRepository) SetFormat(format string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.format = format
+}
+
+// filename returns the file name a recording is saved under
+func (r *FileSystemRepository) filename(request *models.RecordedRequest, hash string) string {
+	if r.format == FormatReadable {
+		return readableName(request, hash)
+	}
+	return hash + ".json"
+}
+
+// locate returns the files holding the recording with the given hash, in
+// either format
+func (r *FileSystemRepository) locate(hash string) ([]string, error) {
+	if !ValidHash(hash) {
+		return nil, ErrInvalidHash{Hash: hash}
+	}
+
+	matches, err := filepath.Glob(filepath.Join(r.basePath, "*", hash+".json"))
+	if err != nil {
+		return matches, err
+	}
+
+	readable, err := filepath.Glob(filepath.Join(r.basePath, "*", "*_"+hash[:shortHashLen]+".json"))
+	return append(matches, readable...), err
+}
+
+// readableName builds a stable filename such as GET_users_42_3f2a9c1b2c4d.json
+// from the request method and path (and GraphQL operation) plus a short hash
+func readableName(request *models.RecordedRequest, hash string) string {
+	path := request.URL
+	if u, err := url.Parse(request.URL); err == nil {
+		path = u.Path
+	}
+	if request.GraphQL != nil && request.GraphQL.Name != "" {
+		path += "/" + request.GraphQL.Name
+	}
+
+	slug := slugify(request.Method + "/" + path)
+	if len(slug) > maxSlugLen {
+		slug = strings.TrimRight(slug[:maxSlugLen], "_")
+	}
+	if len(hash) > shortHashLen {
+		hash = hash[:shortHashLen]
+	}
+	return slug + "_" + hash + ".json"
+}
+
+// slugify keeps letters, digits, dots and dashes, collapsing everything
+// else into single underscores
+func slugify(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c < utf8.RuneSelf && (unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-' || c == '.'):
+			b.WriteRune(c)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "_"):
+			b.WriteByte('_')
+		}
+	}
+	return strings.Trim(b.String(), "_.")
+}
+
+// encode marshals a recording in the repository's format
+func (r *FileSystemRepository) encode(interaction *models.Interaction) ([]byte, error) {
+	if r.format != FormatReadable {
+		return json.MarshalIndent(interaction, "", "  ")
+	}
+	return MarshalReadable(interaction)
+}
+
+// MarshalReadable renders a recording as the readable format stores it,
+// with JSON and text bodies inline and sorted keys
+func MarshalReadable(interaction *models.Interaction) ([]byte, error) {
+	data, err := json.Marshal(interaction)
+	if err != nil {
+		return nil, err
+	}
+	// Structs marshal in field order, so sort nested objects too
+	if data, err = sortKeys(data); err != nil {
+		return nil, err
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	for key, body := range map[string][]byte{
+		"request":  interaction.Request.Body,
+		"response": interaction.Response.Body,
+	} {
+		if len(body) == 0 {
+			continue
+		}
+		var part map[string]json.RawMessage
+		if err := json.Unmarshal(doc[key], &part); err != nil {
+			return nil, err
+		}
+		delete(part, "body")
+		if utf8.Valid(body) && json.Valid(body) {
+			part["body_json"] = body
+			if layout := layoutOf(body); layout != nil {
+				part["body_json_layout"], _ = marshalNoEscape(layout)
+			}
+		} else if isText(body) {
+			part["body_text"], _ = marshalNoEscape(string(body))
+		} else {
+			part["body"], _ = json.Marshal(body)
+		}
+		if doc[key], err = marshalNoEscape(part); err != nil {
+			return nil, err
+		}
+	}
+
+	// Maps marshal with sorted keys, so the output is deterministic
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sortKeys re-marshals every object in a JSON document with sorted keys
+func sortKeys(data json.RawMessage) (json.RawMessage, error) {
+	switch data[0] {
+	case '{':
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, err
+		}
+		for key, value := range object {
+			sorted, err := sortKeys(value)
+			if err != nil {
+				return nil, err
+			}
+			object[key] = sorted
+		}
+		return marshalNoEscape(object)
+	case '[':
+		var array []json.RawMessage
+		if err := json.Unmarshal(data, &array); err != nil {
+			return nil, err
+		}
+		for i, value := range array {
+			sorted, err := sortKeys(value)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = sorted
+		}
+		return marshalNoEscape(array)
+	}
+	return data, nil
+}
+
+// decode unmarshals a recording in either format
+func decode(data []byte) (*models.Interaction, error) {
+	var interaction models.Interaction
+	if err := json.Unmarshal(data, &interaction); err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(data, []byte(`"body_json"`)) && !bytes.Contains(data, []byte(`"body_text"`)) {
+		return &interaction, nil
+	}
+
+	type readableBody struct {
+		JSON   json.RawMessage `json:"body_json"`
+		Layout *jsonLayout     `json:"body_json_layout"`
+		Text   *string         `json:"body_text"`
+	}
+	var bodies struct {
+		Request  readableBody `json:"request"`
+		Response readableBody `json:"response"`
+	}
+	if err := json.Unmarshal(data, &bodies); err != nil {
+		return nil, err
+	}
+
+	for _, b := range []struct {
+		readable readableBody
+		body     *[]byte
+	}{
+		{bodies.Request, &interaction.Request.Body},
+		{bodies.Response, &interaction.Response.Body},
+	} {
+		if b.readable.JSON != nil {
+			// The file is indented its own way; compact it and put the
+			// body's original whitespace back
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, b.readable.JSON); err != nil {
+				return nil, err
+			}
+			body, err := b.readable.Layout.apply(buf.Bytes())
+			if err != nil {
+				return nil, err
+			}
+			*b.body = body
+		} else if b.readable.Text != nil {
+			*b.body = []byte(*b.readable.Text)
+		}
+	}
+	return &interaction, nil
+}
+
+// readInteraction reads and decodes one recording file
+func readInteraction(path string) (*models.Interaction, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	interaction, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return interaction, nil
+}
+
+// jsonLayout records the insignificant whitespace of an embedded JSON
+// body, so the exact bytes can be restored on playback. Bodies laid out
+// as json.Indent would only need the indent; anything else keeps the
+// whitespace before each token that has some.
+type jsonLayout struct {
+	Indent   string            `json:"indent,omitempty"`
+	Spaces   map[string]string `json:"spaces,omitempty"` // Token number -> whitespace before it
+	Trailing string            `json:"trailing,omitempty"`
+}
+
+// layoutOf returns the layout of a valid JSON body, or nil if it's compact
+func layoutOf(body []byte) *jsonLayout {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err != nil {
+		return nil
+	}
+	spaces := jsonSpaces(body)
+	layout := &jsonLayout{Trailing: spaces[len(spaces)-1]}
+	spaces = spaces[:len(spaces)-1]
+
+	// The indent is what follows the first line break
+	for _, space := range spaces {
+		if i := strings.LastIndexByte(space, '\n'); i >= 0 {
+			var indented bytes.Buffer
+			indent := space[i+1:]
+			json.Indent(&indented, compact.Bytes(), "", indent)
+			if indent != "" && slices.Equal(jsonSpaces(indented.Bytes())[:len(spaces)], spaces) {
+				layout.Indent = indent
+				spaces = nil
+			}
+			break
+		}
+	}
+
+	for n, space := range spaces {
+		if space != "" {
+			if layout.Spaces == nil {
+				layout.Spaces = make(map[string]string)
+			}
+			layout.Spaces[strconv.Itoa(n)] = space
+		}
+	}
+
+	if layout.Indent == "" && layout.Spaces == nil && layout.Trailing == "" {
+		return nil
+	}
+	return layout
+}
+
+// apply lays out a compact JSON body; a nil layout leaves it compact
+func (l *jsonLayout) apply(compact []byte) ([]byte, error) {
+	if l == nil {
+		return compact, nil
+	}
+
+	var buf bytes.Buffer
+	if l.Indent != "" {
+		if err := json.Indent(&buf, compact, "", l.Indent); err != nil {
+			return nil, err
+		}
+	} else {
+		n := 0
+		scanJSON(compact, func(_ string, token []byte) {
+			buf.WriteString(l.Spaces[strconv.Itoa(n)])
+			buf.Write(token)
+			n++
+		})
+	}
+	buf.WriteString(l.Trailing)
+	return buf.Bytes(), nil
+}
+
+// jsonSpaces returns the whitespace before each token of a valid JSON
+// document, followed by the whitespace after the last one
+func jsonSpaces(data []byte) []string {
+	var spaces []string
+	trailing := scanJSON(data, func(space string, _ []byte) {
+		spaces = append(spaces, space)
+	})
+	return append(spaces, trailing)
+}
+
+// scanJSON calls fn with each token of a valid JSON document and the
+// whitespace before it, and returns the whitespace after the last token
+func scanJSON(data []byte, fn func(space string, token []byte)) string {
+	i := 0
+	for {
+		start := i
+		for i < len(data) && isJSONSpace(data[i]) {
+			i++
+		}
+		if i == len(data) {
+			return string(data[start:])
+		}
+
+		end := i + 1
+		switch c := data[i]; {
+		case c == '"':
+			for ; data[end] != '"'; end++ {
+				if data[end] == '\\' {
+					end++
+				}
+			}
+			end++
+		case !isJSONDelim(c):
+			for end < len(data) && !isJSONSpace(data[end]) && !isJSONDelim(data[end]) {
+				end++
+			}
+		}
+		fn(string(data[start:i]), data[i:end])
+		i = end
+	}
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isJSONDelim(c byte) bool {
+	return strings.IndexByte("{}[]:,", c) >= 0
+}
+
+// isText reports whether body is UTF-8 without control characters other
+// than whitespace
+func isText(body []byte) bool {
+	if !utf8.Valid(body) {
+		return false
+	}
+	for _, c := range string(body) {
+		if unicode.IsControl(c) && c != '\n' && c != '\r' && c != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// marshalNoEscape marshals v without escaping <, > and &
+func marshalNoEscape(v interface{}) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
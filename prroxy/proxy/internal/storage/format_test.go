@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+func TestReadableFormat(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := NewFileSystemRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	repo.SetFormat(FormatReadable)
+
+	bodies := map[string][]byte{
+		"json":     []byte(`{"name":"<Alice> & Bob","tags":["a","b"]}`),
+		"pretty":   []byte("{\n  \"name\": \"Alice\"\n}"),
+		"indented": []byte("{\n\t\"id\": 1,\n\t\"tags\": [\n\t\t\"a\"\n\t],\n\t\"empty\": {}\n}\n"),
+		"spaced":   []byte(" { \"a\" : [1, 2], \"b\":null }\r\n"),
+		"text":     []byte("hello\nworld "),
+		"binary":   {0x89, 'P', 'N', 'G', 0x00, 0xff},
+	}
+	for name, body := range bodies {
+		interaction := &models.Interaction{
+			Request:  models.RecordedRequest{Method: "POST", URL: "https://api.example.com/users/" + name + "?page=1", Body: body},
+			Response: models.RecordedResponse{StatusCode: 200, Body: body},
+			Metadata: models.InteractionMetadata{Target: "api.example.com", DurationMS: 5},
+		}
+		if err := repo.Save(interaction); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+	}
+
+	t.Run("Bodies round-trip exactly", func(t *testing.T) {
+		all, err := repo.FindAll()
+		if err != nil {
+			t.Fatalf("FindAll failed: %v", err)
+		}
+		for _, interaction := range all {
+			name := strings.TrimPrefix(strings.SplitN(interaction.Request.URL, "?", 2)[0], "https://api.example.com/users/")
+			if !bytes.Equal(interaction.Request.Body, bodies[name]) || !bytes.Equal(interaction.Response.Body, bodies[name]) {
+				t.Errorf("%s body changed: %q", name, interaction.Response.Body)
+			}
+			if _, err := repo.Find(interaction.Request.GenerateHash()); err != nil {
+				t.Errorf("%s not found by hash: %v", name, err)
+			}
+		}
+		if problems, _ := repo.Verify(); len(problems) != 0 {
+			t.Errorf("Expected no problems, got %+v", problems)
+		}
+	})
+
+	t.Run("Files are readable", func(t *testing.T) {
+		files, _ := filepath.Glob(filepath.Join(dir, "api_example_com", "POST_users_json_*.json"))
+		if len(files) != 1 {
+			t.Fatalf("Expected a file named after the request, got %v", files)
+		}
+		data, _ := os.ReadFile(files[0])
+		if !strings.Contains(string(data), `"name": "<Alice> & Bob"`) {
+			t.Errorf("Expected an embedded JSON body:\n%s", data)
+		}
+
+		if !strings.Contains(string(data), `"metadata": {
+    "duration_ms": 5,
+    "target": "api.example.com"
+  }`) {
+			t.Errorf("Expected sorted metadata keys:\n%s", data)
+		}
+
+		for _, name := range []string{"pretty", "indented", "spaced"} {
+			files, _ = filepath.Glob(filepath.Join(dir, "api_example_com", "POST_users_"+name+"_*.json"))
+			data, _ = os.ReadFile(files[0])
+			if !strings.Contains(string(data), `"body_json": {`) || strings.Contains(string(data), `"body_text"`) {
+				t.Errorf("Expected the %s body embedded as JSON:\n%s", name, data)
+			}
+		}
+
+		files, _ = filepath.Glob(filepath.Join(dir, "api_example_com", "POST_users_text_*.json"))
+		data, _ = os.ReadFile(files[0])
+		if !strings.Contains(string(data), `"body_text": "hello\nworld`) {
+			t.Errorf("Expected a text body:\n%s", data)
+		}
+	})
+
+	t.Run("Output is deterministic", func(t *testing.T) {
+		files, _ := filepath.Glob(filepath.Join(dir, "api_example_com", "*.json"))
+		before, _ := os.ReadFile(files[0])
+		interaction, _ := readInteraction(files[0])
+		repo.Save(interaction)
+		after, _ := os.ReadFile(files[0])
+		if !bytes.Equal(before, after) {
+			t.Errorf("Re-saving changed the file:\n%s\n%s", before, after)
+		}
+	})
+
+	t.Run("Switching format replaces the old file", func(t *testing.T) {
+		legacy, _ := NewFileSystemRepository(dir)
+		interaction := &models.Interaction{
+			Request:  models.RecordedRequest{Method: "GET", URL: "/switch"},
+			Response: models.RecordedResponse{StatusCode: 200, Body: []byte(`{"ok":true}`)},
+			Metadata: models.InteractionMetadata{Target: "api.example.com"},
+		}
+		legacy.Save(interaction)
+		hash := interaction.Request.GenerateHash()
+
+		found, err := repo.Find(hash)
+		if err != nil || string(found.Response.Body) != `{"ok":true}` {
+			t.Fatalf("Expected the legacy file to be read, got %v", err)
+		}
+
+		repo.Save(interaction)
+		matches, _ := repo.locate(hash)
+		if len(matches) != 1 || filepath.Base(matches[0]) != "GET_switch_"+hash[:shortHashLen]+".json" {
+			t.Errorf("Expected only the readable file, got %v", matches)
+		}
+	})
+}
+
+func TestReadableName(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	tests := []struct {
+		method string
+		url    string
+		want   string
+	}{
+		{"GET", "https://api.example.com/users/42?x=1", "GET_users_42_abababababab.json"},
+		{"GET", "/", "GET_abababababab.json"},
+		{"DELETE", "/a b/../c%20d/", "DELETE_a_b_.._c_d_abababababab.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got := readableName(&models.RecordedRequest{Method: tt.method, URL: tt.url}, hash)
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gcGracePeriod protects new blobs from GC: the recorder saves a large
+// body as a blob before the recording that refers to it
+const gcGracePeriod = time.Hour
+
+// GCResult reports the blobs GC removed, or would remove on a dry run
+type GCResult struct {
+	Removed []string // Digests of unreferenced blobs
+	Bytes   int64    // Space they take up
+	Kept    int      // Blobs still referenced or too new to remove
+}
+
+// GC removes blobs no recording refers to. Versions in the history and
+// quarantined recordings count as references, so they can still be
+// restored. A recording that can't be read stops GC, since the blobs it
+// refers to are unknown; run Verify and Repair first.
+func (r *FileSystemRepository) GC(dryRun bool) (*GCResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unlock, err := r.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	referenced := map[string]bool{}
+	err = filepath.Walk(r.basePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == blobDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Quarantined files may carry a timestamp after .json
+		if isTemp(info.Name()) || !strings.Contains(info.Name(), ".json") {
+			return nil
+		}
+		interaction, err := readInteraction(path)
+		if err != nil {
+			// Damaged files were quarantined because they can't be read
+			if strings.Contains(path, string(filepath.Separator)+quarantineDir+string(filepath.Separator)) {
+				return nil
+			}
+			rel, _ := filepath.Rel(r.basePath, path)
+			return fmt.Errorf("can't read %s, run verify: %w", rel, err)
+		}
+		for _, ref := range []string{interaction.Request.BodyRef, interaction.Response.BodyRef, interaction.Response.BodyDigest} {
+			if ref != "" {
+				referenced[ref] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect blob references: %w", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(r.basePath, blobDir))
+	if os.IsNotExist(err) {
+		return &GCResult{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob directory: %w", err)
+	}
+
+	result := &GCResult{}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !validBlobRef(entry.Name()) {
+			continue
+		}
+		if referenced[entry.Name()] || time.Since(info.ModTime()) < gcGracePeriod {
+			result.Kept++
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(filepath.Join(r.basePath, blobDir, entry.Name())); err != nil {
+				return result, fmt.Errorf("failed to remove blob: %w", err)
+			}
+		}
+		result.Removed = append(result.Removed, entry.Name())
+		result.Bytes += info.Size()
+	}
+	return result, nil
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+// historyDir keeps the versions a recording had before it was replaced,
+// under one directory per request hash
+const historyDir = "_history"
+
+// DefaultHistoryLimit is how many previous versions are kept per hash
+const DefaultHistoryLimit = 5
+
+// Version describes one previous version of a recording
+type Version struct {
+	Number     int       `json:"version"`     // Increases with every replacement
+	Timestamp  time.Time `json:"timestamp"`   // When that version was recorded
+	ReplacedAt time.Time `json:"replaced_at"` // When it was replaced
+	Status     int       `json:"status"`
+}
+
+// Versioner is implemented by repositories that keep previous versions
+// of recordings that were re-recorded or edited
+type Versioner interface {
+	// History lists a recording's previous versions, newest first
+	History(hash string) ([]Version, error)
+
+	// Version returns one previous version
+	Version(hash string, number int) (*models.Interaction, error)
+
+	// Rollback makes a previous version current again; the version it
+	// replaces goes to the history like any other
+	Rollback(hash string, number int) (*models.Interaction, error)
+}
+
+// ErrVersionNotFound is returned for a version a recording doesn't have
+type ErrVersionNotFound struct {
+	Hash    string
+	Version int
+}
+
+func (e ErrVersionNotFound) Error() string {
+	return fmt.Sprintf("version %d not found for hash: %s", e.Version, e.Hash)
+}
+
+// errNoHistory is returned when the wrapped repository keeps no history
+var errNoHistory = errors.New("repository does not keep history")
+
+// SetHistoryLimit sets how many previous versions are kept per hash;
+// 0 turns history off
+func (r *FileSystemRepository) SetHistoryLimit(limit int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.historyLimit = limit
+}
+
+// archive copies the file about to be replaced into the history and
+// drops the oldest versions beyond the limit. Callers hold the locks.
+func (r *FileSystemRepository) archive(hash, path string, replacement []byte) error {
+	if r.historyLimit <= 0 {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || bytes.Equal(data, replacement) {
+		return nil
+	}
+
+	dir := r.historyPath(hash)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	numbers := versionNumbers(dir)
+	next := 1
+	if len(numbers) > 0 {
+		next = numbers[len(numbers)-1] + 1
+	}
+	if err := writeFile(filepath.Join(dir, strconv.Itoa(next)+".json"), data); err != nil {
+		return fmt.Errorf("failed to archive previous version: %w", err)
+	}
+
+	numbers = append(numbers, next)
+	for _, number := range numbers[:max(len(numbers)-r.historyLimit, 0)] {
+		os.Remove(filepath.Join(dir, strconv.Itoa(number)+".json"))
+	}
+	return nil
+}
+
+// History lists a recording's previous versions, newest first
+func (r *FileSystemRepository) History(hash string) ([]Version, error) {
+	if !ValidHash(hash) {
+		return nil, ErrInvalidHash{Hash: hash}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	dir := r.historyPath(hash)
+	numbers := versionNumbers(dir)
+	versions := make([]Version, 0, len(numbers))
+	for i := len(numbers) - 1; i >= 0; i-- {
+		path := filepath.Join(dir, strconv.Itoa(numbers[i])+".json")
+		interaction, err := readInteraction(path)
+		if err != nil {
+			fmt.Printf("Warning: Skipping damaged version %s: %v\n", path, err)
+			continue
+		}
+		versions = append(versions, Version{
+			Number:     numbers[i],
+			Timestamp:  interaction.Timestamp,
+			ReplacedAt: modTime(path),
+			Status:     interaction.Response.StatusCode,
+		})
+	}
+	return versions, nil
+}
+
+// Version returns one previous version of a recording
+func (r *FileSystemRepository) Version(hash string, number int) (*models.Interaction, error) {
+	if !ValidHash(hash) {
+		return nil, ErrInvalidHash{Hash: hash}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	data, err := os.ReadFile(filepath.Join(r.historyPath(hash), strconv.Itoa(number)+".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrVersionNotFound{Hash: hash, Version: number}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version: %w", err)
+	}
+	interaction, err := r.load(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version: %w", err)
+	}
+	return interaction, nil
+}
+
+// Rollback makes a previous version current again
+func (r *FileSystemRepository) Rollback(hash string, number int) (*models.Interaction, error) {
+	interaction, err := r.Version(hash, number)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Save(interaction); err != nil {
+		return nil, err
+	}
+	return interaction, nil
+}
+
+// historyPath returns the history directory for a hash, which callers
+// have checked with ValidHash
+func (r *FileSystemRepository) historyPath(hash string) string {
+	return filepath.Join(r.basePath, historyDir, hash)
+}
+
+// versionNumbers returns the versions stored in dir, oldest first
+func versionNumbers(dir string) []int {
+	entries, _ := os.ReadDir(dir)
+	var numbers []int
+	for _, entry := range entries {
+		if number, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json")); err == nil {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+	return numbers
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+func TestHistory(t *testing.T) {
+	newInteraction := func(status int) *models.Interaction {
+		return &models.Interaction{
+			Request:  models.RecordedRequest{Method: "GET", URL: "/users"},
+			Response: models.RecordedResponse{StatusCode: status},
+			Metadata: models.InteractionMetadata{Target: "api.example.com"},
+		}
+	}
+	hash := newInteraction(0).Request.GenerateHash()
+
+	t.Run("Replacing a recording keeps the old version", func(t *testing.T) {
+		repo, _ := NewFileSystemRepository(t.TempDir())
+		repo.Save(newInteraction(200))
+		repo.Save(newInteraction(500))
+
+		versions, err := repo.History(hash)
+		if err != nil {
+			t.Fatalf("History failed: %v", err)
+		}
+		if len(versions) != 1 || versions[0].Number != 1 || versions[0].Status != 200 {
+			t.Fatalf("Expected version 1 with status 200, got %+v", versions)
+		}
+
+		old, err := repo.Version(hash, 1)
+		if err != nil || old.Response.StatusCode != 200 {
+			t.Errorf("Expected the old recording, got %v", err)
+		}
+		if _, err := repo.Version(hash, 2); err == nil {
+			t.Errorf("Expected ErrVersionNotFound")
+		} else if _, ok := err.(ErrVersionNotFound); !ok {
+			t.Errorf("Expected ErrVersionNotFound, got %T", err)
+		}
+	})
+
+	t.Run("Identical saves are not versions", func(t *testing.T) {
+		repo, _ := NewFileSystemRepository(t.TempDir())
+		interaction := newInteraction(200)
+		repo.Save(interaction)
+		repo.Save(interaction)
+
+		if versions, _ := repo.History(hash); len(versions) != 0 {
+			t.Errorf("Expected no versions, got %+v", versions)
+		}
+	})
+
+	t.Run("History is bounded", func(t *testing.T) {
+		repo, _ := NewFileSystemRepository(t.TempDir())
+		repo.SetHistoryLimit(2)
+		for status := 200; status < 205; status++ {
+			repo.Save(newInteraction(status))
+		}
+
+		versions, _ := repo.History(hash)
+		if len(versions) != 2 || versions[0].Number != 4 || versions[1].Number != 3 {
+			t.Fatalf("Expected versions 4 and 3, got %+v", versions)
+		}
+		if versions[0].Status != 203 {
+			t.Errorf("Expected the newest version first, got %+v", versions[0])
+		}
+	})
+
+	t.Run("A limit of 0 disables history", func(t *testing.T) {
+		dir := t.TempDir()
+		repo, _ := NewFileSystemRepository(dir)
+		repo.SetHistoryLimit(0)
+		repo.Save(newInteraction(200))
+		repo.Save(newInteraction(500))
+
+		if _, err := os.Stat(filepath.Join(dir, historyDir)); !os.IsNotExist(err) {
+			t.Errorf("Expected no history directory, got %v", err)
+		}
+	})
+
+	t.Run("Rollback restores a version and keeps the replaced one", func(t *testing.T) {
+		repo, _ := NewFileSystemRepository(t.TempDir())
+		repo.Save(newInteraction(200))
+		repo.Save(newInteraction(500))
+
+		if _, err := repo.Rollback(hash, 1); err != nil {
+			t.Fatalf("Rollback failed: %v", err)
+		}
+		current, _ := repo.Find(hash)
+		if current.Response.StatusCode != 200 {
+			t.Errorf("Expected status 200 after rollback, got %d", current.Response.StatusCode)
+		}
+		versions, _ := repo.History(hash)
+		if len(versions) != 2 || versions[0].Status != 500 {
+			t.Errorf("Expected the replaced version in history, got %+v", versions)
+		}
+	})
+
+	t.Run("Delete and Clear remove the history", func(t *testing.T) {
+		dir := t.TempDir()
+		repo, _ := NewFileSystemRepository(dir)
+		repo.Save(newInteraction(200))
+		repo.Save(newInteraction(500))
+
+		if err := repo.Delete(hash); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if versions, _ := repo.History(hash); len(versions) != 0 {
+			t.Errorf("Expected the history to be removed, got %+v", versions)
+		}
+
+		repo.Save(newInteraction(200))
+		repo.Save(newInteraction(500))
+		if err := repo.Clear(); err != nil {
+			t.Fatalf("Clear failed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, historyDir)); !os.IsNotExist(err) {
+			t.Errorf("Expected Clear to remove the history, got %v", err)
+		}
+	})
+
+	t.Run("Versions are not recordings", func(t *testing.T) {
+		repo, _ := NewFileSystemRepository(t.TempDir())
+		repo.Save(newInteraction(200))
+		repo.Save(newInteraction(500))
+
+		all, _ := repo.FindAll()
+		count, _ := repo.Count()
+		if len(all) != 1 || count != 1 {
+			t.Errorf("Expected 1 recording, got %d listed and %d counted", len(all), count)
+		}
+		if problems, _ := repo.Verify(); len(problems) != 0 {
+			t.Errorf("Expected no problems, got %+v", problems)
+		}
+	})
+
+	t.Run("Hashes can't leave the history directory", func(t *testing.T) {
+		dir := t.TempDir()
+		repo, _ := NewFileSystemRepository(filepath.Join(dir, "recordings"))
+		os.MkdirAll(filepath.Join(dir, "1"), 0755)
+		os.WriteFile(filepath.Join(dir, "1", "1.json"), []byte(`{"request":{"method":"GET","url":"/"}}`), 0644)
+
+		if _, err := repo.Version("../..", 1); err == nil {
+			t.Errorf("Expected a version outside the directory to be unreachable")
+		}
+	})
+}
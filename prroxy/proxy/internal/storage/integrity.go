@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// quarantineDir holds files moved aside by Repair, keeping their
+// service directory so they can be inspected or restored by hand
+const quarantineDir = "_quarantine"
+
+// Problem kinds reported by Verify
+const (
+	ProblemCorrupt      = "corrupt"       // Unreadable or invalid JSON
+	ProblemHashMismatch = "hash_mismatch" // Contents hash to a different filename
+	ProblemDuplicate    = "duplicate"     // Same hash in another service directory
+	ProblemMissingField = "missing_field" // Method, URL or status not set
+	ProblemMissingBlob  = "missing_blob"  // Body blob referenced but not stored
+	ProblemCorruptBlob  = "corrupt_blob"  // Blob contents don't match its name
+	ProblemInterrupted  = "interrupted"   // Temporary file left by a crashed write
+)
+
+// Problem describes one damaged file found by Verify
+type Problem struct {
+	Path  string `json:"path"`  // Relative to the recordings directory
+	Kind  string `json:"kind"`  // One of the Problem* constants
+	Issue string `json:"issue"` // What is wrong with it
+
+	// Hash is what a mismatched recording's contents hash to
+	Hash string `json:"hash,omitempty"`
+
+	// Fix is set by Repair to what was done about the problem
+	Fix string `json:"fix,omitempty"`
+}
+
+// Verify re-reads every recording and blob. It reports recordings that
+// don't parse, whose contents no longer hash to their filename, that share
+// a hash with another copy, lack required fields or reference missing
+// blobs, blobs whose contents don't match their name, and temporary files
+// left behind by interrupted writes.
+func (r *FileSystemRepository) Verify() ([]Problem, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var problems []Problem
+	report := func(path, kind, format string, args ...interface{}) {
+		rel, _ := filepath.Rel(r.basePath, path)
+		problems = append(problems, Problem{Path: rel, Kind: kind, Issue: fmt.Sprintf(format, args...)})
+	}
+	copies := make(map[string][]string) // Request hash -> paths
+
+	err := filepath.Walk(r.basePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if isHidden(info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if isTemp(info.Name()) {
+			if time.Since(info.ModTime()) > staleTempAge {
+				report(path, ProblemInterrupted, "unfinished write from %s", info.ModTime().Format(time.RFC3339))
+			}
+			return nil
+		}
+
+		if filepath.Base(filepath.Dir(path)) == blobDir {
+			if digest, err := hashFile(path); err != nil {
+				report(path, ProblemCorruptBlob, "unreadable blob: %v", err)
+			} else if digest != info.Name() {
+				report(path, ProblemCorruptBlob, "blob contents hash to %s", digest)
+			}
+			return nil
+		}
+
+		if !strings.HasSuffix(info.Name(), ".json") {
+			return nil
+		}
+		interaction, err := readInteraction(path)
+		if err != nil {
+			report(path, ProblemCorrupt, "%v", err)
+			return nil
+		}
+		hash := interaction.Request.GenerateHash()
+		copies[hash] = append(copies[hash], path)
+
+		for _, field := range []struct {
+			name    string
+			missing bool
+		}{
+			{"request.method", interaction.Request.Method == ""},
+			{"request.url", interaction.Request.URL == ""},
+			{"response.status_code", interaction.Response.StatusCode == 0},
+		} {
+			if field.missing {
+				report(path, ProblemMissingField, "missing %s", field.name)
+			}
+		}
+
+		if info.Name() != hash+".json" && info.Name() != readableName(&interaction.Request, hash) {
+			report(path, ProblemHashMismatch, "request hashes to %s", hash)
+			problems[len(problems)-1].Hash = hash
+		}
+		for _, ref := range []string{interaction.Request.BodyRef, interaction.Response.BodyRef, interaction.Response.BodyDigest} {
+			if ref == "" {
+				continue
+			}
+			if !validBlobRef(ref) {
+				report(path, ProblemMissingBlob, "invalid blob reference %s", ref)
+			} else if _, err := os.Stat(filepath.Join(r.basePath, blobDir, ref)); err != nil {
+				report(path, ProblemMissingBlob, "missing blob %s", ref)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk directory: %w", err)
+	}
+
+	// The most recently written copy of a hash is the one to keep
+	for hash, paths := range copies {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			return modTime(paths[i]).After(modTime(paths[j]))
+		})
+		kept, _ := filepath.Rel(r.basePath, paths[0])
+		for _, path := range paths[1:] {
+			report(path, ProblemDuplicate, "%s is also stored as %s", hash[:shortHashLen], kept)
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Path < problems[j].Path
+	})
+	return problems, nil
+}
+
+// Repair fixes the problems Verify found: mismatched recordings are
+// renamed to their real hash (or quarantined when that hash is taken),
+// everything else is moved to the _quarantine directory. It returns the
+// problems with Fix filled in.
+func (r *FileSystemRepository) Repair(problems []Problem) ([]Problem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unlock, err := r.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	repaired := make([]Problem, 0, len(problems))
+	for _, problem := range problems {
+		path := filepath.Join(r.basePath, problem.Path)
+
+		// An earlier fix may already have moved the file
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			problem.Fix = "already moved"
+			repaired = append(repaired, problem)
+			continue
+		}
+
+		if problem.Kind == ProblemHashMismatch && ValidHash(problem.Hash) {
+			taken, _ := r.locate(problem.Hash)
+			interaction, err := readInteraction(path)
+			if len(taken) == 0 && err == nil {
+				dest := filepath.Join(filepath.Dir(path), r.filename(&interaction.Request, problem.Hash))
+				if err := os.Rename(path, dest); err != nil {
+					return repaired, fmt.Errorf("failed to rename %s: %w", problem.Path, err)
+				}
+				rel, _ := filepath.Rel(r.basePath, dest)
+				problem.Fix = "renamed to " + rel
+				repaired = append(repaired, problem)
+				continue
+			}
+		}
+
+		dest, err := r.quarantine(path)
+		if err != nil {
+			return repaired, err
+		}
+		rel, _ := filepath.Rel(r.basePath, dest)
+		problem.Fix = "quarantined to " + rel
+		repaired = append(repaired, problem)
+	}
+
+	return repaired, nil
+}
+
+// quarantine moves a file below the quarantine directory, keeping its
+// relative path and never overwriting an earlier quarantined copy
+func (r *FileSystemRepository) quarantine(path string) (string, error) {
+	rel, err := filepath.Rel(r.basePath, path)
+	if err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(r.basePath, quarantineDir, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	if _, err := os.Stat(dest); err == nil {
+		dest += "." + time.Now().Format("20060102T150405.000000000")
+	}
+
+	if err := os.Rename(path, dest); err != nil {
+		return "", fmt.Errorf("failed to quarantine %s: %w", rel, err)
+	}
+	return dest, nil
+}
+
+// hashFile returns the hex SHA-256 digest of a file's contents
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := NewFileSystemRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	save := func(url string) string {
+		interaction := &models.Interaction{
+			Request:  models.RecordedRequest{Method: "GET", URL: url},
+			Response: models.RecordedResponse{StatusCode: 200},
+			Metadata: models.InteractionMetadata{Target: "api.example.com"},
+		}
+		if err := repo.Save(interaction); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+		return filepath.Join(dir, "api_example_com", interaction.Request.GenerateHash()+".json")
+	}
+
+	t.Run("Healthy store", func(t *testing.T) {
+		save("/ok")
+		ref, _, _ := repo.SaveBlob(strings.NewReader("blob"))
+		repo.Save(&models.Interaction{
+			Request:  models.RecordedRequest{Method: "GET", URL: "/blob"},
+			Response: models.RecordedResponse{StatusCode: 200, BodyRef: ref, BodySize: 4},
+			Metadata: models.InteractionMetadata{Target: "api.example.com"},
+		})
+
+		problems, err := repo.Verify()
+		if err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		if len(problems) != 0 {
+			t.Errorf("Expected no problems, got %+v", problems)
+		}
+	})
+
+	t.Run("Damage is reported", func(t *testing.T) {
+		// Edited by hand so the content no longer matches the name
+		edited := save("/edited")
+		data, _ := os.ReadFile(edited)
+		os.WriteFile(edited, []byte(strings.Replace(string(data), "/edited", "/changed", 1)), 0644)
+
+		truncated := save("/truncated")
+		os.WriteFile(truncated, []byte(`{"request":`), 0644)
+
+		repo.Save(&models.Interaction{
+			Request:  models.RecordedRequest{Method: "GET", URL: "/lost"},
+			Response: models.RecordedResponse{StatusCode: 200, BodyRef: strings.Repeat("a", 64)},
+			Metadata: models.InteractionMetadata{Target: "api.example.com"},
+		})
+
+		ref, _, _ := repo.SaveBlob(strings.NewReader("original"))
+		os.WriteFile(filepath.Join(dir, blobDir, ref), []byte("tampered"), 0644)
+
+		// Copied into a second service directory
+		copied := save("/copied")
+		data, _ = os.ReadFile(copied)
+		os.MkdirAll(filepath.Join(dir, "other_service"), 0755)
+		os.WriteFile(filepath.Join(dir, "other_service", filepath.Base(copied)), data, 0644)
+
+		// Written by hand without a status
+		noStatus := &models.Interaction{Request: models.RecordedRequest{Method: "GET", URL: "/no-status"}}
+		data, _ = json.Marshal(noStatus)
+		os.WriteFile(filepath.Join(dir, "api_example_com", noStatus.Request.GenerateHash()+".json"), data, 0644)
+
+		problems, err := repo.Verify()
+		if err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+
+		kinds := map[string]int{}
+		for _, problem := range problems {
+			kinds[problem.Kind]++
+		}
+		for _, want := range []string{ProblemCorruptBlob, ProblemHashMismatch, ProblemCorrupt, ProblemMissingBlob, ProblemDuplicate, ProblemMissingField} {
+			if kinds[want] != 1 {
+				t.Errorf("Expected one %s problem, got %+v", want, problems)
+			}
+		}
+		if len(problems) != 6 {
+			t.Errorf("Expected 6 problems, got %d", len(problems))
+		}
+
+		if _, err := repo.FindAll(); err != nil {
+			t.Errorf("FindAll should skip the corrupt file, got %v", err)
+		}
+	})
+
+	t.Run("Repair", func(t *testing.T) {
+		problems, _ := repo.Verify()
+		repaired, err := repo.Repair(problems)
+		if err != nil {
+			t.Fatalf("Repair failed: %v", err)
+		}
+
+		for _, problem := range repaired {
+			want := "quarantined to " + quarantineDir
+			if problem.Kind == ProblemHashMismatch {
+				want = "renamed to api_example_com/" + problem.Hash
+			}
+			if !strings.HasPrefix(problem.Fix, want) {
+				t.Errorf("Expected %s to be %s, got %q", problem.Path, want, problem.Fix)
+			}
+		}
+
+		problems, err = repo.Verify()
+		if err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		if len(problems) != 0 {
+			t.Errorf("Expected a clean store after repair, got %+v", problems)
+		}
+
+		interaction, err := repo.Find(repaired[indexOf(repaired, ProblemHashMismatch)].Hash)
+		if err != nil || interaction.Request.URL != "/changed" {
+			t.Errorf("Expected the renamed recording to be found, got %v", err)
+		}
+	})
+}
+
+func indexOf(problems []Problem, kind string) int {
+	for i, problem := range problems {
+		if problem.Kind == kind {
+			return i
+		}
+	}
+	return -1
+}
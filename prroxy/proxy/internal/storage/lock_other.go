@@ -0,0 +1,21 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// Advisory locking is only implemented on Unix; elsewhere a recordings
+// directory must not be shared between processes
+
+func lockFile(file *os.File) error {
+	return nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
+
+// syncDir is a no-op where directories can't be opened for syncing
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+// Sort fields supported by Query
+const (
+	SortByTimestamp = "timestamp"
+	SortByURL       = "url"
+	SortByStatus    = "status"
+	SortByDuration  = "duration"
+	SortByMethod    = "method"
+)
+
+// Query filters, sorts and paginates stored interactions.
+// Zero values mean "no constraint".
+type Query struct {
+	Target      string         // Host or target prefix, see MatchTarget
+	Method      string         // Case-insensitive method match
+	Status      int            // Exact response status
+	URLContains string         // Substring of the request URL
+	URLPattern  *regexp.Regexp // Regular expression on the request URL
+	Operation   string         // GraphQL operation name
+	Since       time.Time      // Recorded at or after
+	Until       time.Time      // Recorded before
+	SortBy      string         // One of the SortBy* constants (default timestamp)
+	Ascending   bool           // Default is descending (newest first)
+	Cursor      string         // Opaque cursor from a previous QueryResult
+	Page        int            // 1-based page number, alternative to Cursor
+	Limit       int            // Page size, 0 for everything
+
+	// Where, if set, must also hold; for conditions the store can't
+	// evaluate itself, such as staleness under the configured ttls
+	Where func(*models.Interaction) bool
+}
+
+// QueryResult is one page of matching interactions
+type QueryResult struct {
+	Interactions []*models.Interaction
+	Total        int    // Number of matches across all pages
+	NextCursor   string // Empty when this is the last page
+}
+
+// Matches reports whether an interaction satisfies the query filters
+func (q Query) Matches(interaction *models.Interaction) bool {
+	if q.Target != "" && !MatchTarget(interaction.Metadata.Target, q.Target) {
+		return false
+	}
+	if q.Method != "" && !strings.EqualFold(interaction.Request.Method, q.Method) {
+		return false
+	}
+	if q.Status != 0 && interaction.Response.StatusCode != q.Status {
+		return false
+	}
+	if q.URLContains != "" && !strings.Contains(interaction.Request.URL, q.URLContains) {
+		return false
+	}
+	if q.URLPattern != nil && !q.URLPattern.MatchString(interaction.Request.URL) {
+		return false
+	}
+	if q.Operation != "" && (interaction.Request.GraphQL == nil || interaction.Request.GraphQL.Name != q.Operation) {
+		return false
+	}
+	if !q.Since.IsZero() && interaction.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !interaction.Timestamp.Before(q.Until) {
+		return false
+	}
+	if q.Where != nil && !q.Where(interaction) {
+		return false
+	}
+	return true
+}
+
+// MatchTarget reports whether a recorded target matches a filter. The
+// filter is a host ("api.example.com") or a target prefix that ends on a
+// path boundary ("api.example.com/users" matches "api.example.com/users/1"
+// but not "api.example.com/usersX"). Schemes are ignored on both sides.
+func MatchTarget(target, filter string) bool {
+	target = trimScheme(target)
+	filter = strings.TrimSuffix(trimScheme(filter), "/")
+	if filter == "" {
+		return true
+	}
+	if !strings.HasPrefix(target, filter) {
+		return false
+	}
+	rest := target[len(filter):]
+	return rest == "" || rest[0] == '/' || rest[0] == '?'
+}
+
+func trimScheme(target string) string {
+	target = strings.TrimPrefix(target, "http://")
+	return strings.TrimPrefix(target, "https://")
+}
+
+// Validate checks the sort field and cursor
+func (q Query) Validate() error {
+	switch q.SortBy {
+	case "", SortByTimestamp, SortByURL, SortByStatus, SortByDuration, SortByMethod:
+	default:
+		return fmt.Errorf("invalid sort field: %s", q.SortBy)
+	}
+	if _, err := q.offset(); err != nil {
+		return err
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("invalid limit: %d", q.Limit)
+	}
+	if q.Page < 0 {
+		return fmt.Errorf("invalid page: %d", q.Page)
+	}
+	return nil
+}
+
+// offset decodes the cursor. Cursors are opaque to callers so backends
+// are free to switch to keyset pagination later.
+func (q Query) offset() (int, error) {
+	if q.Cursor == "" {
+		if q.Page > 1 {
+			return (q.Page - 1) * q.Limit, nil
+		}
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(q.Cursor)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid cursor: %s", q.Cursor)
+	}
+	return offset, nil
+}
+
+// ApplyQuery filters, sorts and paginates an in-memory slice. Backends
+// without their own index use this after loading candidates.
+func ApplyQuery(interactions []*models.Interaction, q Query) (*QueryResult, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	matched := make([]*models.Interaction, 0, len(interactions))
+	for _, interaction := range interactions {
+		if q.Matches(interaction) {
+			matched = append(matched, interaction)
+		}
+	}
+
+	sortInteractions(matched, q.SortBy, q.Ascending)
+
+	offset, _ := q.offset()
+	result := &QueryResult{Total: len(matched)}
+
+	if offset >= len(matched) {
+		result.Interactions = []*models.Interaction{}
+		return result, nil
+	}
+
+	end := len(matched)
+	if q.Limit > 0 && offset+q.Limit < end {
+		end = offset + q.Limit
+		result.NextCursor = strconv.Itoa(end)
+	}
+	result.Interactions = matched[offset:end]
+
+	return result, nil
+}
+
+// sortInteractions orders interactions by field; ties fall back to
+// timestamp so pages are stable
+func sortInteractions(interactions []*models.Interaction, field string, ascending bool) {
+	less := func(a, b *models.Interaction) bool {
+		switch field {
+		case SortByURL:
+			if a.Request.URL != b.Request.URL {
+				return a.Request.URL < b.Request.URL
+			}
+		case SortByStatus:
+			if a.Response.StatusCode != b.Response.StatusCode {
+				return a.Response.StatusCode < b.Response.StatusCode
+			}
+		case SortByDuration:
+			if a.Metadata.DurationMS != b.Metadata.DurationMS {
+				return a.Metadata.DurationMS < b.Metadata.DurationMS
+			}
+		case SortByMethod:
+			if a.Request.Method != b.Request.Method {
+				return a.Request.Method < b.Request.Method
+			}
+		}
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		return a.ID < b.ID
+	}
+
+	sort.SliceStable(interactions, func(i, j int) bool {
+		if ascending {
+			return less(interactions[i], interactions[j])
+		}
+		return less(interactions[j], interactions[i])
+	})
+}
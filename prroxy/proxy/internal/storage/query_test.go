@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/pismo/testing-proxy/internal/models"
+)
+
+func TestQuery(t *testing.T) {
+	repo, err := NewFileSystemRepository(filepath.Join(t.TempDir(), "query"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fixtures := []struct {
+		target string
+		method string
+		url    string
+		status int
+	}{
+		{"api.users.com/users/1", "GET", "/users/1", 200},
+		{"api.users.com/users/2", "GET", "/users/2", 404},
+		{"api.users.com/users", "POST", "/users", 201},
+		{"api.orders.com/orders/1", "GET", "/orders/1", 200},
+		{"api.orders.com/orders/1", "DELETE", "/orders/1", 204},
+	}
+	for i, f := range fixtures {
+		repo.Save(&models.Interaction{
+			ID:        f.url + f.method,
+			Timestamp: base.Add(time.Duration(i) * time.Hour),
+			Request:   models.RecordedRequest{Method: f.method, URL: f.url},
+			Response:  models.RecordedResponse{StatusCode: f.status},
+			Metadata:  models.InteractionMetadata{Target: f.target},
+		})
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  int
+	}{
+		{"everything", Query{}, 5},
+		{"by target host", Query{Target: "api.users.com"}, 3},
+		{"by target prefix", Query{Target: "api.users.com/users/1"}, 1},
+		{"target with scheme", Query{Target: "https://api.orders.com/orders"}, 2},
+		{"prefix ends on a path boundary", Query{Target: "api.users.com/use"}, 0},
+		{"unknown target", Query{Target: "api.nothing.com"}, 0},
+		{"by method", Query{Method: "get"}, 3},
+		{"by status", Query{Status: 200}, 2},
+		{"by url substring", Query{URLContains: "/orders"}, 2},
+		{"by url regex", Query{URLPattern: regexp.MustCompile(`^/users/\d+$`)}, 2},
+		{"by time range", Query{Since: base.Add(time.Hour), Until: base.Add(3 * time.Hour)}, 2},
+		{"by GraphQL operation", Query{Operation: "GetUser"}, 0},
+		{"combined", Query{Target: "api.users.com", Method: "GET", Status: 404}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := repo.Query(tt.query)
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if result.Total != tt.want || len(result.Interactions) != tt.want {
+				t.Errorf("Expected %d results, got total=%d page=%d", tt.want, result.Total, len(result.Interactions))
+			}
+		})
+	}
+
+	t.Run("Default sort is newest first", func(t *testing.T) {
+		result, _ := repo.Query(Query{})
+		if result.Interactions[0].Request.URL != "/orders/1" || result.Interactions[0].Request.Method != "DELETE" {
+			t.Errorf("Expected newest first, got %s %s", result.Interactions[0].Request.Method, result.Interactions[0].Request.URL)
+		}
+	})
+
+	t.Run("Sort by status ascending", func(t *testing.T) {
+		result, _ := repo.Query(Query{SortBy: SortByStatus, Ascending: true})
+		if result.Interactions[0].Response.StatusCode != 200 || result.Interactions[4].Response.StatusCode != 404 {
+			t.Error("Expected results ordered by status")
+		}
+	})
+
+	t.Run("Cursor pagination", func(t *testing.T) {
+		seen := make(map[string]bool)
+		query := Query{Limit: 2}
+		pages := 0
+		for {
+			result, err := repo.Query(query)
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			for _, interaction := range result.Interactions {
+				seen[interaction.ID] = true
+			}
+			pages++
+			if result.NextCursor == "" {
+				break
+			}
+			query.Cursor = result.NextCursor
+		}
+		if pages != 3 || len(seen) != 5 {
+			t.Errorf("Expected 3 pages covering 5 recordings, got %d pages and %d recordings", pages, len(seen))
+		}
+	})
+
+	t.Run("Page number", func(t *testing.T) {
+		result, _ := repo.Query(Query{Limit: 2, Page: 3})
+		if len(result.Interactions) != 1 || result.NextCursor != "" {
+			t.Errorf("Expected last page with 1 result, got %d (next %q)", len(result.Interactions), result.NextCursor)
+		}
+	})
+
+	t.Run("Invalid sort", func(t *testing.T) {
+		if _, err := repo.Query(Query{SortBy: "colour"}); err == nil {
+			t.Error("Expected error for invalid sort field")
+		}
+	})
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"io"
+
 	"github.com/pismo/testing-proxy/internal/models"
 )
 
@@ -12,10 +14,23 @@ type Repository interface {
 	// Find retrieves an interaction by request hash
 	Find(hash string) (*models.Interaction, error)
 
+	// Delete removes a single interaction by request hash, and any
+	// history it has
+	Delete(hash string) error
+
 	// FindAll returns all stored interactions
 	FindAll() ([]*models.Interaction, error)
 
-	// Clear removes all stored interactions
+	// Query returns a filtered, sorted page of interactions
+	Query(query Query) (*QueryResult, error)
+
+	// SaveBlob stores a large body out of line and returns its reference
+	SaveBlob(body io.Reader) (ref string, size int64, err error)
+
+	// OpenBlob opens a body stored with SaveBlob
+	OpenBlob(ref string) (io.ReadCloser, error)
+
+	// Clear removes all stored interactions, and any history
 	Clear() error
 
 	// Count returns the number of stored interactions
@@ -29,4 +44,27 @@ type ErrNotFound struct {
 
 func (e ErrNotFound) Error() string {
 	return "interaction not found for hash: " + e.Hash
+}
+
+// ErrInvalidHash is returned for hashes that are not lowercase hex
+// SHA-256 digests. Hashes name files, so nothing else is accepted.
+type ErrInvalidHash struct {
+	Hash string
+}
+
+func (e ErrInvalidHash) Error() string {
+	return "invalid hash: " + e.Hash
+}
+
+// ValidHash reports whether hash looks like a request hash
+func ValidHash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
 }
\ No newline at end of file
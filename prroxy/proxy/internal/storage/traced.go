@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/tracing"
+)
+
+// ContextBinder is implemented by repositories that can attach a request
+// context to their operations (used to parent tracing spans)
+type ContextBinder interface {
+	WithContext(ctx context.Context) Repository
+}
+
+// WithContext binds ctx to the repository if it supports it, otherwise
+// the repository is returned unchanged
+func WithContext(repository Repository, ctx context.Context) Repository {
+	if binder, ok := repository.(ContextBinder); ok {
+		return binder.WithContext(ctx)
+	}
+	return repository
+}
+
+// TracedRepository wraps a Repository and records a span per operation
+type TracedRepository struct {
+	next Repository
+	ctx  context.Context
+}
+
+// NewTracedRepository creates a tracing decorator around a repository
+func NewTracedRepository(next Repository) *TracedRepository {
+	return &TracedRepository{
+		next: next,
+		ctx:  context.Background(),
+	}
+}
+
+// WithContext returns a copy whose spans are children of the span in ctx
+func (r *TracedRepository) WithContext(ctx context.Context) Repository {
+	return &TracedRepository{
+		next: r.next,
+		ctx:  ctx,
+	}
+}
+
+// Save stores an interaction
+func (r *TracedRepository) Save(interaction *models.Interaction) error {
+	_, span := tracing.Start(r.ctx, "Repository.Save",
+		attribute.String("proxy.target", interaction.Metadata.Target),
+		attribute.String("proxy.hash", interaction.Request.GenerateHash()),
+	)
+	defer span.End()
+
+	err := r.next.Save(interaction)
+	tracing.RecordError(span, err)
+	return err
+}
+
+// Find retrieves an interaction by request hash
+func (r *TracedRepository) Find(hash string) (*models.Interaction, error) {
+	_, span := tracing.Start(r.ctx, "Repository.Find", attribute.String("proxy.hash", hash))
+	defer span.End()
+
+	interaction, err := r.next.Find(hash)
+	if _, ok := err.(ErrNotFound); ok {
+		// A miss is a normal outcome, not a span error
+		span.SetAttributes(attribute.Bool("proxy.found", false))
+		return nil, err
+	}
+	tracing.RecordError(span, err)
+	span.SetAttributes(attribute.Bool("proxy.found", err == nil))
+	return interaction, err
+}
+
+// Delete removes a single interaction by request hash
+func (r *TracedRepository) Delete(hash string) error {
+	_, span := tracing.Start(r.ctx, "Repository.Delete", attribute.String("proxy.hash", hash))
+	defer span.End()
+
+	err := r.next.Delete(hash)
+	if _, ok := err.(ErrNotFound); !ok {
+		tracing.RecordError(span, err)
+	}
+	return err
+}
+
+// FindAll returns all stored interactions
+func (r *TracedRepository) FindAll() ([]*models.Interaction, error) {
+	_, span := tracing.Start(r.ctx, "Repository.FindAll")
+	defer span.End()
+
+	interactions, err := r.next.FindAll()
+	tracing.RecordError(span, err)
+	span.SetAttributes(attribute.Int("proxy.count", len(interactions)))
+	return interactions, err
+}
+
+// Query returns a filtered, sorted page of interactions
+func (r *TracedRepository) Query(query Query) (*QueryResult, error) {
+	_, span := tracing.Start(r.ctx, "Repository.Query",
+		attribute.String("proxy.target", query.Target),
+		attribute.Int("proxy.limit", query.Limit),
+	)
+	defer span.End()
+
+	result, err := r.next.Query(query)
+	tracing.RecordError(span, err)
+	if result != nil {
+		span.SetAttributes(attribute.Int("proxy.total", result.Total))
+	}
+	return result, err
+}
+
+// SaveBlob stores a large body out of line and returns its reference
+func (r *TracedRepository) SaveBlob(body io.Reader) (string, int64, error) {
+	_, span := tracing.Start(r.ctx, "Repository.SaveBlob")
+	defer span.End()
+
+	ref, size, err := r.next.SaveBlob(body)
+	tracing.RecordError(span, err)
+	span.SetAttributes(attribute.Int64("proxy.size", size))
+	return ref, size, err
+}
+
+// OpenBlob opens a body stored with SaveBlob
+func (r *TracedRepository) OpenBlob(ref string) (io.ReadCloser, error) {
+	_, span := tracing.Start(r.ctx, "Repository.OpenBlob", attribute.String("proxy.blob", ref))
+	defer span.End()
+
+	body, err := r.next.OpenBlob(ref)
+	tracing.RecordError(span, err)
+	return body, err
+}
+
+// Clear removes all stored interactions
+func (r *TracedRepository) Clear() error {
+	_, span := tracing.Start(r.ctx, "Repository.Clear")
+	defer span.End()
+
+	err := r.next.Clear()
+	tracing.RecordError(span, err)
+	return err
+}
+
+// Count returns the number of stored interactions
+func (r *TracedRepository) Count() (int, error) {
+	_, span := tracing.Start(r.ctx, "Repository.Count")
+	defer span.End()
+
+	count, err := r.next.Count()
+	tracing.RecordError(span, err)
+	return count, err
+}
+
+// History lists a recording's previous versions
+func (r *TracedRepository) History(hash string) ([]Version, error) {
+	_, span := tracing.Start(r.ctx, "Repository.History", attribute.String("proxy.hash", hash))
+	defer span.End()
+
+	versioner, ok := r.next.(Versioner)
+	if !ok {
+		return nil, errNoHistory
+	}
+	versions, err := versioner.History(hash)
+	tracing.RecordError(span, err)
+	span.SetAttributes(attribute.Int("proxy.count", len(versions)))
+	return versions, err
+}
+
+// Version returns one previous version of a recording
+func (r *TracedRepository) Version(hash string, number int) (*models.Interaction, error) {
+	_, span := tracing.Start(r.ctx, "Repository.Version",
+		attribute.String("proxy.hash", hash),
+		attribute.Int("proxy.version", number),
+	)
+	defer span.End()
+
+	versioner, ok := r.next.(Versioner)
+	if !ok {
+		return nil, errNoHistory
+	}
+	interaction, err := versioner.Version(hash, number)
+	if _, ok := err.(ErrVersionNotFound); !ok {
+		tracing.RecordError(span, err)
+	}
+	return interaction, err
+}
+
+// Rollback makes a previous version current again
+func (r *TracedRepository) Rollback(hash string, number int) (*models.Interaction, error) {
+	_, span := tracing.Start(r.ctx, "Repository.Rollback",
+		attribute.String("proxy.hash", hash),
+		attribute.Int("proxy.version", number),
+	)
+	defer span.End()
+
+	versioner, ok := r.next.(Versioner)
+	if !ok {
+		return nil, errNoHistory
+	}
+	interaction, err := versioner.Rollback(hash, number)
+	if _, ok := err.(ErrVersionNotFound); !ok {
+		tracing.RecordError(span, err)
+	}
+	return interaction, err
+}
@@ -0,0 +1,220 @@
+// Package proxytest runs the testing proxy inside go test. Start serves it
+// on an httptest.Server and returns an http.RoundTripper that sends every
+// request through it, so code under test records to, or plays back from,
+// a cassette directory without a separate proxy process:
+//
+//	func TestUsers(t *testing.T) {
+//		p := proxytest.Start(t, proxytest.Options{Dir: "testdata/cassettes"})
+//		client := &http.Client{Transport: p.Transport()}
+//
+//		resp, err := client.Get("https://api.example.com/users/1")
+//		...
+//		p.AssertNoMisses(t)
+//		p.AssertAllUsed(t)
+//	}
+//
+// Run with PROXYTEST_MODE=record to refresh the cassettes.
+package proxytest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/handler"
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+// Proxy modes
+const (
+	Record   = "record"
+	Playback = "playback"
+	Hybrid   = "hybrid" // Playback, recording what is missing or stale
+)
+
+// ModeEnv overrides Options.Mode when set, e.g. PROXYTEST_MODE=record
+const ModeEnv = "PROXYTEST_MODE"
+
+// Options configures a test proxy
+type Options struct {
+	Mode       string // Record, Playback or Hybrid; defaults to $PROXYTEST_MODE, then Playback
+	Dir        string // Cassette directory; defaults to a temporary one
+	ConfigFile string // Optional proxy config file (upstreams, playback, ...)
+}
+
+// Miss is a request that found no recording during playback
+type Miss struct {
+	Method string
+	URL    string
+	Hash   string
+}
+
+// Proxy is a running test proxy
+type Proxy struct {
+	URL string // Base URL of the proxy server
+
+	server     *httptest.Server
+	repository storage.Repository
+
+	mu     sync.Mutex
+	used   map[string]bool // Recording hashes recorded or played back
+	misses []Miss
+}
+
+// Start serves a proxy for the duration of the test; it is closed by
+// t.Cleanup. Setup errors fail the test immediately.
+func Start(t testing.TB, opts Options) *Proxy {
+	t.Helper()
+
+	cfg := config.New()
+	if opts.ConfigFile != "" {
+		if err := cfg.LoadFile(opts.ConfigFile); err != nil {
+			t.Fatalf("proxytest: failed to load config: %v", err)
+		}
+	}
+
+	mode := opts.Mode
+	if env := os.Getenv(ModeEnv); env != "" {
+		mode = env
+	}
+	if mode == "" {
+		mode = Playback
+	}
+	if err := cfg.SetMode(mode); err != nil {
+		t.Fatalf("proxytest: %v", err)
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = t.TempDir()
+	}
+	cfg.Storage.Path = dir
+	repository, err := storage.NewFileSystemRepository(dir)
+	if err != nil {
+		t.Fatalf("proxytest: failed to open cassette directory: %v", err)
+	}
+	repository.SetFormat(cfg.Storage.Format)
+	repository.SetHistoryLimit(cfg.Storage.History)
+	repository.SetDedup(cfg.Storage.Dedup)
+
+	p := &Proxy{
+		repository: repository,
+		used:       make(map[string]bool),
+	}
+
+	proxyHandler := handler.NewProxyHandler(cfg, repository)
+	proxyHandler.Observe(p.observe)
+
+	p.server = httptest.NewServer(proxyHandler)
+	p.URL = p.server.URL
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+// observe tracks which recordings were used and which requests missed
+func (p *Proxy) observe(entry handler.RequestHistoryEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry.Outcome == handler.OutcomeMiss {
+		p.misses = append(p.misses, Miss{Method: entry.Method, URL: entry.URL, Hash: entry.ID})
+		return
+	}
+	p.used[entry.ID] = true
+}
+
+// Close shuts the proxy down
+func (p *Proxy) Close() {
+	p.server.Close()
+}
+
+// URLFor returns the proxy URL that forwards to target
+func (p *Proxy) URLFor(target string) string {
+	return p.URL + "/proxy?target=" + url.QueryEscape(target)
+}
+
+// Transport returns a RoundTripper sending requests through the proxy.
+// Request URLs stay the real upstream URLs.
+func (p *Proxy) Transport() http.RoundTripper {
+	return roundTripper{proxy: p, next: p.server.Client().Transport}
+}
+
+// Client returns an http.Client using Transport
+func (p *Proxy) Client() *http.Client {
+	return &http.Client{Transport: p.Transport()}
+}
+
+// Misses returns the requests that found no recording
+func (p *Proxy) Misses() []Miss {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Miss(nil), p.misses...)
+}
+
+// Unused returns the URLs of recordings in the cassette directory that no
+// request has used, sorted
+func (p *Proxy) Unused() ([]string, error) {
+	interactions, err := p.repository.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var unused []string
+	for _, interaction := range interactions {
+		if !p.used[interaction.Request.GenerateHash()] {
+			unused = append(unused, interaction.Request.Method+" "+interaction.Request.URL)
+		}
+	}
+	sort.Strings(unused)
+	return unused, nil
+}
+
+// AssertNoMisses fails the test if any request found no recording
+func (p *Proxy) AssertNoMisses(t testing.TB) {
+	t.Helper()
+	for _, miss := range p.Misses() {
+		t.Errorf("proxytest: no recording for %s %s (hash: %s)", miss.Method, miss.URL, miss.Hash)
+	}
+}
+
+// AssertAllUsed fails the test if any recording was never requested
+func (p *Proxy) AssertAllUsed(t testing.TB) {
+	t.Helper()
+	unused, err := p.Unused()
+	if err != nil {
+		t.Fatalf("proxytest: failed to list recordings: %v", err)
+	}
+	for _, recording := range unused {
+		t.Errorf("proxytest: recording never used: %s", recording)
+	}
+}
+
+// roundTripper rewrites each request into a ?target= request to the proxy
+type roundTripper struct {
+	proxy *Proxy
+	next  http.RoundTripper
+}
+
+func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	proxyURL, err := url.Parse(rt.proxy.URLFor(req.URL.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTrippers must not modify the caller's request
+	forward := req.Clone(req.Context())
+	forward.URL = proxyURL
+	forward.Host = ""
+	forward.RequestURI = ""
+	return rt.next.RoundTrip(forward)
+}
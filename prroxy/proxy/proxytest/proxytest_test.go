@@ -0,0 +1,98 @@
+package proxytest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecordAndPlayback(t *testing.T) {
+	t.Setenv(ModeEnv, "")
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello from " + r.URL.Path))
+	}))
+	dir := t.TempDir()
+
+	get := func(t *testing.T, client *http.Client, url string) (int, string) {
+		t.Helper()
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	t.Run("Record", func(t *testing.T) {
+		p := Start(t, Options{Mode: Record, Dir: dir})
+
+		for _, path := range []string{"/a", "/b"} {
+			if status, body := get(t, p.Client(), upstream.URL+path); status != http.StatusOK || body != "hello from "+path {
+				t.Errorf("Unexpected response %d %q", status, body)
+			}
+		}
+		p.AssertNoMisses(t)
+	})
+
+	// Playback must not need the upstream
+	upstream.Close()
+
+	t.Run("Playback", func(t *testing.T) {
+		p := Start(t, Options{Dir: dir})
+		client := &http.Client{Transport: p.Transport()}
+
+		if status, body := get(t, client, upstream.URL+"/a"); status != http.StatusOK || body != "hello from /a" {
+			t.Errorf("Unexpected response %d %q", status, body)
+		}
+		p.AssertNoMisses(t)
+
+		unused, err := p.Unused()
+		if err != nil {
+			t.Fatalf("Failed to list unused recordings: %v", err)
+		}
+		if len(unused) != 1 || unused[0] != "GET "+upstream.URL+"/b" {
+			t.Errorf("Expected /b to be unused, got %v", unused)
+		}
+	})
+
+	t.Run("Misses are reported", func(t *testing.T) {
+		p := Start(t, Options{Dir: dir})
+
+		if status, _ := get(t, p.Client(), upstream.URL+"/missing"); status != http.StatusNotFound {
+			t.Errorf("Expected 404 for a miss, got %d", status)
+		}
+
+		misses := p.Misses()
+		if len(misses) != 1 || misses[0].URL != upstream.URL+"/missing" {
+			t.Errorf("Expected one miss for /missing, got %+v", misses)
+		}
+	})
+
+	t.Run("Mode from the environment", func(t *testing.T) {
+		t.Setenv(ModeEnv, "sideways")
+
+		ft := &fatalRecorder{TB: t}
+		func() {
+			defer func() { recover() }()
+			Start(ft, Options{Dir: dir})
+		}()
+		if !ft.failed {
+			t.Error("Expected an invalid mode to fail the test")
+		}
+	})
+}
+
+// fatalRecorder notes Fatalf instead of failing the real test
+type fatalRecorder struct {
+	testing.TB
+	failed bool
+}
+
+func (f *fatalRecorder) Fatalf(format string, args ...interface{}) {
+	f.failed = true
+	panic("fatal")
+}
@@ -0,0 +1,192 @@
+// Package replay records and replays HTTP traffic in-process. Transport is
+// an http.RoundTripper running the proxy's record and playback logic
+// directly, with no server in between, and it reads and writes the same
+// recordings directory as the proxy server:
+//
+//	transport, err := replay.NewTransport(replay.Options{Mode: replay.Playback, Dir: "testdata/cassettes"})
+//	if err != nil {
+//		...
+//	}
+//	client := &http.Client{Transport: transport}
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/pismo/testing-proxy/internal/config"
+	"github.com/pismo/testing-proxy/internal/mode"
+	"github.com/pismo/testing-proxy/internal/models"
+	"github.com/pismo/testing-proxy/internal/spool"
+	"github.com/pismo/testing-proxy/internal/storage"
+)
+
+// Modes
+const (
+	Record   = "record"
+	Playback = "playback"
+	Hybrid   = "hybrid" // Playback, recording what is missing or stale
+)
+
+// ErrNoRecording is returned (wrapped) for playback misses
+var ErrNoRecording = errors.New("no recording found")
+
+// Options configures a Transport
+type Options struct {
+	Mode       string // Record, Playback (default) or Hybrid
+	Dir        string // Recordings directory, shared with the proxy server
+	ConfigFile string // Optional proxy config file (upstreams, storage, ...)
+}
+
+// Transport records or replays each request it is given
+type Transport struct {
+	config     *config.Config
+	repository storage.Repository
+	recorder   *mode.Recorder
+	player     *mode.Player
+}
+
+// NewTransport creates a Transport over the recordings in opts.Dir
+func NewTransport(opts Options) (*Transport, error) {
+	cfg := config.New()
+	if opts.ConfigFile != "" {
+		if err := cfg.LoadFile(opts.ConfigFile); err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+	}
+	if opts.Mode != "" {
+		if err := cfg.SetMode(opts.Mode); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Dir != "" {
+		cfg.Storage.Path = opts.Dir
+	}
+
+	repository, err := storage.NewFileSystemRepository(cfg.Storage.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recordings directory: %w", err)
+	}
+	repository.SetFormat(cfg.Storage.Format)
+	repository.SetHistoryLimit(cfg.Storage.History)
+	repository.SetDedup(cfg.Storage.Dedup)
+
+	return &Transport{
+		config:     cfg,
+		repository: repository,
+		recorder:   mode.NewRecorder(cfg, repository),
+		player:     mode.NewPlayer(cfg, repository),
+	}, nil
+}
+
+// SetMode switches between Record and Playback
+func (t *Transport) SetMode(m string) error {
+	return t.config.SetMode(m)
+}
+
+// RoundTrip records the request against the real upstream, or answers it
+// from a recording. Responses carry the decoded body, as the recording
+// stores it.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if mode.IsWebSocketUpgrade(req) {
+		return nil, fmt.Errorf("replay: WebSocket upgrades need the proxy server")
+	}
+
+	body := spool.New(t.config.Storage.BlobThresholdBytes())
+	if req.Body != nil {
+		_, err := io.Copy(body, req.Body)
+		req.Body.Close()
+		if err != nil {
+			body.Close()
+			return nil, fmt.Errorf("replay: failed to read request body: %w", err)
+		}
+	}
+	defer body.Close()
+
+	// Recorded like the ?target= the proxy server would be given
+	target := models.NormalizeTarget(req.URL.String())
+
+	var interaction *models.Interaction
+	var err error
+	switch t.config.GetMode() {
+	case Record:
+		interaction, err = t.recorder.Stream(nil, req, target, body)
+	case Hybrid:
+		interaction, err = t.play(req, target, body)
+		if errors.Is(err, ErrNoRecording) {
+			interaction, err = t.recorder.Stream(nil, req, target, body)
+		}
+	default:
+		interaction, err = t.play(req, target, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return t.response(req, interaction.Response)
+}
+
+// play looks the request up
+func (t *Transport) play(req *http.Request, target string, body *spool.Spool) (*models.Interaction, error) {
+	interaction, err := t.player.HandleSpooled(req, target, body)
+	if err != nil {
+		if _, ok := err.(*mode.ErrNoRecording); ok {
+			return nil, fmt.Errorf("%w: %s", ErrNoRecording, err.Error())
+		}
+		return nil, err
+	}
+	return interaction, nil
+}
+
+// response builds the client's response from a recorded one
+func (t *Transport) response(req *http.Request, recorded models.RecordedResponse) (*http.Response, error) {
+	var body io.ReadCloser
+	var length int64
+
+	if recorded.BodyRef != "" {
+		blob, err := storage.WithContext(t.repository, req.Context()).OpenBlob(recorded.BodyRef)
+		if err != nil {
+			return nil, fmt.Errorf("replay: failed to open recorded body: %w", err)
+		}
+		body = blob
+		length = recorded.BodySize
+	} else {
+		// Recordings made before bodies were stored decoded
+		if err := recorded.Decompress(); err != nil {
+			fmt.Printf("Warning: Replaying encoded body as recorded: %v\n", err)
+		}
+		body = io.NopCloser(bytes.NewReader(recorded.Body))
+		length = int64(len(recorded.Body))
+	}
+
+	header := http.Header{}
+	for key, values := range recorded.Headers {
+		header[key] = append([]string(nil), values...)
+	}
+	mode.RemoveHopByHopHeaders(header)
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          body,
+		ContentLength: length,
+		Request:       req,
+	}
+	if len(recorded.Trailers) > 0 {
+		resp.Trailer = http.Header(recorded.Trailers).Clone()
+	}
+	if req.Method == http.MethodHead {
+		body.Close()
+		resp.Body = http.NoBody
+	}
+	return resp, nil
+}
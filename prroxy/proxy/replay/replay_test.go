@@ -0,0 +1,126 @@
+package replay
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pismo/testing-proxy/proxytest"
+)
+
+func TestTransport(t *testing.T) {
+	t.Setenv(proxytest.ModeEnv, "")
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(r.Method + " " + r.URL.Path + " " + string(body)))
+		gz.Close()
+	}))
+	defer upstream.Close()
+	dir := t.TempDir()
+
+	get := func(t *testing.T, client *http.Client, method, url, body string) string {
+		t.Helper()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, data)
+		}
+		return string(data)
+	}
+
+	t.Run("Record in-process", func(t *testing.T) {
+		transport, err := NewTransport(Options{Mode: Record, Dir: dir})
+		if err != nil {
+			t.Fatalf("Failed to create transport: %v", err)
+		}
+		got := get(t, &http.Client{Transport: transport}, "POST", upstream.URL+"/in-process", "payload")
+		if got != "POST /in-process payload" {
+			t.Errorf("Unexpected body %q", got)
+		}
+	})
+
+	t.Run("Record through the server", func(t *testing.T) {
+		p := proxytest.Start(t, proxytest.Options{Mode: proxytest.Record, Dir: dir})
+		get(t, p.Client(), "GET", upstream.URL+"/server", "")
+	})
+
+	t.Run("Replay both in-process", func(t *testing.T) {
+		transport, err := NewTransport(Options{Dir: dir})
+		if err != nil {
+			t.Fatalf("Failed to create transport: %v", err)
+		}
+		client := &http.Client{Transport: transport}
+
+		if got := get(t, client, "POST", upstream.URL+"/in-process", "payload"); got != "POST /in-process payload" {
+			t.Errorf("Unexpected body %q", got)
+		}
+		if got := get(t, client, "GET", upstream.URL+"/server", ""); got != "GET /server " {
+			t.Errorf("Unexpected body %q", got)
+		}
+
+		_, err = client.Get(upstream.URL + "/missing")
+		if !errors.Is(err, ErrNoRecording) {
+			t.Errorf("Expected ErrNoRecording, got %v", err)
+		}
+	})
+
+	t.Run("Replay both through the server", func(t *testing.T) {
+		p := proxytest.Start(t, proxytest.Options{Dir: dir})
+
+		get(t, p.Client(), "POST", upstream.URL+"/in-process", "payload")
+		get(t, p.Client(), "GET", upstream.URL+"/server", "")
+		p.AssertNoMisses(t)
+		p.AssertAllUsed(t)
+	})
+}
+
+func TestTransportTargets(t *testing.T) {
+	t.Setenv(proxytest.ModeEnv, "")
+
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure " + r.URL.Path))
+	}))
+	defer upstream.Close()
+	dir := t.TempDir()
+
+	transport, err := NewTransport(Options{Mode: Record, Dir: dir})
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(upstream.URL + "/users/1")
+	if err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	resp.Body.Close()
+
+	p := proxytest.Start(t, proxytest.Options{Dir: dir})
+	host := strings.TrimPrefix(upstream.URL, "https://")
+
+	for _, target := range []string{host + "/users/1", upstream.URL + "/users/1"} {
+		t.Run(target, func(t *testing.T) {
+			resp, err := http.Get(p.URLFor(target))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			data, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK || string(data) != "secure /users/1" {
+				t.Errorf("Expected the Transport's recording, got %d: %s", resp.StatusCode, data)
+			}
+		})
+	}
+	p.AssertNoMisses(t)
+}